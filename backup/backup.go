@@ -0,0 +1,346 @@
+// Package backup makes and restores backups of the session database, which holds the
+// keys of the bot accounts: losing it means linking every account again. A backup is a
+// gzip-compressed tar archive with a consistent copy of the database and a manifest,
+// optionally encrypted with config.BackupPassphrase.
+package backup
+
+import (
+	"aemy/config"
+	"aemy/database"
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// prefix starts the file name of every backup in config.BackupDir.
+	prefix = "aemy-backup-"
+
+	// archiveExt and encryptedExt end the file names of plain and encrypted backups.
+	archiveExt   = ".tar.gz"
+	encryptedExt = ".tar.gz.enc"
+
+	// databaseName and manifestName are the files in the archive.
+	databaseName = "session.db"
+	manifestName = "manifest.json"
+)
+
+// ErrUnsupported is returned for databases that cannot be backed up by the bot.
+var ErrUnsupported = errors.New("only SQLite databases can be backed up by the bot; back up PostgreSQL with pg_dump")
+
+// Manifest describes a backup.
+type Manifest struct {
+	// Created is when the backup was made.
+	Created time.Time `json:"created"`
+
+	// Dialect is the database dialect, always database.SQLite for now.
+	Dialect string `json:"dialect"`
+
+	// Version is the version of the bot's tables (see database.Version).
+	Version int `json:"version"`
+}
+
+// Passphrase returns the passphrase backups are encrypted with: config.BackupPassphrase,
+// overridden by the AEMY_BACKUP_PASSPHRASE environment variable. It is empty if backups
+// are not encrypted.
+func Passphrase() string {
+	if env := os.Getenv("AEMY_BACKUP_PASSPHRASE"); env != "" {
+		return env
+	}
+	return config.BackupPassphrase
+}
+
+// Create makes a backup of db in config.BackupDir and deletes the oldest backups beyond
+// config.BackupKeep. The copy is consistent even while the bot is writing to db.
+//
+// Parameters:
+//   - ctx: cancels the backup
+//   - db: the session database
+//   - dialect: the dialect db was opened with
+//
+// Returns:
+//   - string: the path of the new backup
+//   - error: ErrUnsupported for PostgreSQL, or if the backup cannot be written
+func Create(ctx context.Context, db *sql.DB, dialect string) (string, error) {
+	if dialect != database.SQLite {
+		return "", ErrUnsupported
+	}
+
+	version, err := database.Version(ctx, db)
+	if err != nil {
+		return "", fmt.Errorf("read database version: %w", err)
+	}
+
+	// VACUUM INTO writes a consistent, compacted copy without blocking the bot
+	tmp, err := os.MkdirTemp("", "aemy-backup-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	snapshot := filepath.Join(tmp, databaseName)
+	if _, err := db.ExecContext(ctx, `VACUUM INTO ?`, snapshot); err != nil {
+		return "", fmt.Errorf("copy database: %w", err)
+	}
+
+	created := time.Now()
+	data, err := archive(snapshot, Manifest{Created: created.UTC(), Dialect: dialect, Version: version})
+	if err != nil {
+		return "", err
+	}
+
+	ext := archiveExt
+	if passphrase := Passphrase(); passphrase != "" {
+		if data, err = encrypt(data, passphrase); err != nil {
+			return "", err
+		}
+		ext = encryptedExt
+	}
+
+	if err := os.MkdirAll(config.BackupDir, 0o700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(config.BackupDir, prefix+created.UTC().Format("20060102-150405")+ext)
+	if err := writeFile(path, data); err != nil {
+		return "", err
+	}
+
+	if err := prune(config.BackupDir, config.BackupKeep); err != nil {
+		return path, fmt.Errorf("delete old backups: %w", err)
+	}
+	return path, nil
+}
+
+// Restore replaces the SQLite database of dsn with the one in a backup. The bot must
+// not be running. The current database is kept next to it with the suffix
+// ".before-restore".
+//
+// Parameters:
+//   - path: the backup file, encrypted or not
+//   - dialect, dsn: the database to restore to, see database.Settings
+//
+// Returns:
+//   - Manifest: the manifest of the restored backup
+//   - error: ErrUnsupported for PostgreSQL, or if the backup cannot be read, decrypted or verified
+func Restore(path, dialect, dsn string) (Manifest, error) {
+	if dialect != database.SQLite {
+		return Manifest{}, ErrUnsupported
+	}
+	target, err := sqlitePath(dsn)
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Manifest{}, err
+	}
+	if encrypted(data) {
+		passphrase := Passphrase()
+		if passphrase == "" {
+			return Manifest{}, errors.New("the backup is encrypted; set config.BackupPassphrase or AEMY_BACKUP_PASSPHRASE")
+		}
+		if data, err = decrypt(data, passphrase); err != nil {
+			return Manifest{}, err
+		}
+	}
+
+	manifest, session, err := extract(data)
+	if err != nil {
+		return Manifest{}, err
+	}
+	if manifest.Version > database.Latest() {
+		return Manifest{}, fmt.Errorf("the backup is from a newer bot (database version %d, this bot supports %d)", manifest.Version, database.Latest())
+	}
+
+	// Write and check the restored database before the current one is moved away
+	restored := target + ".restore"
+	if err := writeFile(restored, session); err != nil {
+		return Manifest{}, err
+	}
+	if err := verify(restored); err != nil {
+		os.Remove(restored)
+		return Manifest{}, fmt.Errorf("the backup is damaged: %w", err)
+	}
+
+	if _, err := os.Stat(target); err == nil {
+		if err := os.Rename(target, target+".before-restore"); err != nil {
+			os.Remove(restored)
+			return Manifest{}, err
+		}
+	}
+	// The journal of the old database must not be applied to the restored one
+	os.Remove(target + "-wal")
+	os.Remove(target + "-shm")
+	if err := os.Rename(restored, target); err != nil {
+		return Manifest{}, err
+	}
+	return manifest, nil
+}
+
+// List returns the backups in config.BackupDir, oldest first.
+func List() ([]string, error) {
+	return list(config.BackupDir)
+}
+
+// archive packs the database file at path and its manifest into a gzip-compressed tar archive.
+func archive(path string, manifest Manifest) ([]byte, error) {
+	session, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for _, file := range []struct {
+		name string
+		data []byte
+	}{{manifestName, meta}, {databaseName, session}} {
+		header := &tar.Header{Name: file.name, Mode: 0o600, Size: int64(len(file.data)), ModTime: manifest.Created}
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(file.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// extract unpacks an archive made by archive.
+//
+// Returns:
+//   - Manifest: the manifest
+//   - []byte: the database file
+//   - error: if data is not a backup archive
+func extract(data []byte) (Manifest, []byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return Manifest{}, nil, fmt.Errorf("not a backup archive: %w", err)
+	}
+	tr := tar.NewReader(zr)
+
+	var manifest Manifest
+	var session []byte
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Manifest{}, nil, fmt.Errorf("not a backup archive: %w", err)
+		}
+		switch header.Name {
+		case manifestName:
+			meta, err := io.ReadAll(tr)
+			if err != nil {
+				return Manifest{}, nil, err
+			}
+			if err := json.Unmarshal(meta, &manifest); err != nil {
+				return Manifest{}, nil, fmt.Errorf("invalid manifest: %w", err)
+			}
+		case databaseName:
+			if session, err = io.ReadAll(tr); err != nil {
+				return Manifest{}, nil, err
+			}
+		}
+	}
+	if session == nil || manifest.Created.IsZero() {
+		return Manifest{}, nil, errors.New("not a backup archive: files are missing")
+	}
+	return manifest, session, nil
+}
+
+// verify opens the SQLite database at path and runs an integrity check.
+func verify(path string) error {
+	db, err := database.Open(database.SQLite, "file:"+path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var result string
+	if err := db.QueryRow(`PRAGMA integrity_check`).Scan(&result); err != nil {
+		return err
+	}
+	if result != "ok" {
+		return errors.New(result)
+	}
+	return nil
+}
+
+// sqlitePath returns the file name in a SQLite DSN such as "file:session.db?_foreign_keys=on".
+func sqlitePath(dsn string) (string, error) {
+	path, _, _ := strings.Cut(strings.TrimPrefix(dsn, "file:"), "?")
+	if path == "" || path == ":memory:" {
+		return "", fmt.Errorf("the database %q is not a file", dsn)
+	}
+	return path, nil
+}
+
+// writeFile writes data to path, readable only by the current user.
+func writeFile(path string, data []byte) error {
+	return os.WriteFile(path, data, 0o600)
+}
+
+// list returns the backups in dir, oldest first. The timestamp in the file names sorts
+// them by age.
+func list(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.Type().IsRegular() && strings.HasPrefix(name, prefix) &&
+			(strings.HasSuffix(name, archiveExt) || strings.HasSuffix(name, encryptedExt)) {
+			paths = append(paths, filepath.Join(dir, name))
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// prune deletes the oldest backups in dir beyond keep. Zero or less keeps every backup.
+func prune(dir string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+	paths, err := list(dir)
+	if err != nil {
+		return err
+	}
+	for len(paths) > keep {
+		if err := os.Remove(paths[0]); err != nil {
+			return err
+		}
+		paths = paths[1:]
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+// Package backup makes and restores backups of the session database.
+// This file, crypt.go, encrypts backup archives with a passphrase.
+package backup
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// magic starts every encrypted backup. It is followed by the scrypt salt, the GCM nonce
+// and the sealed archive.
+var magic = []byte("AEMYENC1")
+
+const saltSize = 16
+
+// key derives the AES-256 key for passphrase and salt.
+func key(passphrase string, salt []byte) ([]byte, error) {
+	return scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+}
+
+// encrypted reports whether data is an encrypted backup.
+func encrypted(data []byte) bool {
+	return bytes.HasPrefix(data, magic)
+}
+
+// encrypt seals data with AES-256-GCM under a key derived from passphrase.
+func encrypt(data []byte, passphrase string) ([]byte, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	out := append(append(append([]byte{}, magic...), salt...), nonce...)
+	return gcm.Seal(out, nonce, data, magic), nil
+}
+
+// decrypt opens data sealed by encrypt.
+//
+// Returns:
+//   - []byte: the archive
+//   - error: if the passphrase is wrong or data was modified
+func decrypt(data []byte, passphrase string) ([]byte, error) {
+	data = data[len(magic):]
+	if len(data) < saltSize {
+		return nil, errors.New("the backup is truncated")
+	}
+	salt, data := data[:saltSize], data[saltSize:]
+	gcm, err := newGCM(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("the backup is truncated")
+	}
+	nonce, sealed := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+
+	plain, err := gcm.Open(nil, nonce, sealed, magic)
+	if err != nil {
+		return nil, errors.New("the backup cannot be decrypted: wrong passphrase or damaged file")
+	}
+	return plain, nil
+}
+
+// newGCM returns an AES-256-GCM cipher keyed by passphrase and salt.
+func newGCM(passphrase string, salt []byte) (cipher.AEAD, error) {
+	k, err := key(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,42 @@
+// Package backup makes and restores backups of the session database.
+// This file, schedule.go, makes backups at a fixed interval while the bot runs.
+package backup
+
+import (
+	"aemy/database"
+	"aemy/utils"
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Schedule makes a backup of db every interval until ctx is done. Failures are logged
+// and retried at the next interval. It blocks, so run it in a goroutine.
+//
+// Parameters:
+//   - ctx: stops the schedule
+//   - db: the session database
+//   - dialect: the dialect db was opened with
+//   - interval: the time between backups, e.g. config.BackupInterval
+func Schedule(ctx context.Context, db *sql.DB, dialect string, interval time.Duration) {
+	if dialect != database.SQLite {
+		utils.Log.Warn().Err(ErrUnsupported).Msg("Scheduled backups disabled")
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			path, err := Create(ctx, db, dialect)
+			if err != nil {
+				utils.Log.Error().Err(err).Msg("Scheduled backup failed")
+				continue
+			}
+			utils.Log.Info().Str("path", path).Msg("Backup created")
+		}
+	}
+}
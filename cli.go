@@ -0,0 +1,536 @@
+// Package main is the entry point for the WhatsApp bot application.
+// This file, cli.go, implements the subcommands for operating the bot while it is
+// stopped: linking and removing accounts, sending messages from scripts, checking the
+// configuration and upgrading the database.
+package main
+
+import (
+	"aemy/backup"
+	"aemy/client"
+	"aemy/config"
+	"aemy/console"
+	"aemy/database"
+	"aemy/i18n"
+	"aemy/replay"
+	"aemy/utils"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// version is the release of the bot, set at build time with
+// go build -ldflags "-X main.version=v1.2.3".
+var version = "dev"
+
+// openManager applies the logging configuration and opens the account manager, for the
+// subcommands that work on the session store.
+//
+// Returns:
+//   - *client.Manager: the manager, not started; the caller must close it
+//   - error: if the database cannot be opened
+func openManager() (*client.Manager, error) {
+	if err := utils.InitLogger(); err != nil {
+		utils.Error(fmt.Sprintf("Logger configuration error: %v", err))
+	}
+	return client.Open()
+}
+
+// resolveAccount returns the phone number of the account to act on: number if given,
+// written in any format phoneNumber accepts, otherwise the only linked account.
+//
+// Returns:
+//   - string: the account's phone number
+//   - error: if number is empty and there is not exactly one linked account
+func resolveAccount(manager *client.Manager, number string) (string, error) {
+	if number != "" {
+		return phoneNumber(number), nil
+	}
+	accounts := manager.Accounts()
+	switch len(accounts) {
+	case 0:
+		return "", errors.New("no account is linked; link one with \"aemy login\"")
+	case 1:
+		return accounts[0].JID.User, nil
+	default:
+		return "", errors.New("several accounts are linked; choose one by phone number")
+	}
+}
+
+// phoneNumber removes the "+", spaces and dashes of a phone number in international
+// format, e.g. "+62 812-3456" becomes "628123456".
+func phoneNumber(s string) string {
+	return strings.NewReplacer("+", "", " ", "", "-", "").Replace(s)
+}
+
+// parseRecipient parses a recipient given as a JID (e.g. "123456789@g.us") or as a
+// phone number in international format.
+func parseRecipient(s string) (types.JID, error) {
+	if strings.Contains(s, "@") {
+		return types.ParseJID(s)
+	}
+	number := phoneNumber(s)
+	if number == "" || strings.Trim(number, "0123456789") != "" {
+		return types.JID{}, fmt.Errorf("invalid recipient %q: want a phone number or a JID", s)
+	}
+	return types.NewJID(number, types.DefaultUserServer), nil
+}
+
+// runConsole implements the console subcommand: every line read from stdin is handled
+// as a message from a simulated user. It returns the process exit code.
+func runConsole(args []string) int {
+	session, err := console.New(os.Stdout)
+	if err == nil {
+		err = session.Run(os.Stdin)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Console error:", err)
+		return 1
+	}
+	return 0
+}
+
+// runLogin implements the login subcommand: it links a new account with
+// config.LoginMethod, as the first start of the bot does. It returns the process exit code.
+func runLogin(args []string) int {
+	flags := flag.NewFlagSet("login", flag.ExitOnError)
+	loginFlags(flags)
+	logFlags(flags)
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "usage: aemy login [-login qr|code] [-phone n] [-qr-addr addr]")
+		return 2
+	}
+	if err := client.CheckLogin(); err != nil {
+		fmt.Fprintln(os.Stderr, "Login configuration error:", err)
+		return 2
+	}
+
+	manager, err := openManager()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer manager.Close()
+
+	account, err := manager.Login(context.Background())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Login failed:", err)
+		return 1
+	}
+	fmt.Printf("Logged in as %s. The account is started the next time the bot runs.\n", account.JID.User)
+	return 0
+}
+
+// runLogout implements the logout subcommand: it unlinks an account from the phone and
+// deletes its session. It returns the process exit code.
+func runLogout(args []string) int {
+	flags := flag.NewFlagSet("logout", flag.ExitOnError)
+	logFlags(flags)
+	flags.Parse(args)
+	if flags.NArg() > 1 {
+		fmt.Fprintln(os.Stderr, "usage: aemy logout [phone]")
+		return 2
+	}
+
+	manager, err := openManager()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer manager.Close()
+
+	number, err := resolveAccount(manager, flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := manager.RemoveAccount(context.Background(), number); err != nil {
+		fmt.Fprintln(os.Stderr, "Logout failed:", err)
+		return 1
+	}
+	fmt.Printf("Logged out %s.\n", number)
+	return 0
+}
+
+// runSend implements the send subcommand: it connects an account, sends one text
+// message and disconnects. The bot must not be running with the same account. It
+// returns the process exit code.
+func runSend(args []string) int {
+	flags := flag.NewFlagSet("send", flag.ExitOnError)
+	from := flags.String("account", "", "phone number of the account to send from (default: the only linked account)")
+	logFlags(flags)
+	flags.Parse(args)
+	if flags.NArg() < 2 {
+		fmt.Fprintln(os.Stderr, "usage: aemy send [-account phone] <jid|phone> <text>")
+		return 2
+	}
+	to, err := parseRecipient(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	text := strings.Join(flags.Args()[1:], " ")
+	if text == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to read the message:", err)
+			return 1
+		}
+		text = strings.TrimRight(string(data), "\n")
+	}
+	if strings.TrimSpace(text) == "" {
+		fmt.Fprintln(os.Stderr, "The message is empty.")
+		return 2
+	}
+
+	manager, err := openManager()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer manager.Close()
+
+	number, err := resolveAccount(manager, *from)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	id, err := manager.Send(context.Background(), number, to, text)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to send:", err)
+		return 1
+	}
+	fmt.Println(id)
+	return 0
+}
+
+// runAccounts implements the accounts subcommand and returns the process exit code.
+// Accounts added here are started the next time the bot runs.
+func runAccounts(args []string) int {
+	usage := "usage: aemy accounts [list | add [phone] | remove <phone>]"
+	manager, err := openManager()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer manager.Close()
+	ctx := context.Background()
+
+	command := "list"
+	if len(args) > 0 {
+		command = args[0]
+	}
+	switch {
+	case command == "list" && len(args) <= 1:
+		for _, account := range manager.Accounts() {
+			fmt.Printf("%s\t%s\n", account.JID.User, account.Name)
+		}
+	case command == "add" && len(args) <= 2:
+		phone := ""
+		if len(args) == 2 {
+			phone = args[1]
+		}
+		account, err := manager.AddAccount(ctx, phone, client.PrintLoginPrompt)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to add account:", err)
+			return 1
+		}
+		fmt.Printf("Added account %s. It is started the next time the bot runs.\n", account.JID.User)
+	case command == "remove" && len(args) == 2:
+		number, err := resolveAccount(manager, args[1])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if err := manager.RemoveAccount(ctx, number); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to remove account:", err)
+			return 1
+		}
+		fmt.Printf("Removed account %s.\n", number)
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+	return 0
+}
+
+// configCheck is one check of the config check subcommand.
+type configCheck struct {
+	// name describes what is checked.
+	name string
+
+	// run performs the check and returns details to show on success.
+	run func() (string, error)
+
+	// optional checks only produce warnings: the bot works without them, with fewer features.
+	optional bool
+}
+
+// runConfig implements the "config check" subcommand: it validates the settings in
+// config (with flags and environment variables applied) and the database connection.
+// It returns 0 if everything required is in order, 1 otherwise.
+func runConfig(args []string) int {
+	if len(args) != 1 || args[0] != "check" {
+		fmt.Fprintln(os.Stderr, "usage: aemy config check")
+		return 2
+	}
+
+	checks := []configCheck{
+		{"login", func() (string, error) { return config.LoginMethod, client.CheckLogin() }, false},
+		{"logging", func() (string, error) { return config.LogLevel + ", " + config.LogFormat, utils.CheckLogger() }, false},
+		{"timezone", func() (string, error) {
+			_, err := utils.ParseTimezone(config.Timezone)
+			return config.Timezone, err
+		}, false},
+		{"language", func() (string, error) {
+			if !i18n.Supported(config.Language) {
+				return "", fmt.Errorf("unsupported language %q (want one of %s)", config.Language, strings.Join(i18n.Languages(), ", "))
+			}
+			return config.Language, nil
+		}, false},
+		{"owners and prefixes", checkAccounts, false},
+		{"database", checkDatabase, false},
+		{"ffmpeg", func() (string, error) { return exec.LookPath(config.FFmpegPath) }, true},
+	}
+
+	code := 0
+	for _, check := range checks {
+		details, err := check.run()
+		switch {
+		case err == nil:
+			fmt.Printf("ok       %s: %s\n", check.name, details)
+		case check.optional:
+			fmt.Printf("warning  %s: %v\n", check.name, err)
+		default:
+			fmt.Printf("error    %s: %v\n", check.name, err)
+			code = 1
+		}
+	}
+	return code
+}
+
+// checkAccounts checks that every bot account has command prefixes and that owners and
+// accounts are given as phone numbers.
+func checkAccounts() (string, error) {
+	numbers := func(what string, values []string) error {
+		for _, value := range values {
+			if value == "" || strings.Trim(value, "0123456789") != "" {
+				return fmt.Errorf("%s %q is not a phone number in international format without \"+\"", what, value)
+			}
+		}
+		return nil
+	}
+
+	if err := numbers("owner", config.Owners); err != nil {
+		return "", err
+	}
+	if len(config.Prefixes) == 0 {
+		return "", errors.New("no command prefixes are configured")
+	}
+	for number, account := range config.Accounts {
+		if err := numbers("account", []string{number}); err != nil {
+			return "", err
+		}
+		if err := numbers("owner", account.Owners); err != nil {
+			return "", fmt.Errorf("account %s: %w", number, err)
+		}
+		if account.Prefixes != nil && len(account.Prefixes) == 0 {
+			return "", fmt.Errorf("account %s: no command prefixes are configured", number)
+		}
+	}
+	return fmt.Sprintf("%d owners, %d prefixes, %d account overrides", len(config.Owners), len(config.Prefixes), len(config.Accounts)), nil
+}
+
+// checkDatabase checks that the database can be reached and reports its version.
+func checkDatabase() (string, error) {
+	dialect, dsn := database.Settings()
+	db, err := database.Open(dialect, dsn)
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+
+	current, err := database.Version(context.Background(), db)
+	if err != nil {
+		return "", fmt.Errorf("read database version: %w", err)
+	}
+	if current > database.Latest() {
+		return "", fmt.Errorf("database version %d is newer than this bot supports (%d)", current, database.Latest())
+	}
+	details := fmt.Sprintf("%s, version %d", dialect, current)
+	if current < database.Latest() {
+		details += fmt.Sprintf(" (upgraded to %d on the next start or by \"aemy migrate\")", database.Latest())
+	}
+	return details, nil
+}
+
+// runMigrate implements the migrate subcommand: it upgrades the session store and the
+// bot's own tables, or with -status only shows the version. It returns the process exit code.
+func runMigrate(args []string) int {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	status := flags.Bool("status", false, "only show the database version")
+	logFlags(flags)
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "usage: aemy migrate [-status]")
+		return 2
+	}
+	if err := utils.InitLogger(); err != nil {
+		utils.Error(fmt.Sprintf("Logger configuration error: %v", err))
+	}
+	defer utils.CloseLogger()
+
+	if *status {
+		details, err := checkDatabase()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Println(details)
+		return 0
+	}
+
+	applied, err := client.Migrate(context.Background())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("Applied %d migrations; the database is at version %d.\n", applied, database.Latest())
+	return 0
+}
+
+// runBackup implements the backup subcommand: it backs up the session database to
+// config.BackupDir, or with -list lists the backups there. It returns the process exit code.
+func runBackup(args []string) int {
+	flags := flag.NewFlagSet("backup", flag.ExitOnError)
+	listOnly := flags.Bool("list", false, "list the backups instead of making one")
+	logFlags(flags)
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "usage: aemy backup [-list]")
+		return 2
+	}
+
+	if *listOnly {
+		paths, err := backup.List()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		for _, path := range paths {
+			fmt.Println(path)
+		}
+		return 0
+	}
+
+	manager, err := openManager()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer manager.Close()
+
+	path, err := manager.Backup(context.Background())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Backup failed:", err)
+		return 1
+	}
+	fmt.Println(path)
+	return 0
+}
+
+// runRestore implements the restore subcommand: it replaces the session database with a
+// backup, decrypting it with the backup passphrase if needed. The bot must be stopped.
+// It returns the process exit code.
+func runRestore(args []string) int {
+	if len(args) != 1 || strings.HasPrefix(args[0], "-") {
+		fmt.Fprintln(os.Stderr, "usage: aemy restore <backup>")
+		return 2
+	}
+
+	dialect, dsn := database.Settings()
+	manifest, err := backup.Restore(args[0], dialect, dsn)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Restore failed:", err)
+		return 1
+	}
+	fmt.Printf("Restored the backup from %s. The previous database was kept with the suffix \".before-restore\".\n",
+		manifest.Created.Local().Format(time.RFC1123))
+	return 0
+}
+
+// runVersion implements the version subcommand: it prints the bot's version and what it
+// was built from. It returns the process exit code.
+func runVersion(args []string) int {
+	fmt.Printf("aemy %s\n", version)
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		fmt.Printf("go        %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+		return 0
+	}
+	settings := map[string]string{}
+	for _, setting := range info.Settings {
+		settings[setting.Key] = setting.Value
+	}
+	if revision := settings["vcs.revision"]; revision != "" {
+		if settings["vcs.modified"] == "true" {
+			revision += " (modified)"
+		}
+		fmt.Printf("commit    %s\n", revision)
+	}
+	if built := settings["vcs.time"]; built != "" {
+		fmt.Printf("time      %s\n", built)
+	}
+	fmt.Printf("go        %s %s/%s\n", info.GoVersion, runtime.GOOS, runtime.GOARCH)
+	for _, dep := range info.Deps {
+		if dep.Path == "go.mau.fi/whatsmeow" {
+			fmt.Printf("whatsmeow %s\n", dep.Version)
+		}
+	}
+	return 0
+}
+
+// runReplay implements the replay subcommand and returns the process exit code:
+// 0 if every recording matches its golden file, 1 on mismatches and 2 on errors.
+func runReplay(args []string) int {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	update := flags.Bool("update", false, "rewrite golden files with the current output")
+	golden := flags.String("golden", replay.DefaultGoldenDir, "directory of the golden files")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: aemy replay [-update] [-golden dir] <recording>...")
+		return 2
+	}
+
+	code := 0
+	for _, path := range flags.Args() {
+		result, err := replay.Run(path, replay.Options{GoldenDir: *golden, Update: *update}, os.Stdout)
+		switch {
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			code = 2
+		case *update:
+			fmt.Printf("%s: wrote %d events to %s\n", path, len(result.Steps), result.GoldenPath)
+		case len(result.Mismatches) > 0:
+			fmt.Printf("%s: %d of %d events differ from %s\n", path, len(result.Mismatches), len(result.Steps), result.GoldenPath)
+			if code == 0 {
+				code = 1
+			}
+		default:
+			fmt.Printf("%s: %d events match\n", path, len(result.Steps))
+		}
+	}
+	return code
+}
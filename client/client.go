@@ -1,91 +1,160 @@
 // Package client handles the initialization, connection, and management of the WhatsApp client.
-// It is responsible for setting up the database, handling device sessions, and managing the
-// connection lifecycle, including QR code generation for new logins.
+// It is responsible for setting up the database, handling the device sessions of every bot
+// account, and managing the connection lifecycle, including QR code and pairing-code logins.
 package client
 
 import (
-	"aemy/handler"
+	"aemy/commands"
+	"aemy/config"
+	"aemy/database"
+	"aemy/prefs"
+	"aemy/replay"
+	"aemy/utils"
 	"context"
+	"database/sql"
 	"fmt"
-	"os"
 
-	_ "github.com/mattn/go-sqlite3" // SQLite3 driver for the database
-	"github.com/skip2/go-qrcode"
-	"go.mau.fi/whatsmeow"
 	"go.mau.fi/whatsmeow/store/sqlstore"
-	waLog "go.mau.fi/whatsmeow/util/log"
 )
 
-// WhatsAppClient is a globally accessible instance of the whatsmeow client.
-// It is initialized by the Init function and used throughout the application
-// to interact with the WhatsApp API.
-var WhatsAppClient *whatsmeow.Client
+// manager runs the bot's accounts once Init has succeeded.
+var manager *Manager
 
-// Init initializes the primary WhatsApp client.
-// This function performs the following steps:
-// 1. Sets up a logger for the client.
-// 2. Creates a new SQL-based store (using SQLite3) to manage session data.
-// 3. Fetches the first available device from the store or creates a new one.
-// 4. Initializes the whatsmeow client with the device and logger.
-// 5. Registers the main event handler to process incoming events.
-// 6. Connects to WhatsApp. If it's the first time, it generates a QR code
-//    for login. Otherwise, it attempts to reconnect using the saved session.
-func Init() {
-	log := waLog.Stdout("Client", "INFO", true)
-
-	// Create a container for the session data using SQLite3.
-	// The session data is stored in "session.db".
-	container, err := sqlstore.New(context.Background(), "sqlite3", "file:session.db?_foreign_keys=on", log)
+// Open opens the session store and the bot's own tables (see database.Settings) and
+// upgrades both to the current version.
+//
+// Returns:
+//   - *Manager: a manager for the accounts in the store, not started yet
+//   - error: if the database cannot be opened or upgraded
+func Open() (*Manager, error) {
+	log := utils.WALogger("Client")
+
+	// The session data is stored in SQLite ("session.db" by default) or PostgreSQL,
+	// together with the bot's own tables.
+	dialect, dsn := database.Settings()
+	db, err := database.Open(dialect, dsn)
 	if err != nil {
-		log.Errorf("DB error: %v", err)
-		return
+		return nil, fmt.Errorf("open database: %w", err)
 	}
-
-	// Get the first device from the store. If no device is found, a new one will be created.
-	device, err := container.GetFirstDevice(context.Background())
+	container, applied, err := upgrade(context.Background(), db, dialect)
 	if err != nil {
-		log.Errorf("Device error: %v", err)
-		return
+		db.Close()
+		return nil, err
+	}
+	if applied > 0 {
+		log.Infof("Applied %d database migrations (now at version %d)", applied, database.Latest())
 	}
 
-	// Initialize the whatsmeow client with the retrieved device and logger.
-	WhatsAppClient = whatsmeow.NewClient(device, log)
-	
-	// Register the global event handler from the handler package.
-	WhatsAppClient.AddEventHandler(func(evt interface{}) {
-		handler.EventHandler(evt, WhatsAppClient)
-	})
-
-	// Check if the client is already logged in by looking for a stored ID.
-	if WhatsAppClient.Store.ID == nil {
-		// If not logged in, get the QR channel and connect.
-		qrChan, _ := WhatsAppClient.GetQRChannel(context.Background())
-		err := WhatsAppClient.Connect()
-		if err != nil {
-			log.Errorf("Connect error: %v", err)
-			return
-		}
+	// Per-user and per-chat preferences (e.g. timezones) are kept in the same database.
+	prefs.Use(prefs.NewSQLStore(db))
 
-		// Listen on the QR channel for events.
-		for evt := range qrChan {
-			switch evt.Event {
-			case "code":
-				// A new QR code is available. Save it to a file.
-				qrcode.WriteFile(evt.Code, qrcode.Medium, 256, "qrcode.png")
-				fmt.Println("QR code saved to qrcode.png")
-			case "success", "timeout":
-				// Login was successful or the QR code timed out. Remove the QR code file.
-				os.Remove("qrcode.png")
-			}
-		}
-	} else {
-		// If already logged in, just connect.
-		err := WhatsAppClient.Connect()
+	// Optionally record incoming messages so they can be replayed with "aemy replay".
+	var recorder *replay.Recorder
+	if config.RecordEvents != "" {
+		recorder, err = replay.NewRecorder(config.RecordEvents, config.RecordRedact)
 		if err != nil {
-			log.Errorf("Connect error: %v", err)
-			return
+			log.Warnf("Recording disabled: %v", err)
 		}
-		// Clean up any old QR code file that might exist.
-		os.Remove("qrcode.png")
 	}
-}
\ No newline at end of file
+
+	m := NewManager(container, recorder)
+	m.db, m.dialect = db, dialect
+	return m, nil
+}
+
+// Migrate opens the database (see database.Settings) and upgrades the session store and
+// the bot's own tables to the current version, without starting anything.
+//
+// Returns:
+//   - int: the number of migrations of the bot's tables that were applied
+//   - error: if the database cannot be opened or upgraded
+func Migrate(ctx context.Context) (int, error) {
+	dialect, dsn := database.Settings()
+	db, err := database.Open(dialect, dsn)
+	if err != nil {
+		return 0, fmt.Errorf("open database: %w", err)
+	}
+	defer db.Close()
+
+	_, applied, err := upgrade(ctx, db, dialect)
+	return applied, err
+}
+
+// upgrade upgrades the whatsmeow session store and the bot's own tables in db.
+//
+// Returns:
+//   - *sqlstore.Container: the session store
+//   - int: the number of migrations of the bot's tables that were applied
+//   - error: if either upgrade fails
+func upgrade(ctx context.Context, db *sql.DB, dialect string) (*sqlstore.Container, int, error) {
+	container := sqlstore.NewWithDB(db, dialect, utils.WALogger("Database"))
+	if err := container.Upgrade(ctx); err != nil {
+		return nil, 0, fmt.Errorf("upgrade database: %w", err)
+	}
+	applied, err := database.Migrate(ctx, db, dialect)
+	if err != nil {
+		return nil, 0, fmt.Errorf("upgrade database: %w", err)
+	}
+	return container, applied, nil
+}
+
+// Init initializes the bot's WhatsApp clients.
+// This function performs the following steps:
+// 1. Opens the SQL store that keeps the sessions, see Open: SQLite or PostgreSQL, as set
+//    by config.DatabaseDialect and config.DatabaseURL or the AEMY_DATABASE_DIALECT and
+//    AEMY_DATABASE_URL environment variables (database.Settings).
+// 2. Loads every account (device) linked in the store.
+// 3. Creates a whatsmeow client per account and registers the main event handler.
+// 4. Connects the accounts. If there is none yet, it links a first account by QR code
+//    or pairing code (config.LoginMethod).
+// 5. Makes the accounts manageable by the owners through the account command.
+//
+// From then on the connections are supervised: failures are retried with backoff and a
+// logged-out session is linked again. Errors the bot cannot recover from are delivered on Fatal.
+//
+// Returns:
+//   - error: if the database cannot be opened or no account could be linked
+func Init() error {
+	m, err := Open()
+	if err != nil {
+		return err
+	}
+	if err := m.Start(context.Background()); err != nil {
+		m.Stop()
+		_ = m.Close()
+		return fmt.Errorf("login: %w", err)
+	}
+
+	manager = m
+	commands.Accounts = m
+	commands.Backup = m.Backup
+	return nil
+}
+
+// Fatal returns a channel that receives an error once every account has failed beyond
+// recovery, e.g. when another instance takes over the session. The bot should exit then.
+func Fatal() <-chan error {
+	if manager == nil {
+		return nil
+	}
+	return manager.Fatal()
+}
+
+// Disconnect disconnects every account.
+func Disconnect() {
+	if manager != nil {
+		manager.Stop()
+	}
+}
+
+// Close closes the databases and the recording. Call it after Disconnect, once nothing
+// uses the clients anymore.
+//
+// Returns:
+//   - error: if the database could not be closed cleanly
+func Close() error {
+	if manager == nil {
+		return nil
+	}
+	return manager.Close()
+}
@@ -0,0 +1,264 @@
+// Package client handles the initialization, connection, and management of the WhatsApp client.
+// This file, login.go, links a new session, either by QR code (shown in the terminal,
+// saved to qrcode.png and optionally served over HTTP) or by a pairing code entered on the phone.
+package client
+
+import (
+	"aemy/config"
+	"aemy/types"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/skip2/go-qrcode"
+	"go.mau.fi/whatsmeow"
+	waLog "go.mau.fi/whatsmeow/util/log"
+)
+
+// Login methods accepted by config.LoginMethod.
+const (
+	LoginQR   = "qr"
+	LoginCode = "code"
+)
+
+// pairClientName is the linked device name shown on the phone for pairing-code logins.
+// WhatsApp only accepts common "Browser (OS)" combinations.
+const pairClientName = "Chrome (Linux)"
+
+// CheckLogin validates the login configuration, so mistakes are reported before connecting.
+//
+// Returns:
+//   - error: if config.LoginMethod is unknown or a pairing-code login has no phone number
+func CheckLogin() error {
+	switch config.LoginMethod {
+	case LoginQR:
+		return nil
+	case LoginCode:
+		if strings.Trim(config.PairPhone, "+ -") == "" {
+			return errors.New("pairing-code login needs a phone number (config.PairPhone or -phone)")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown login method %q (want %q or %q)", config.LoginMethod, LoginQR, LoginCode)
+	}
+}
+
+// login links a new session on cli, which must not be connected yet. With a phone number
+// the session is linked by pairing code, otherwise by QR code. It returns once the phone
+// has confirmed the link or the login has failed.
+//
+// Parameters:
+//   - ctx: cancels the login
+//   - cli: the client, not yet connected
+//   - phone: the account's phone number for a pairing-code login, or "" for a QR code login
+//   - prompt: shows each QR code or the pairing code to the user; it must not block
+//
+// Returns:
+//   - error: if the login fails, times out or ctx is done
+func login(ctx context.Context, cli *whatsmeow.Client, phone string, prompt func(types.LoginPrompt)) error {
+	qrChan, err := cli.GetQRChannel(ctx)
+	if err != nil {
+		return err
+	}
+	if err := cli.Connect(); err != nil {
+		return err
+	}
+
+	paired := false
+	for evt := range qrChan {
+		switch evt.Event {
+		case whatsmeow.QRChannelEventCode:
+			if phone == "" {
+				prompt(types.LoginPrompt{QR: evt.Code})
+				continue
+			}
+			// The first QR event means the websocket is ready for pairing
+			if paired {
+				continue
+			}
+			paired = true
+			code, err := cli.PairPhone(ctx, phone, true, whatsmeow.PairClientChrome, pairClientName)
+			if err != nil {
+				cli.Disconnect()
+				return fmt.Errorf("request pairing code: %w", err)
+			}
+			prompt(types.LoginPrompt{PairCode: code})
+		case whatsmeow.QRChannelSuccess.Event:
+			return nil
+		case whatsmeow.QRChannelTimeout.Event:
+			cli.Disconnect()
+			return errors.New("login timed out")
+		case whatsmeow.QRChannelEventError:
+			cli.Disconnect()
+			return fmt.Errorf("login failed: %w", evt.Error)
+		default:
+			cli.Disconnect()
+			return fmt.Errorf("login failed: %s", evt.Event)
+		}
+	}
+
+	// The channel is closed without a result when ctx is done
+	cli.Disconnect()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return errors.New("login was interrupted")
+}
+
+// terminalLogin links a new session on cli with config.LoginMethod, printing the QR code
+// or pairing code in the terminal and serving the QR code on config.QRAddr if set.
+//
+// Parameters:
+//   - ctx: cancels the login
+//   - cli: the client, not yet connected
+//   - log: where progress is logged
+//
+// Returns:
+//   - error: if the configuration is invalid or the login fails
+func terminalLogin(ctx context.Context, cli *whatsmeow.Client, log waLog.Logger) error {
+	if err := CheckLogin(); err != nil {
+		return err
+	}
+
+	phone := ""
+	if config.LoginMethod == LoginCode {
+		phone = config.PairPhone
+	}
+
+	var server *qrServer
+	if config.LoginMethod == LoginQR && config.QRAddr != "" {
+		var err error
+		if server, err = startQRServer(config.QRAddr); err != nil {
+			log.Warnf("QR endpoint disabled: %v", err)
+		} else {
+			log.Infof("Serving the login QR code on http://%s/", server.addr)
+			defer server.Close()
+		}
+	}
+	defer os.Remove("qrcode.png")
+
+	err := login(ctx, cli, phone, func(p types.LoginPrompt) {
+		PrintLoginPrompt(p)
+		if p.QR != "" {
+			saveQR(p.QR, log)
+		}
+		if server != nil && p.QR != "" {
+			server.Set(p.QR)
+		}
+	})
+	if err == nil {
+		log.Infof("Login successful")
+	}
+	return err
+}
+
+// PrintLoginPrompt prints a QR code or pairing code to the terminal, with instructions.
+func PrintLoginPrompt(p types.LoginPrompt) {
+	if p.PairCode != "" {
+		fmt.Printf("\nPairing code: %s\nOn your phone, open WhatsApp > Linked devices > Link a device > Link with phone number instead, and enter the code.\n\n", p.PairCode)
+		return
+	}
+	qr, err := qrcode.New(p.QR, qrcode.Medium)
+	if err != nil {
+		fmt.Println("QR code error:", err)
+		return
+	}
+	fmt.Printf("\nScan this QR code with WhatsApp > Linked devices > Link a device:\n\n%s\n", qr.ToSmallString(false))
+}
+
+// saveQR saves a QR code to qrcode.png.
+func saveQR(code string, log waLog.Logger) {
+	if err := qrcode.WriteFile(code, qrcode.Medium, 256, "qrcode.png"); err != nil {
+		log.Warnf("Failed to save qrcode.png: %v", err)
+		return
+	}
+	log.Infof("QR code saved to qrcode.png")
+}
+
+// qrServer serves the current login QR code over HTTP, for headless servers where the
+// terminal is not at hand. It should only listen on trusted addresses: whoever scans the
+// code controls the bot account.
+type qrServer struct {
+	addr   string
+	server *http.Server
+
+	mu      sync.Mutex
+	code    string
+	version int
+}
+
+// startQRServer starts serving on addr. "/" is a page that refreshes itself and "/qr.png" is the image.
+func startQRServer(addr string) (*qrServer, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &qrServer{addr: listener.Addr().String()}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.servePage)
+	mux.HandleFunc("/qr.png", s.serveImage)
+	s.server = &http.Server{Addr: s.addr, Handler: mux}
+
+	go s.server.Serve(listener)
+	return s, nil
+}
+
+// Set replaces the QR code being served.
+func (s *qrServer) Set(code string) {
+	s.mu.Lock()
+	s.code = code
+	s.version++
+	s.mu.Unlock()
+}
+
+// Close stops the server.
+func (s *qrServer) Close() error {
+	return s.server.Close()
+}
+
+// current returns the QR code being served and how many codes were served before it.
+func (s *qrServer) current() (string, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.code, s.version
+}
+
+// servePage serves an HTML page showing the QR code. QR codes rotate every ~20 seconds,
+// so the page reloads itself.
+func (s *qrServer) servePage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+
+	body := "<p>Waiting for a QR code...</p>"
+	if code, version := s.current(); code != "" {
+		body = fmt.Sprintf(`<img src="/qr.png?v=%d" alt="WhatsApp login QR code" width="256" height="256">`, version)
+	}
+	fmt.Fprintf(w, `<!DOCTYPE html><html><head><meta http-equiv="refresh" content="5"><title>Aemy login</title></head><body style="text-align:center;font-family:sans-serif"><h1>Link Aemy</h1><p>WhatsApp &gt; Linked devices &gt; Link a device</p>%s</body></html>`, body)
+}
+
+// serveImage serves the QR code as a PNG image.
+func (s *qrServer) serveImage(w http.ResponseWriter, r *http.Request) {
+	code, _ := s.current()
+	if code == "" {
+		http.Error(w, "no QR code yet", http.StatusServiceUnavailable)
+		return
+	}
+	png, err := qrcode.Encode(code, qrcode.Medium, 256)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(png)
+}
@@ -0,0 +1,380 @@
+// Package client handles the initialization, connection, and management of the WhatsApp client.
+// This file, manager.go, runs one supervised client per account linked in the session store
+// and lets accounts be added and removed while the bot is running.
+package client
+
+import (
+	"aemy/backup"
+	"aemy/config"
+	"aemy/replay"
+	local "aemy/types"
+	"aemy/utils"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/store"
+	"go.mau.fi/whatsmeow/store/sqlstore"
+	waTypes "go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+// loginWait is how long RemoveAccount waits for an account to connect before logging it out.
+const loginWait = 15 * time.Second
+
+// Manager runs the bot on every WhatsApp account linked in the session store. Each
+// account has its own client and supervisor; events from all of them go to the shared
+// command handlers, tagged with the account they were received on (Messages.Account).
+// It implements types.AccountManager.
+type Manager struct {
+	container *sqlstore.Container
+	recorder  *replay.Recorder
+
+	// db and dialect are the session database, for backups. They are set by Open.
+	db      *sql.DB
+	dialect string
+
+	// stopBackups stops the scheduled backups started by Start.
+	stopBackups context.CancelFunc
+
+	mu       sync.Mutex
+	accounts []*supervisor
+	running  bool
+	fatal    chan error
+}
+
+// NewManager creates a manager for the accounts in container.
+//
+// Parameters:
+//   - container: the session store
+//   - recorder: records incoming messages of every account, or nil
+//
+// Returns:
+//   - *Manager: the manager, not started yet
+func NewManager(container *sqlstore.Container, recorder *replay.Recorder) *Manager {
+	return &Manager{
+		container: container,
+		recorder:  recorder,
+		fatal:     make(chan error, 1),
+	}
+}
+
+// Start starts every account in the session store. If there is none yet, a first
+// account is linked in the terminal with config.LoginMethod.
+//
+// Returns:
+//   - error: if the store cannot be read or the first account could not be linked
+func (m *Manager) Start(ctx context.Context) error {
+	devices, err := m.container.GetAllDevices(ctx)
+	if err != nil {
+		return fmt.Errorf("load accounts: %w", err)
+	}
+
+	m.mu.Lock()
+	m.running = true
+	if m.db != nil && config.BackupInterval > 0 {
+		var backupCtx context.Context
+		backupCtx, m.stopBackups = context.WithCancel(context.Background())
+		go backup.Schedule(backupCtx, m.db, m.dialect, config.BackupInterval)
+	}
+	m.mu.Unlock()
+
+	if len(devices) == 0 {
+		s := m.newSupervisor()
+		if err := s.start(ctx, m.container.NewDevice(), s.terminalLink); err != nil {
+			m.remove(s)
+			return err
+		}
+		return nil
+	}
+
+	for _, device := range devices {
+		utils.Log.Info().Str("account", device.ID.User).Msg("Starting account")
+		if err := m.newSupervisor().start(ctx, device, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stop disconnects every account and stops the scheduled backups.
+func (m *Manager) Stop() {
+	m.mu.Lock()
+	accounts := append([]*supervisor(nil), m.accounts...)
+	m.running = false
+	if m.stopBackups != nil {
+		m.stopBackups()
+		m.stopBackups = nil
+	}
+	m.mu.Unlock()
+
+	for _, s := range accounts {
+		if cli := s.stop(); cli != nil {
+			cli.Disconnect()
+		}
+	}
+}
+
+// Backup makes a backup of the session database, see backup.Create.
+//
+// Returns:
+//   - string: the path of the backup
+//   - error: if the database cannot be backed up
+func (m *Manager) Backup(ctx context.Context) (string, error) {
+	if m.db == nil {
+		return "", errors.New("no database")
+	}
+	return backup.Create(ctx, m.db, m.dialect)
+}
+
+// Close closes the recording and the database. The manager must be stopped (or never
+// started) first.
+//
+// Returns:
+//   - error: if the database could not be closed cleanly
+func (m *Manager) Close() error {
+	if m.recorder != nil {
+		if err := m.recorder.Close(); err != nil {
+			utils.Log.Warn().Err(err).Msg("Failed to close the recording")
+		}
+	}
+	return m.container.Close()
+}
+
+// Fatal returns a channel that receives an error once every account has failed beyond
+// recovery, e.g. because another instance took over the sessions. The bot should exit then.
+func (m *Manager) Fatal() <-chan error {
+	return m.fatal
+}
+
+// Accounts lists the running accounts, or the accounts in the session store if the
+// manager is not running (e.g. for the accounts subcommand).
+func (m *Manager) Accounts() []local.Account {
+	m.mu.Lock()
+	running, supervisors := m.running, append([]*supervisor(nil), m.accounts...)
+	m.mu.Unlock()
+
+	accounts := []local.Account{}
+	if running {
+		for _, s := range supervisors {
+			accounts = append(accounts, s.info())
+		}
+		return accounts
+	}
+
+	devices, err := m.container.GetAllDevices(context.Background())
+	if err != nil {
+		utils.Log.Warn().Err(err).Msg("Failed to list accounts")
+		return accounts
+	}
+	for _, device := range devices {
+		accounts = append(accounts, local.Account{JID: device.ID.ToNonAD(), Name: device.PushName, State: "stopped"})
+	}
+	return accounts
+}
+
+// AddAccount links a new account and, if the manager is running, keeps it connected.
+// See types.AccountManager.
+func (m *Manager) AddAccount(ctx context.Context, phone string, prompt func(local.LoginPrompt)) (local.Account, error) {
+	return m.link(ctx, func(ctx context.Context, cli *whatsmeow.Client) error {
+		return login(ctx, cli, phone, prompt)
+	})
+}
+
+// Login links a new account in the terminal with config.LoginMethod, like the first
+// start of the bot does (see terminalLogin). It is meant for the login subcommand.
+//
+// Returns:
+//   - local.Account: the linked account
+//   - error: if the login configuration is invalid or the login fails
+func (m *Manager) Login(ctx context.Context) (local.Account, error) {
+	return m.link(ctx, nil)
+}
+
+// link links a new account with link, or in the terminal if link is nil. If the manager
+// is not running, the account is disconnected again once the first login has finished;
+// the bot picks it up on its next start.
+func (m *Manager) link(ctx context.Context, link linkFunc) (local.Account, error) {
+	s := m.newSupervisor()
+	if link == nil {
+		link = s.terminalLink
+	}
+	if err := s.start(ctx, m.container.NewDevice(), link); err != nil {
+		m.remove(s)
+		return local.Account{}, err
+	}
+
+	account := s.info()
+	utils.Log.Info().Str("account", account.JID.User).Msg("Account added")
+
+	m.mu.Lock()
+	running := m.running
+	m.mu.Unlock()
+	if !running {
+		// Linked from the command line: let the first login finish
+		m.remove(s)
+		cli := s.stop()
+		cli.WaitForConnection(loginWait)
+		cli.Disconnect()
+	}
+	return account, nil
+}
+
+// Send sends a text message from a stopped account, connecting it just long enough to
+// deliver the message. It is meant for scripts, through the send subcommand.
+//
+// Parameters:
+//   - ctx: cancels sending
+//   - number: the phone number of the account to send from
+//   - to: the recipient, a user or group JID
+//   - text: the message text
+//
+// Returns:
+//   - string: the ID of the sent message
+//   - error: if the account does not exist, cannot connect or the message is not sent
+func (m *Manager) Send(ctx context.Context, number string, to waTypes.JID, text string) (string, error) {
+	device, err := m.device(ctx, number)
+	if err != nil {
+		return "", err
+	}
+	cli := whatsmeow.NewClient(device, utils.AccountWALogger("Client", number))
+	if err := cli.Connect(); err != nil {
+		return "", fmt.Errorf("connect: %w", err)
+	}
+	defer cli.Disconnect()
+	if !cli.WaitForConnection(loginWait) {
+		return "", errors.New("WhatsApp could not be reached")
+	}
+
+	resp, err := cli.SendMessage(ctx, to, &waE2E.Message{Conversation: proto.String(text)})
+	if err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+// RemoveAccount logs an account out, unlinks it from the phone and deletes its session.
+// The last running account cannot be removed. See types.AccountManager.
+func (m *Manager) RemoveAccount(ctx context.Context, number string) error {
+	m.mu.Lock()
+	var target *supervisor
+	for _, s := range m.accounts {
+		if s.number() == number {
+			target = s
+		}
+	}
+	running := len(m.accounts)
+	m.mu.Unlock()
+
+	if target != nil {
+		if running == 1 {
+			return errors.New("the last account cannot be removed")
+		}
+		m.remove(target)
+		cli := target.stop()
+		utils.Log.Info().Str("account", number).Msg("Account removed")
+		return logout(ctx, cli)
+	}
+
+	// Not running: connect just long enough to log out
+	device, err := m.device(ctx, number)
+	if err != nil {
+		return err
+	}
+	cli := whatsmeow.NewClient(device, utils.AccountWALogger("Client", number))
+	if err := cli.Connect(); err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	return logout(ctx, cli)
+}
+
+// device returns the stored device of the account with the given phone number.
+func (m *Manager) device(ctx context.Context, number string) (*store.Device, error) {
+	devices, err := m.container.GetAllDevices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, device := range devices {
+		if device.ID.User == number {
+			return device, nil
+		}
+	}
+	return nil, fmt.Errorf("no account %s", number)
+}
+
+// messenger returns the client of a connected account other than except, e.g. to reach
+// the owners while except is logged out, or nil if there is none.
+func (m *Manager) messenger(except *supervisor) *utils.WhatsmeowClient {
+	m.mu.Lock()
+	accounts := append([]*supervisor(nil), m.accounts...)
+	m.mu.Unlock()
+
+	for _, s := range accounts {
+		if s == except {
+			continue
+		}
+		s.mu.Lock()
+		state, messenger := s.state, s.messenger
+		s.mu.Unlock()
+		if state == stateConnected && messenger != nil {
+			return messenger
+		}
+	}
+	return nil
+}
+
+// newSupervisor creates a supervisor and adds it to the running accounts.
+func (m *Manager) newSupervisor() *supervisor {
+	s := &supervisor{manager: m}
+	m.mu.Lock()
+	m.accounts = append(m.accounts, s)
+	m.mu.Unlock()
+	return s
+}
+
+// remove removes s from the running accounts.
+func (m *Manager) remove(s *supervisor) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, other := range m.accounts {
+		if other == s {
+			m.accounts = append(m.accounts[:i], m.accounts[i+1:]...)
+			break
+		}
+	}
+	return len(m.accounts)
+}
+
+// failed stops an account that failed beyond recovery. When no account is left, err is
+// reported on Fatal.
+func (m *Manager) failed(s *supervisor, err error) {
+	if cli := s.stop(); cli != nil {
+		cli.Disconnect()
+	}
+	if m.remove(s) == 0 {
+		select {
+		case m.fatal <- err:
+		default:
+		}
+	}
+}
+
+// logout unlinks cli from the phone and deletes its session. If WhatsApp cannot be
+// reached, the session is deleted locally anyway.
+func logout(ctx context.Context, cli *whatsmeow.Client) error {
+	if cli.WaitForConnection(loginWait) {
+		if err := cli.Logout(ctx); err == nil {
+			return nil
+		}
+	}
+	cli.Disconnect()
+	if err := cli.Store.Delete(ctx); err != nil {
+		return fmt.Errorf("delete session: %w", err)
+	}
+	return errors.New("WhatsApp could not be reached; the session was deleted here but may still be listed under Linked devices on the phone")
+}
@@ -0,0 +1,407 @@
+// Package client handles the initialization, connection, and management of the WhatsApp client.
+// This file, supervisor.go, watches the connection of one account: it logs state transitions,
+// reconnects with backoff, links a new session after a logout, waits out temporary bans,
+// tells the owners what happened once the bot is back online and reports unrecoverable errors.
+package client
+
+import (
+	"aemy/config"
+	"aemy/handler"
+	"aemy/i18n"
+	"aemy/outbox"
+	local "aemy/types"
+	"aemy/utils"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/store"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	waLog "go.mau.fi/whatsmeow/util/log"
+	"google.golang.org/protobuf/proto"
+)
+
+// Connection states logged by the supervisor.
+const (
+	stateConnecting   = "connecting"
+	stateConnected    = "connected"
+	stateDisconnected = "disconnected"
+	statePairing      = "pairing"
+	stateLoggedOut    = "logged out"
+	stateBanned       = "temporarily banned"
+	stateFailed       = "failed"
+)
+
+const (
+	// minBackoff and maxBackoff bound the delay between reconnection attempts.
+	minBackoff = 2 * time.Second
+	maxBackoff = 5 * time.Minute
+
+	// notifyDowntime is how long the bot must have been offline before owners are told
+	// about it. Shorter drops happen routinely and are only logged.
+	notifyDowntime = time.Minute
+)
+
+// notice is a message for the owners, sent once the bot is connected again.
+type notice struct {
+	key  string
+	vars []any
+}
+
+// linkFunc links a new session on a client that is not connected yet.
+type linkFunc func(ctx context.Context, cli *whatsmeow.Client) error
+
+// supervisor owns the WhatsApp client of one account and keeps it connected.
+type supervisor struct {
+	manager *Manager
+
+	mu        sync.Mutex
+	client    *whatsmeow.Client
+	messenger *utils.WhatsmeowClient
+	log       waLog.Logger
+	phone     string
+	state     string
+	attempts  int
+	downSince time.Time
+	notices   []notice
+	retry     *time.Timer
+	stopped   bool
+}
+
+// start creates a client for device and connects it, linking a new session with link
+// first if the device has none. Connection errors are retried in the background; only
+// failures to link a session are returned.
+func (s *supervisor) start(ctx context.Context, device *store.Device, link linkFunc) error {
+	cli := s.attach(device)
+
+	if cli.Store.ID == nil {
+		s.setState(statePairing)
+		if err := link(ctx, cli); err != nil {
+			s.setState(stateFailed)
+			return err
+		}
+		return nil
+	}
+
+	s.setState(stateConnecting)
+	if err := cli.Connect(); err != nil {
+		s.reconnect(err.Error())
+	}
+	return nil
+}
+
+// terminalLink links a new session interactively in the terminal, see terminalLogin.
+func (s *supervisor) terminalLink(ctx context.Context, cli *whatsmeow.Client) error {
+	return terminalLogin(ctx, cli, s.logger())
+}
+
+// attach creates a client for device, registers the event handlers and makes it the
+// current client of the account.
+func (s *supervisor) attach(device *store.Device) *whatsmeow.Client {
+	account := "new"
+	if device.ID != nil {
+		account = device.ID.User
+	}
+	log := utils.AccountWALogger("Client", account)
+	cli := whatsmeow.NewClient(device, log)
+
+	// Handlers talk to WhatsApp through the types.Client adapter.
+	messenger := utils.NewWhatsmeowClient(cli)
+
+	cli.AddEventHandler(func(evt interface{}) {
+		if msg, ok := evt.(*events.Message); ok && s.manager.recorder != nil {
+			if err := s.manager.recorder.Record(msg, messenger.OwnID()); err != nil {
+				log.Warnf("Failed to record event: %v", err)
+			}
+		}
+		s.handle(cli, evt)
+		handler.EventHandler(evt, messenger)
+	})
+
+	s.mu.Lock()
+	previous := s.messenger
+	s.client, s.messenger, s.log = cli, messenger, log
+	if device.ID != nil {
+		s.phone = device.ID.User
+	}
+	s.mu.Unlock()
+
+	// Messages still queued for a replaced client cannot be sent anymore
+	if previous != nil {
+		previous.Close()
+	}
+	return cli
+}
+
+// logger returns the logger of the current client.
+func (s *supervisor) logger() waLog.Logger {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.log
+}
+
+// number returns the phone number of the account, or "" while its first session is
+// being linked. After a logout it is still the number of the old session.
+func (s *supervisor) number() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client != nil && s.client.Store.ID != nil {
+		s.phone = s.client.Store.ID.User
+	}
+	return s.phone
+}
+
+// info describes the account for the AccountManager interface.
+func (s *supervisor) info() local.Account {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	account := local.Account{State: s.state}
+	if s.client != nil && s.client.Store.ID != nil {
+		account.JID = s.client.Store.ID.ToNonAD()
+		account.Name = s.client.Store.PushName
+	}
+	return account
+}
+
+// stop stops supervising the account and its outgoing queue. Events arriving afterwards,
+// such as the logout of a removed account, are ignored. The caller disconnects the client.
+func (s *supervisor) stop() *whatsmeow.Client {
+	s.mu.Lock()
+	s.stopped = true
+	if s.retry != nil {
+		s.retry.Stop()
+		s.retry = nil
+	}
+	cli, messenger := s.client, s.messenger
+	s.mu.Unlock()
+
+	if messenger != nil {
+		messenger.Close()
+	}
+	return cli
+}
+
+// handle reacts to the connection events of cli. It must not block, as whatsmeow
+// delivers events one at a time.
+func (s *supervisor) handle(cli *whatsmeow.Client, evt interface{}) {
+	s.mu.Lock()
+	stopped := s.stopped || cli != s.client
+	s.mu.Unlock()
+	if stopped {
+		return
+	}
+
+	log := s.logger()
+	switch evt := evt.(type) {
+	case *events.Connected:
+		s.connected()
+	case *events.Disconnected:
+		s.disconnected()
+		log.Warnf("Disconnected, whatsmeow is reconnecting automatically")
+	case *events.KeepAliveTimeout:
+		log.Warnf("Keepalive timed out %d times in a row", evt.ErrorCount)
+	case *events.KeepAliveRestored:
+		log.Infof("Keepalive restored")
+	case *events.StreamReplaced:
+		s.fail(errors.New("another instance connected with the same session (stream replaced)"))
+	case *events.ClientOutdated:
+		s.fail(errors.New("WhatsApp rejected the client version; update whatsmeow"))
+	case *events.LoggedOut:
+		s.disconnected()
+		s.setState(stateLoggedOut)
+		log.Warnf("Logged out (%v), linking a new session", evt.Reason)
+		s.queue("connection.relinked", "reason", evt.Reason.String())
+		go s.relink()
+	case *events.TemporaryBan:
+		s.disconnected()
+		s.setState(stateBanned)
+		log.Errorf("%v", evt)
+		s.queue("connection.banned", "reason", evt.Code.String(), "duration", evt.Expire.String())
+		s.retryAfter(evt.Expire+minBackoff, "ban expired")
+	case *events.ConnectFailure:
+		s.disconnected()
+		s.reconnect(fmt.Sprintf("connect failure %d: %s", int(evt.Reason), evt.Message))
+	case *events.CATRefreshError:
+		s.disconnected()
+		s.reconnect(fmt.Sprintf("CAT refresh failed: %v", evt.Error))
+	case *events.StreamError:
+		log.Warnf("Stream error %s", evt.Code)
+	}
+}
+
+// setState records a connection state transition.
+func (s *supervisor) setState(state string) {
+	s.mu.Lock()
+	old := s.state
+	s.state = state
+	s.mu.Unlock()
+
+	if old != state {
+		utils.Log.Info().Str("account", s.number()).Str("from", old).Str("to", state).Msg("Connection state changed")
+	}
+}
+
+// connected resets the backoff and sends the owners any pending notices.
+func (s *supervisor) connected() {
+	s.setState(stateConnected)
+
+	s.mu.Lock()
+	s.attempts = 0
+	if s.retry != nil {
+		s.retry.Stop()
+		s.retry = nil
+	}
+	if !s.downSince.IsZero() {
+		if downtime := time.Since(s.downSince); downtime >= notifyDowntime && len(s.notices) == 0 {
+			s.notices = append(s.notices, notice{key: "connection.restored", vars: []any{"duration", downtime.Round(time.Second).String()}})
+		}
+		s.downSince = time.Time{}
+	}
+	notices, messenger, log := s.notices, s.messenger, s.log
+	s.notices = nil
+	s.mu.Unlock()
+
+	if len(notices) > 0 {
+		// Notices are not urgent, so they give way to the replies to commands
+		ctx := outbox.WithPriority(context.Background(), outbox.Low)
+		go notifyOwners(ctx, messenger, config.For(messenger.OwnID().User).Owners, notices, log)
+	}
+}
+
+// disconnected remembers when the bot went offline.
+func (s *supervisor) disconnected() {
+	s.setState(stateDisconnected)
+	s.mu.Lock()
+	if s.downSince.IsZero() {
+		s.downSince = time.Now()
+	}
+	s.mu.Unlock()
+}
+
+// queue adds a notice for the owners, sent once the bot is connected again.
+func (s *supervisor) queue(key string, vars ...any) {
+	s.mu.Lock()
+	s.notices = append(s.notices, notice{key: key, vars: vars})
+	s.mu.Unlock()
+}
+
+// reconnect schedules the next connection attempt with exponential backoff, or gives up
+// after config.MaxReconnectAttempts failures in a row.
+func (s *supervisor) reconnect(reason string) {
+	s.mu.Lock()
+	s.attempts++
+	attempts := s.attempts
+	s.mu.Unlock()
+
+	if config.MaxReconnectAttempts > 0 && attempts > config.MaxReconnectAttempts {
+		s.fail(fmt.Errorf("giving up after %d failed connection attempts: %s", attempts-1, reason))
+		return
+	}
+	s.retryAfter(backoff(attempts), reason)
+}
+
+// retryAfter connects the current client again after delay.
+func (s *supervisor) retryAfter(delay time.Duration, reason string) {
+	s.logger().Warnf("Reconnecting in %v (%s)", delay.Round(time.Second), reason)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return
+	}
+	if s.retry != nil {
+		s.retry.Stop()
+	}
+	s.retry = time.AfterFunc(delay, func() {
+		s.mu.Lock()
+		cli, stopped := s.client, s.stopped
+		s.retry = nil
+		s.mu.Unlock()
+		if stopped {
+			return
+		}
+
+		s.setState(stateConnecting)
+		cli.Disconnect()
+		if err := cli.Connect(); err != nil {
+			s.reconnect(err.Error())
+		}
+	})
+}
+
+// relink links a new session after the old one was logged out. whatsmeow has already
+// deleted the old device, so a fresh one is created and paired by code with the number
+// of the account; see relinkLink.
+func (s *supervisor) relink() {
+	phone := s.number()
+	s.mu.Lock()
+	old := s.client
+	s.mu.Unlock()
+	old.Disconnect()
+
+	link := s.terminalLink
+	if phone != "" {
+		link = s.relinkLink(phone)
+	}
+	if err := s.start(context.Background(), s.manager.container.NewDevice(), link); err != nil {
+		s.fail(fmt.Errorf("link a new session after logout: %w", err))
+	}
+}
+
+// relinkLink links a new session for phone by pairing code. The logged out account cannot
+// send messages, so the code goes to its owners through another connected account, or
+// to the terminal if there is none.
+func (s *supervisor) relinkLink(phone string) linkFunc {
+	return func(ctx context.Context, cli *whatsmeow.Client) error {
+		return login(ctx, cli, phone, func(p local.LoginPrompt) {
+			messenger := s.manager.messenger(s)
+			if messenger == nil {
+				s.logger().Warnf("No other account is connected to send the pairing code to the owners")
+				PrintLoginPrompt(p)
+				return
+			}
+			n := notice{key: "connection.relink_code", vars: []any{"phone", phone, "code", p.PairCode}}
+			go notifyOwners(context.Background(), messenger, config.For(phone).Owners, []notice{n}, s.logger())
+		})
+	}
+}
+
+// fail reports an unrecoverable error and stops the account.
+func (s *supervisor) fail(err error) {
+	s.setState(stateFailed)
+	s.logger().Errorf("Unrecoverable connection error: %v", err)
+	s.manager.failed(s, err)
+}
+
+// backoff returns the delay before the given reconnection attempt: doubling from
+// minBackoff up to maxBackoff, with up to 20% jitter so that restarts do not synchronize.
+func backoff(attempt int) time.Duration {
+	delay := maxBackoff
+	if attempt < 16 {
+		delay = min(minBackoff<<(attempt-1), maxBackoff)
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay)/5+1))
+}
+
+// notifyOwners sends every notice to each of owners from messenger, in their language,
+// with the priority of ctx (see outbox.WithPriority).
+func notifyOwners(ctx context.Context, messenger *utils.WhatsmeowClient, owners []string, notices []notice, log waLog.Logger) {
+	for _, owner := range owners {
+		jid := types.NewJID(owner, types.DefaultUserServer)
+		lang := i18n.For(jid, jid)
+		for _, n := range notices {
+			_, err := messenger.SendMessage(ctx, jid, &waE2E.Message{
+				Conversation: proto.String(i18n.T(lang, n.key, n.vars...)),
+			})
+			if err != nil {
+				log.Warnf("Failed to notify owner %s: %v", owner, err)
+			}
+		}
+	}
+}
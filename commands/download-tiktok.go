@@ -7,10 +7,8 @@ import (
 	"aemy/utils"
 	"context"
 	"encoding/json"
-	"fmt"
 	"strings"
 
-	"go.mau.fi/whatsmeow"
 	"go.mau.fi/whatsmeow/types/events"
 )
 
@@ -23,61 +21,85 @@ func NewTiktokHandler() *TiktokHandler {
 }
 
 // Handle implements the CommandHandler interface for the 'tiktok' command.
-func (h *TiktokHandler) Handle(ctx context.Context, client *whatsmeow.Client, m types.Messages, evt *events.Message) error {
-	url := strings.TrimSpace(m.Text)
+// Invoked as 'tiktokmp3' or with the --audio flag, only the music track is sent.
+func (h *TiktokHandler) Handle(ctx context.Context, client types.Client, m types.Messages, evt *events.Message) error {
+	audio := tiktokAudioCommands[strings.ToLower(m.Command)]
+	url := ""
+	for _, arg := range m.Args {
+		if arg == "--audio" {
+			audio = true
+			continue
+		}
+		if url == "" {
+			url = arg
+		}
+	}
 	if url == "" {
-		m.Reply("Please send a TikTok link first.")
+		m.Reply(m.T("tiktok.no_link"))
 		return nil // Return nil as this is a user input error, not a system error
 	}
 	if !utils.TiktokRegex.MatchString(url) {
-		m.Reply("Invalid link or not a TikTok link.")
+		m.Reply(m.T("tiktok.invalid_link"))
 		return nil // Return nil as this is a user input error, not a system error
 	}
 
 	res, err := utils.SeaaveyAPIs("downloader/tiktok", map[string]string{"url": url})
 	if err != nil || len(res.Body) == 0 {
-		m.Reply("Feature error or server is down.")
+		m.Reply(m.T("error.feature_down"))
 		return err // Return the error to indicate a system issue
 	}
 
 	var data types.TiktokResponse
 	if err := json.Unmarshal(res.Body, &data); err != nil || data.Status != 200 {
-		m.Reply("Failed to get data from server.")
+		m.Reply(m.T("error.server_data"))
 		return err // Return the error to indicate a system issue
 	}
+	utils.StoreResponse(res)
 
-	if len(data.Data.Images) > 0 {
-		for i, img := range data.Data.Images {
-			caption := ""
-			if i == 0 {
-				caption = data.Data.Title
-			}
-			_, err := m.SendImage(img.URL, types.Options{
-				Caption: caption,
-			})
-			if err != nil {
-				m.Reply(fmt.Sprintf("Failed to send image: %v", err))
-				// Continue sending other images even if one fails
-			}
+	if audio {
+		if data.Data.Music.PlayURL == "" {
+			m.Reply(m.T("tiktok.no_audio"))
+			return nil
+		}
+		_, err := m.SendAudio(types.FromURL(data.Data.Music.PlayURL), types.Options{})
+		if err != nil {
+			m.Reply(m.T("tiktok.audio_failed"))
+			return err // Return the error to indicate a system issue
+		}
+	} else if len(data.Data.Images) > 0 {
+		urls := make([]string, 0, len(data.Data.Images))
+		for _, img := range data.Data.Images {
+			urls = append(urls, img.URL)
+		}
+		if err := m.SendAlbum(types.FromURLs(urls), types.Options{Caption: data.Data.Title}); err != nil {
+			return err // SendAlbum already told the user which images failed
 		}
 	} else if data.Data.Video != nil && data.Data.Video.NoWatermark != "" {
-		_, err := m.SendVideo(data.Data.Video.NoWatermark, types.Options{
+		_, err := m.SendVideo(types.FromURL(data.Data.Video.NoWatermark), types.Options{
 			Caption: data.Data.Title,
 		})
 		if err != nil {
-			m.Reply("Failed to send video.")
+			m.Reply(m.T("tiktok.video_failed"))
 			return err // Return the error to indicate a system issue
 		}
 	} else {
-		m.Reply("No media to send.")
+		m.Reply(m.T("error.no_media"))
 		// Not an error, just no media found
 	}
 
 	return nil
 }
 
+// tiktokAudioCommands are the aliases that send the music track instead of the video.
+var tiktokAudioCommands = map[string]bool{
+	"tiktokmp3":   true,
+	"ttmp3":       true,
+	"tiktokaudio": true,
+}
+
 // init function for automatic registration
 func init() {
 	handler := NewTiktokHandler()
 	MustRegister([]string{"tiktok", "ttdl", "tiktokdl", "tiktokslide"}, handler, "downloader")
+	MustRegister([]string{"tiktokmp3", "ttmp3", "tiktokaudio"}, handler, "downloader")
 }
\ No newline at end of file
@@ -3,6 +3,7 @@
 package commands
 
 import (
+	"aemy/outbox"
 	"aemy/types"
 	"bufio"
 	"context"
@@ -12,7 +13,6 @@ import (
 	"strings"
 	"time"
 
-	"go.mau.fi/whatsmeow"
 	"go.mau.fi/whatsmeow/types/events"
 )
 
@@ -25,7 +25,7 @@ func NewStatsHandler() *StatsHandler {
 }
 
 // Handle implements the CommandHandler interface for the 'stats' command.
-func (h *StatsHandler) Handle(ctx context.Context, client *whatsmeow.Client, m types.Messages, evt *events.Message) error {
+func (h *StatsHandler) Handle(ctx context.Context, client types.Client, m types.Messages, evt *events.Message) error {
 	// getCPUModel retrieves the CPU model name from /proc/cpuinfo.
 	// This is specific to Linux systems.
 	getCPUModel := func() string {
@@ -56,46 +56,35 @@ func (h *StatsHandler) Handle(ctx context.Context, client *whatsmeow.Client, m t
 	runtime.ReadMemStats(&mem)
 	cpuModel := getCPUModel()
 
-	infoMsg := fmt.Sprintf(`*Server Info*
-
-• Hostname: %s
-• OS: %s
-• Arch: %s
-• Go Version: %s
-• CPU: %s
-• CPU Core: %d
-• Uptime: %s
-
-*Memory Usage*
-
-• RAM Usage: %.2f MB
-• Total Allocated: %.2f MB
-• System Memory: %.2f MB
-• Heap Allocated: %.2f MB
-• Mallocs: %d
-• Frees: %d
-
-*Goroutine & GC*
+	infoMsg := m.T("stats.info",
+		"host", host,
+		"os", runtime.GOOS,
+		"arch", runtime.GOARCH,
+		"go", runtime.Version(),
+		"cpu", cpuModel,
+		"cores", runtime.NumCPU(),
+		"uptime", uptime.Truncate(time.Second).String(),
+		"alloc", fmt.Sprintf("%.2f", float64(mem.Alloc)/1024/1024),
+		"total_alloc", fmt.Sprintf("%.2f", float64(mem.TotalAlloc)/1024/1024),
+		"sys", fmt.Sprintf("%.2f", float64(mem.Sys)/1024/1024),
+		"heap", fmt.Sprintf("%.2f", float64(mem.HeapAlloc)/1024/1024),
+		"mallocs", mem.Mallocs,
+		"frees", mem.Frees,
+		"goroutines", runtime.NumGoroutine(),
+		"gc", mem.NumGC,
+		"last_gc", time.Unix(0, int64(mem.LastGC)).In(m.TimeZone).Format("2006-01-02 15:04:05 MST"),
+	)
 
-• Goroutines: %d
-• GC Count: %d
-• Last GC: %s`,
-		host,
-		runtime.GOOS,
-		runtime.GOARCH,
-		runtime.Version(),
-		cpuModel,
-		runtime.NumCPU(),
-		uptime.Truncate(time.Second).String(),
-		float64(mem.Alloc)/1024/1024,
-		float64(mem.TotalAlloc)/1024/1024,
-		float64(mem.Sys)/1024/1024,
-		float64(mem.HeapAlloc)/1024/1024,
-		mem.Mallocs,
-		mem.Frees,
-		runtime.NumGoroutine(),
-		mem.NumGC,
-		time.Unix(0, int64(mem.LastGC)).Format("2006-01-02 15:04:05"),
+	// Metrics of the outgoing queues of all accounts
+	outgoing := outbox.Totals()
+	infoMsg += m.T("stats.outbox",
+		"sent", outgoing.Sent,
+		"failed", outgoing.Failed,
+		"retried", outgoing.Retried,
+		"dropped", outgoing.Cancelled,
+		"pending", outgoing.Pending,
+		"avg_wait", outgoing.AverageWait().Round(time.Millisecond).String(),
+		"max_wait", outgoing.MaxWait.Round(time.Millisecond).String(),
 	)
 	_ = m.Reply(infoMsg)
 	return nil
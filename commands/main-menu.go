@@ -9,7 +9,6 @@ import (
 	"sort"
 	"time"
 
-	"go.mau.fi/whatsmeow"
 	"go.mau.fi/whatsmeow/proto/waE2E"
 	"go.mau.fi/whatsmeow/types/events"
 	"google.golang.org/protobuf/proto"
@@ -21,18 +20,15 @@ func NewMenuHandler() *MenuHandler {
 	return &MenuHandler{}
 }
 
-func (h *MenuHandler) Handle(ctx context.Context, client *whatsmeow.Client, m types.Messages, evt *events.Message) error {
-	// Ambil waktu server sekarang
-	currentTime := time.Now().Format("02-Jan-2006 15:04:05")
+func (h *MenuHandler) Handle(ctx context.Context, client types.Client, m types.Messages, evt *events.Message) error {
+	// Current time in the sender's timezone
+	currentTime := time.Now().In(m.TimeZone).Format("02-Jan-2006 15:04:05 MST")
 	hostname, _ := os.Hostname()
 
 	uptime := time.Since(startTime).Round(time.Second)
 
-	// Buat header info server
-	txt := "*Server Info*\n"
-	txt += fmt.Sprintf("• Hostname: %s\n", hostname)
-	txt += fmt.Sprintf("• Time: %s\n", currentTime)
-	txt += fmt.Sprintf("• Uptime: %s\n\n", uptime)
+	// Server info header
+	txt := m.T("menu.server", "host", hostname, "time", currentTime, "uptime", uptime)
 
 	// Get all registered commands grouped by category
 	commandsByCategory := ByCategory()
@@ -44,7 +40,12 @@ func (h *MenuHandler) Handle(ctx context.Context, client *whatsmeow.Client, m ty
 
 	for _, category := range categories {
 		commands := commandsByCategory[category]
-		txt += fmt.Sprintf("*%s:*\n", utils.TitleCaser(category))
+		// Categories without a translation are shown by their registered name
+		title := m.T("menu.category." + category)
+		if title == "menu.category."+category {
+			title = utils.TitleCaser(category)
+		}
+		txt += fmt.Sprintf("*%s:*\n", title)
 
 		commandNames := make([]string, 0, len(commands))
 		for name := range commands {
@@ -68,8 +69,8 @@ func (h *MenuHandler) Handle(ctx context.Context, client *whatsmeow.Client, m ty
 		Participant:   proto.String(m.Sender.String()),
 		QuotedMessage: m.Message,
 		ExternalAdReply: &waE2E.ContextInfo_ExternalAdReplyInfo{
-			Title: proto.String(fmt.Sprintf("Hello, %s", utils.Ucapan())),
-			Body: proto.String("Hello Everyone, I Am Seaavey Bot"),
+			Title: proto.String(m.T("menu.hello", "greeting", utils.Ucapan(m.Lang, m.TimeZone))),
+			Body: proto.String(m.T("menu.intro")),
 			MediaType: (*waE2E.ContextInfo_ExternalAdReplyInfo_MediaType)(proto.Int32(1)),
 			Thumbnail: thumbnail,
 			SourceURL: proto.String("https://github.com/seaavey/Aemy-go"),
@@ -82,7 +83,7 @@ func (h *MenuHandler) Handle(ctx context.Context, client *whatsmeow.Client, m ty
 var startTime time.Time
 
 func init() {
-	startTime = time.Now() // buat hitung uptime
+	startTime = time.Now() // for the uptime shown in the menu
 	handler := NewMenuHandler()
 	MustRegister([]string{"menu", "help"}, handler, "main")
 }
@@ -0,0 +1,197 @@
+// Package commands implements the logic for specific bot commands.
+// This file handles the 'account' command, letting owners list, add and remove the
+// WhatsApp accounts the bot runs on.
+package commands
+
+import (
+	"aemy/types"
+	"aemy/utils"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/skip2/go-qrcode"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// Accounts manages the bot's accounts. It is set by client.Init and nil when the
+// commands run without WhatsApp (console, replay).
+var Accounts types.AccountManager
+
+// Go runs f in the background, for work that outlives a command's Handle. The handler
+// package replaces it so that the bot waits for f on shutdown like for a running
+// command. It returns false if the bot is shutting down and f was not started.
+var Go = func(f func()) bool {
+	go f()
+	return true
+}
+
+const (
+	// qrLinkTimeout is how long a QR code sent to the chat stays valid. Only the first code
+	// is sent, to avoid flooding the chat with codes that rotate every 20 seconds.
+	qrLinkTimeout = time.Minute
+
+	// codeLinkTimeout is how long a pairing code can be entered.
+	codeLinkTimeout = 3 * time.Minute
+)
+
+// AccountHandler handles the 'account' command.
+type AccountHandler struct{}
+
+// NewAccountHandler creates a new instance of AccountHandler.
+func NewAccountHandler() *AccountHandler {
+	return &AccountHandler{}
+}
+
+// Handle implements the CommandHandler interface for the 'account' command.
+//
+// Usage:
+//   - account                   list the accounts and their connection state
+//   - account add [phone]       link another account by QR code, or by pairing code with a phone number
+//   - account remove <phone>    unlink an account and delete its session
+//
+// Codes for linking are sent to the sender's private chat. Owners of a single account
+// (config.Accounts) can only remove that account; global owners can remove any.
+func (h *AccountHandler) Handle(ctx context.Context, client types.Client, m types.Messages, evt *events.Message) error {
+	if !m.IsOwner {
+		return nil
+	}
+	if Accounts == nil {
+		m.Reply(m.T("account.unavailable"))
+		return nil
+	}
+
+	if len(m.Args) == 0 {
+		_ = m.Reply(accountList(m))
+		return nil
+	}
+
+	switch strings.ToLower(m.Args[0]) {
+	case "add":
+		phone := ""
+		if len(m.Args) > 1 {
+			phone = digits(strings.Join(m.Args[1:], ""))
+		}
+		// Linking takes minutes, so it must not hold up the events of this account
+		Go(func() { addAccount(ctx, m, phone) })
+		return nil
+	case "remove", "rm":
+		if len(m.Args) < 2 {
+			m.Reply(m.T("account.usage", "command", m.Prefix+m.Command))
+			return nil
+		}
+		number := digits(m.Args[1])
+		if number != m.Account && !m.IsGlobalOwner {
+			m.Reply(m.T("account.remove_denied", "number", number))
+			return nil
+		}
+		if number == m.Account {
+			// The reply has to go out before this account is disconnected
+			_ = m.Reply(m.T("account.removed", "number", number))
+		}
+		if err := Accounts.RemoveAccount(ctx, number); err != nil {
+			m.Reply(m.T("account.remove_failed", "number", number, "error", err))
+			return err // Return the error to indicate a system issue
+		}
+		if number != m.Account {
+			_ = m.Reply(m.T("account.removed", "number", number))
+		}
+		return nil
+	default:
+		m.Reply(m.T("account.usage", "command", m.Prefix+m.Command))
+		return nil
+	}
+}
+
+// accountList formats the accounts and their connection state.
+func accountList(m types.Messages) string {
+	accounts := Accounts.Accounts()
+	lines := []string{m.T("account.list", "count", len(accounts))}
+	for _, account := range accounts {
+		state := m.T("account.state." + strings.ReplaceAll(account.State, " ", "_"))
+		if strings.HasPrefix(state, "account.state.") {
+			state = account.State
+		}
+
+		number := account.JID.User
+		if number == "" {
+			number = m.T("account.pending")
+		}
+		if account.Name != "" {
+			number = fmt.Sprintf("%s (%s)", number, account.Name)
+		}
+		if account.JID.User == m.Account {
+			number += " ← " + m.T("account.this")
+		}
+		lines = append(lines, m.T("account.item", "number", number, "state", state))
+	}
+	lines = append(lines, "", m.T("account.usage", "command", m.Prefix+m.Command))
+	return strings.Join(lines, "\n")
+}
+
+// addAccount links a new account, sending the QR code or pairing code to the sender's
+// private chat, so that nobody else in a group can link the account. Linking is
+// aborted when ctx, the command's context, is cancelled on shutdown.
+func addAccount(ctx context.Context, m types.Messages, phone string) {
+	log := utils.LoggerFrom(ctx)
+	dm := m.Sender.ToNonAD()
+	if m.IsGroup {
+		_ = m.Reply(m.T("account.link_private"))
+	}
+
+	timeout := qrLinkTimeout
+	if phone != "" {
+		timeout = codeLinkTimeout
+	}
+	linkCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	shown := false
+	account, err := Accounts.AddAccount(linkCtx, phone, func(prompt types.LoginPrompt) {
+		if shown {
+			return
+		}
+		shown = true
+
+		if prompt.PairCode != "" {
+			text := m.T("account.link_code", "phone", phone, "code", prompt.PairCode)
+			if _, err := m.Client.SendMessage(linkCtx, dm, &waE2E.Message{Conversation: proto.String(text)}); err != nil {
+				log.Error().Err(err).Msg("Failed to send pairing code")
+			}
+			return
+		}
+		png, err := qrcode.Encode(prompt.QR, qrcode.Medium, 512)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to render QR code")
+			return
+		}
+		if _, err := utils.SendImageTo(linkCtx, m.Client, dm, png, types.Options{Caption: m.T("account.link_qr")}); err != nil {
+			log.Error().Err(err).Msg("Failed to send QR code")
+		}
+	})
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to add account")
+		_ = m.Reply(m.T("account.add_failed", "error", err))
+		return
+	}
+	_ = m.Reply(m.T("account.added", "number", account.JID.User))
+}
+
+// digits returns only the digits of s, e.g. of a phone number written as "+62 812-3456".
+func digits(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+// init function for automatic registration
+func init() {
+	handler := NewAccountHandler()
+	MustRegister([]string{"account", "accounts"}, handler, "")
+}
@@ -0,0 +1,83 @@
+// Package commands implements the logic for specific bot commands.
+// This file handles the 'backup' command, which sends the global owners a backup of the
+// session database in their private chat.
+package commands
+
+import (
+	"aemy/backup"
+	"aemy/types"
+	"aemy/utils"
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// Backup makes a backup of the session database and returns its path. It is set by
+// client.Init and nil when the commands run without WhatsApp (console, replay).
+var Backup func(ctx context.Context) (string, error)
+
+// BackupHandler handles the 'backup' command.
+type BackupHandler struct{}
+
+// NewBackupHandler creates a new instance of BackupHandler.
+func NewBackupHandler() *BackupHandler {
+	return &BackupHandler{}
+}
+
+// Handle implements the CommandHandler interface for the 'backup' command.
+// It makes a backup (kept in config.BackupDir like the scheduled ones) and sends it to
+// the owner's private chat, never to a group.
+func (h *BackupHandler) Handle(ctx context.Context, client types.Client, m types.Messages, evt *events.Message) error {
+	// A backup holds the keys of every account, so owners of a single account
+	// (config.Accounts) cannot get one
+	if !m.IsGlobalOwner {
+		return nil
+	}
+	if Backup == nil {
+		m.Reply(m.T("backup.unavailable"))
+		return nil
+	}
+
+	_ = m.React("⏳")
+	path, err := Backup(ctx)
+	if err != nil {
+		m.Reply(m.T("backup.failed", "error", err))
+		return err // Return the error to indicate a system issue
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		m.Reply(m.T("backup.failed", "error", err))
+		return err
+	}
+
+	name := filepath.Base(path)
+	caption := m.T("backup.caption", "time", time.Now().In(m.TimeZone).Format("02-Jan-2006 15:04 MST"), "file", name)
+	if backup.Passphrase() == "" {
+		caption += "\n\n" + m.T("backup.unencrypted")
+	}
+
+	_, err = utils.SendDocumentTo(ctx, client, m.Sender.ToNonAD(), data, types.Options{
+		Caption:  caption,
+		FileName: name,
+		Mimetype: "application/octet-stream",
+		NoCache:  true,
+	})
+	if err != nil {
+		m.Reply(m.T("backup.send_failed", "error", err))
+		return err
+	}
+	_ = m.React("✅")
+	if m.IsGroup {
+		_ = m.Reply(m.T("backup.sent"))
+	}
+	return nil
+}
+
+// init function for automatic registration
+func init() {
+	handler := NewBackupHandler()
+	MustRegister([]string{"backup"}, handler, "")
+}
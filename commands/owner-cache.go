@@ -0,0 +1,65 @@
+// Package commands implements the logic for specific bot commands.
+// This file handles the 'cache' command, allowing owners to inspect and clear the media cache.
+package commands
+
+import (
+	"aemy/types"
+	"aemy/utils"
+	"context"
+	"fmt"
+	"strings"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// CacheHandler handles the 'cache' command.
+type CacheHandler struct{}
+
+// NewCacheHandler creates a new instance of CacheHandler.
+func NewCacheHandler() *CacheHandler {
+	return &CacheHandler{}
+}
+
+// Handle implements the CommandHandler interface for the 'cache' command.
+// Without arguments it shows cache statistics; "clear" removes every cached entry. The
+// cache is shared by all accounts, so only the global owners (config.Owners) may clear it.
+func (h *CacheHandler) Handle(ctx context.Context, client types.Client, m types.Messages, evt *events.Message) error {
+	if !m.IsOwner {
+		return nil
+	}
+
+	if strings.EqualFold(strings.TrimSpace(m.Text), "clear") {
+		if !m.IsGlobalOwner {
+			m.Reply(m.T("cache.clear_denied"))
+			return nil
+		}
+		if err := utils.DefaultCache.Clear(); err != nil {
+			m.Reply(m.T("cache.clear_failed", "error", err))
+			return err
+		}
+		_ = m.Reply(m.T("cache.cleared"))
+		return nil
+	}
+
+	stats := utils.DefaultCache.Stats()
+	ratio := 0.0
+	if total := stats.Hits + stats.Misses; total > 0 {
+		ratio = float64(stats.Hits) / float64(total) * 100
+	}
+
+	_ = m.Reply(m.T("cache.info",
+		"count", stats.Entries,
+		"size", fmt.Sprintf("%.2f", float64(stats.Size)/1024/1024),
+		"hits", stats.Hits,
+		"misses", stats.Misses,
+		"ratio", fmt.Sprintf("%.1f", ratio),
+		"prefix", m.Prefix,
+	))
+	return nil
+}
+
+// init function for automatic registration
+func init() {
+	handler := NewCacheHandler()
+	MustRegister([]string{"cache"}, handler, "")
+}
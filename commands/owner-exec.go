@@ -1,14 +1,12 @@
 // Package commands implements the logic for specific bot commands.
-// This file handles the 'exec' command, allowing owners to execute shell commands.
+// This file handles the 'exec' command, allowing the global owners to execute shell commands.
 package commands
 
 import (
 	"aemy/types"
 	"aemy/utils"
 	"context"
-	"fmt"
 
-	"go.mau.fi/whatsmeow"
 	"go.mau.fi/whatsmeow/types/events"
 )
 
@@ -21,15 +19,17 @@ func NewExecHandler() *ExecHandler {
 }
 
 // Handle implements the CommandHandler interface for the 'exec' command.
-func (h *ExecHandler) Handle(ctx context.Context, client *whatsmeow.Client, m types.Messages, evt *events.Message) error {
-	if !m.IsOwner {
+// A shell can read the session database with the keys of every account, so only the
+// global owners (config.Owners) may use it, not the owners of a single account.
+func (h *ExecHandler) Handle(ctx context.Context, client types.Client, m types.Messages, evt *events.Message) error {
+	if !m.IsGlobalOwner {
 		// Silently ignore if not owner, as per original logic
 		return nil
 	}
 
 	output, err := utils.ExecuteShell(m.Text)
 	if err != nil {
-		m.Reply(fmt.Sprintf("Error: %v", err))
+		m.Reply(m.T("error.generic", "error", err))
 		return err // Return the error to indicate a system issue
 	}
 	_ = m.Reply(output)
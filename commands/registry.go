@@ -19,7 +19,7 @@ var (
 	mutex    = sync.RWMutex{}
 	
 	// Default category for commands without a specified category
-	defaultCat = "Other"
+	defaultCat = "other"
 )
 
 // Register registers a command handler with one or more names
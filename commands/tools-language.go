@@ -0,0 +1,77 @@
+// Package commands implements the logic for specific bot commands.
+// This file handles the 'language' command, letting users and group admins choose the
+// language the bot replies in.
+package commands
+
+import (
+	"aemy/i18n"
+	"aemy/prefs"
+	"aemy/types"
+	"context"
+	"strings"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// LanguageHandler handles the 'language' command.
+type LanguageHandler struct{}
+
+// NewLanguageHandler creates a new instance of LanguageHandler.
+func NewLanguageHandler() *LanguageHandler {
+	return &LanguageHandler{}
+}
+
+// Handle implements the CommandHandler interface for the 'language' command.
+//
+// Usage:
+//   - language                      show the language in effect
+//   - language <code>|reset         set or remove the sender's own language
+//   - language chat <code>|reset    set or remove the group's default (admins and owners)
+func (h *LanguageHandler) Handle(ctx context.Context, client types.Client, m types.Messages, evt *events.Message) error {
+	languages := strings.Join(i18n.Languages(), "|")
+	usage := m.T("language.usage", "command", m.Prefix+m.Command, "languages", languages)
+
+	if len(m.Args) == 0 {
+		_ = m.Reply(m.T("language.current", "language", m.T("language.name"), "source", settingSource(m, prefs.KeyLanguage), "usage", usage))
+		return nil
+	}
+
+	// Pick whose preference is changed: the sender's, or the group's with "chat"
+	target, args, scope, ok := settingTarget(client, m)
+	if !ok {
+		return nil
+	}
+	if len(args) == 0 {
+		m.Reply(usage)
+		return nil
+	}
+
+	if strings.EqualFold(args[0], "reset") {
+		if err := prefs.Set(target, prefs.KeyLanguage, ""); err != nil {
+			m.Reply(m.T("language.save_failed"))
+			return err // Return the error to indicate a system issue
+		}
+		_ = m.Reply(m.T("language.reset." + scope))
+		return nil
+	}
+
+	lang := strings.ToLower(args[0])
+	if !i18n.Supported(lang) {
+		m.Reply(m.T("language.unknown", "language", args[0], "languages", strings.Join(i18n.Languages(), ", ")))
+		return nil // Return nil as this is a user input error, not a system error
+	}
+
+	if err := prefs.Set(target, prefs.KeyLanguage, lang); err != nil {
+		m.Reply(m.T("language.save_failed"))
+		return err // Return the error to indicate a system issue
+	}
+	// Confirm in the newly chosen language
+	_ = m.Reply(i18n.T(lang, "language.set."+scope, "language", i18n.T(lang, "language.name")))
+	return nil
+}
+
+// init function for automatic registration
+func init() {
+	handler := NewLanguageHandler()
+	MustRegister([]string{"language", "lang", "bahasa"}, handler, "tools")
+}
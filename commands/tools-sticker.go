@@ -0,0 +1,80 @@
+// Package commands implements the logic for specific bot commands.
+// This file handles the 'sticker' command, turning images and short videos into stickers.
+package commands
+
+import (
+	"aemy/config"
+	"aemy/types"
+	"aemy/utils"
+	"context"
+	"errors"
+	"strings"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// StickerHandler handles the 'sticker' command.
+type StickerHandler struct{}
+
+// NewStickerHandler creates a new instance of StickerHandler.
+func NewStickerHandler() *StickerHandler {
+	return &StickerHandler{}
+}
+
+// Handle implements the CommandHandler interface for the 'sticker' command.
+// The image or video is taken from the message itself or from the quoted message.
+// An optional "pack|author" argument overrides the configured sticker metadata.
+func (h *StickerHandler) Handle(ctx context.Context, client types.Client, m types.Messages, evt *events.Message) error {
+	// Prefer media sent with the command, then the replied-to message
+	media, err := m.Download()
+	if errors.Is(err, utils.ErrNoMedia) && m.Quoted != nil {
+		media, err = m.Quoted.Download()
+	}
+	if errors.Is(err, utils.ErrNoMedia) || (err == nil && media.Type != "image" && media.Type != "video") {
+		m.Reply(m.T("sticker.usage", "command", m.Prefix+m.Command))
+		return nil // Return nil as this is a user input error, not a system error
+	}
+	if errors.Is(err, utils.ErrMediaTooLarge) {
+		m.Reply(m.T("error.media_too_large"))
+		return nil
+	}
+	if err != nil {
+		m.Reply(m.T("error.download_media"))
+		return err // Return the error to indicate a system issue
+	}
+
+	pack, author := config.StickerPack, config.StickerAuthor
+	if m.Text != "" {
+		name, publisher, found := strings.Cut(m.Text, "|")
+		pack = strings.TrimSpace(name)
+		if found {
+			author = strings.TrimSpace(publisher)
+		}
+	}
+
+	sticker, _, err := utils.MakeSticker(ctx, media.Data, pack, author)
+	if errors.Is(err, utils.ErrFFmpegUnavailable) {
+		m.Reply(m.T("sticker.video_unavailable"))
+		return nil
+	}
+	if errors.Is(err, utils.ErrStickerTooLarge) {
+		m.Reply(m.T("sticker.too_large"))
+		return nil
+	}
+	if err != nil {
+		m.Reply(m.T("sticker.create_failed"))
+		return err // Return the error to indicate a system issue
+	}
+
+	if _, err := m.SendSticker(types.FromBytes(sticker), types.Options{}); err != nil {
+		m.Reply(m.T("sticker.send_failed"))
+		return err // Return the error to indicate a system issue
+	}
+	return nil
+}
+
+// init function for automatic registration
+func init() {
+	handler := NewStickerHandler()
+	MustRegister([]string{"sticker", "s", "stiker"}, handler, "tools")
+}
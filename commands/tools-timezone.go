@@ -0,0 +1,130 @@
+// Package commands implements the logic for specific bot commands.
+// This file handles the 'timezone' command, letting users and group admins choose the
+// timezone greetings and times are shown in.
+package commands
+
+import (
+	"aemy/prefs"
+	"aemy/types"
+	"aemy/utils"
+	"context"
+	"strings"
+	"time"
+
+	waTypes "go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// TimezoneHandler handles the 'timezone' command.
+type TimezoneHandler struct{}
+
+// NewTimezoneHandler creates a new instance of TimezoneHandler.
+func NewTimezoneHandler() *TimezoneHandler {
+	return &TimezoneHandler{}
+}
+
+// Handle implements the CommandHandler interface for the 'timezone' command.
+//
+// Usage:
+//   - timezone                      show the timezone in effect and the local time
+//   - timezone <zone>|reset         set or remove the sender's own timezone
+//   - timezone chat <zone>|reset    set or remove the group's default (admins and owners)
+func (h *TimezoneHandler) Handle(ctx context.Context, client types.Client, m types.Messages, evt *events.Message) error {
+	command := m.Prefix + m.Command
+	usage := m.T("timezone.usage", "command", command)
+
+	if len(m.Args) == 0 {
+		now := time.Now().In(m.TimeZone)
+		_ = m.Reply(m.T("timezone.current", "zone", m.TimeZone.String(), "source", settingSource(m, prefs.KeyTimezone), "time", now.Format("02-Jan-2006 15:04 MST"), "usage", usage))
+		return nil
+	}
+
+	// Pick whose preference is changed: the sender's, or the group's with "chat"
+	target, args, scope, ok := settingTarget(client, m)
+	if !ok {
+		return nil
+	}
+	if len(args) == 0 {
+		m.Reply(usage)
+		return nil
+	}
+
+	if strings.EqualFold(args[0], "reset") {
+		if err := prefs.Set(target, prefs.KeyTimezone, ""); err != nil {
+			m.Reply(m.T("timezone.save_failed"))
+			return err // Return the error to indicate a system issue
+		}
+		_ = m.Reply(m.T("timezone.reset." + scope))
+		return nil
+	}
+
+	name := strings.Join(args, "")
+	loc, err := utils.ParseTimezone(name)
+	if err != nil {
+		m.Reply(m.T("timezone.unknown", "zone", name))
+		return nil // Return nil as this is a user input error, not a system error
+	}
+
+	if err := prefs.Set(target, prefs.KeyTimezone, name); err != nil {
+		m.Reply(m.T("timezone.save_failed"))
+		return err // Return the error to indicate a system issue
+	}
+	_ = m.Reply(m.T("timezone.set."+scope, "zone", loc.String(), "time", time.Now().In(loc).Format("15:04 MST")))
+	return nil
+}
+
+// settingTarget picks whose preference a settings command changes: the sender's, or the
+// group's when the first argument is "chat". It replies and returns ok false if the sender
+// may not change the group's settings.
+//
+// Returns:
+//   - waTypes.JID: the user or chat whose preference is changed
+//   - []string: the remaining arguments
+//   - string: "user" or "chat", used to pick the reply
+//   - bool: whether the command should continue
+func settingTarget(client types.Client, m types.Messages) (waTypes.JID, []string, string, bool) {
+	if len(m.Args) == 0 || !strings.EqualFold(m.Args[0], "chat") {
+		return m.Sender, m.Args, "user", true
+	}
+	if !m.IsGroup {
+		m.Reply(m.T("settings.chat_only_groups", "command", m.Prefix+m.Command))
+		return m.Sender, nil, "", false
+	}
+	if !m.IsOwner && !isGroupAdmin(client, m.From, m.Sender) {
+		m.Reply(m.T("settings.admins_only"))
+		return m.Sender, nil, "", false
+	}
+	return m.From, m.Args[1:], "chat", true
+}
+
+// settingSource describes where the value of the preference key in effect for m comes from.
+func settingSource(m types.Messages, key string) string {
+	switch {
+	case prefs.Get(m.Sender, key) != "":
+		return m.T("settings.source.user")
+	case m.IsGroup && prefs.Get(m.From, key) != "":
+		return m.T("settings.source.chat")
+	default:
+		return m.T("settings.source.default")
+	}
+}
+
+// isGroupAdmin reports whether user is an admin of group.
+func isGroupAdmin(client types.Client, group, user waTypes.JID) bool {
+	info, err := client.GetGroupInfo(group)
+	if err != nil {
+		return false
+	}
+	for _, p := range info.Participants {
+		if (p.JID.User == user.User || p.PhoneNumber.User == user.User || p.LID.User == user.User) && (p.IsAdmin || p.IsSuperAdmin) {
+			return true
+		}
+	}
+	return false
+}
+
+// init function for automatic registration
+func init() {
+	handler := NewTimezoneHandler()
+	MustRegister([]string{"timezone", "tz"}, handler, "tools")
+}
@@ -0,0 +1,114 @@
+package commands
+
+import (
+	"aemy/i18n"
+	"aemy/prefs"
+	"aemy/types"
+	"aemy/utils"
+	"aemy/utils/utilstest"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	waTypes "go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	testBot    = waTypes.NewJID("10000000000", waTypes.DefaultUserServer)
+	testSender = waTypes.NewJID("6280000000001", waTypes.DefaultUserServer)
+	testGroup  = waTypes.NewJID("120363000000000001", waTypes.GroupServer)
+)
+
+// runTimezone sends text from testSender in chat, runs the timezone command on it and
+// returns the serialized message and the bot's reply.
+func runTimezone(t *testing.T, client *utilstest.FakeClient, chat waTypes.JID, text string) (types.Messages, string) {
+	t.Helper()
+	client.Reset()
+
+	evt := &events.Message{
+		Info: waTypes.MessageInfo{
+			MessageSource: waTypes.MessageSource{Chat: chat, Sender: testSender, IsGroup: chat.Server == waTypes.GroupServer},
+			ID:            "TEST",
+			Timestamp:     time.Now(),
+		},
+		Message: &waE2E.Message{Conversation: proto.String(text)},
+	}
+	m := utils.Serialize(context.Background(), evt, client)
+	if err := NewTimezoneHandler().Handle(context.Background(), client, m, evt); err != nil {
+		t.Fatalf("%q: %v", text, err)
+	}
+
+	sent := client.Sent()
+	if len(sent) != 1 {
+		t.Fatalf("%q: sent %d messages, want 1", text, len(sent))
+	}
+	return m, utils.MessageText(sent[0].Message)
+}
+
+func TestTimezoneCommand(t *testing.T) {
+	prefs.Use(prefs.NewMemoryStore())
+	client := utilstest.NewFakeClient(testBot)
+
+	m, reply := runTimezone(t, client, testSender, ".tz Mars/Olympus")
+	if want := i18n.T(m.Lang, "timezone.unknown", "zone", "Mars/Olympus"); reply != want {
+		t.Errorf("unknown zone reply = %q, want %q", reply, want)
+	}
+	if got := prefs.Get(testSender, prefs.KeyTimezone); got != "" {
+		t.Errorf("unknown zone was saved as %q", got)
+	}
+
+	_, reply = runTimezone(t, client, testSender, ".tz Asia/Jakarta")
+	if !strings.Contains(reply, "Asia/Jakarta") {
+		t.Errorf("set reply = %q, want it to name Asia/Jakarta", reply)
+	}
+	if got := prefs.Get(testSender, prefs.KeyTimezone); got != "Asia/Jakarta" {
+		t.Errorf("saved timezone = %q, want Asia/Jakarta", got)
+	}
+
+	// The next message is serialized in the new timezone
+	m, _ = runTimezone(t, client, testSender, ".tz")
+	if m.TimeZone.String() != "Asia/Jakarta" {
+		t.Errorf("message timezone = %s, want Asia/Jakarta", m.TimeZone)
+	}
+
+	m, reply = runTimezone(t, client, testSender, ".tz reset")
+	if want := i18n.T(m.Lang, "timezone.reset.user"); reply != want {
+		t.Errorf("reset reply = %q, want %q", reply, want)
+	}
+	if got := prefs.Get(testSender, prefs.KeyTimezone); got != "" {
+		t.Errorf("timezone after reset = %q, want none", got)
+	}
+}
+
+func TestTimezoneCommandGroupNeedsAdmin(t *testing.T) {
+	prefs.Use(prefs.NewMemoryStore())
+	client := utilstest.NewFakeClient(testBot)
+	client.SetGroup(&waTypes.GroupInfo{
+		JID:          testGroup,
+		Participants: []waTypes.GroupParticipant{{JID: testSender}},
+	})
+
+	m, reply := runTimezone(t, client, testGroup, ".tz chat UTC+7")
+	if m.IsOwner {
+		t.Skip("the test sender is configured as an owner")
+	}
+	if want := i18n.T(m.Lang, "settings.admins_only"); reply != want {
+		t.Errorf("non-admin reply = %q, want %q", reply, want)
+	}
+	if got := prefs.Get(testGroup, prefs.KeyTimezone); got != "" {
+		t.Errorf("group timezone was saved as %q", got)
+	}
+
+	client.SetGroup(&waTypes.GroupInfo{
+		JID:          testGroup,
+		Participants: []waTypes.GroupParticipant{{JID: testSender, IsAdmin: true}},
+	})
+	runTimezone(t, client, testGroup, ".tz chat UTC+7")
+	if got := prefs.Get(testGroup, prefs.KeyTimezone); got != "UTC+7" {
+		t.Errorf("group timezone = %q, want UTC+7", got)
+	}
+}
@@ -0,0 +1,56 @@
+// Package commands implements the logic for specific bot commands.
+// This file handles the 'toimg' command, converting a quoted sticker back into an image.
+package commands
+
+import (
+	"aemy/types"
+	"aemy/utils"
+	"context"
+	"errors"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// ToImageHandler handles the 'toimg' command.
+type ToImageHandler struct{}
+
+// NewToImageHandler creates a new instance of ToImageHandler.
+func NewToImageHandler() *ToImageHandler {
+	return &ToImageHandler{}
+}
+
+// Handle implements the CommandHandler interface for the 'toimg' command.
+func (h *ToImageHandler) Handle(ctx context.Context, client types.Client, m types.Messages, evt *events.Message) error {
+	if m.Quoted == nil {
+		m.Reply(m.T("toimg.usage", "command", m.Prefix+m.Command))
+		return nil // Return nil as this is a user input error, not a system error
+	}
+
+	media, err := m.Quoted.Download()
+	if errors.Is(err, utils.ErrNoMedia) || (err == nil && media.Type != "sticker") {
+		m.Reply(m.T("toimg.usage", "command", m.Prefix+m.Command))
+		return nil // Return nil as this is a user input error, not a system error
+	}
+	if err != nil {
+		m.Reply(m.T("toimg.download_failed"))
+		return err // Return the error to indicate a system issue
+	}
+
+	img, err := utils.StickerToImage(media.Data)
+	if err != nil {
+		m.Reply(m.T("toimg.convert_failed", "error", err))
+		return err // Return the error to indicate a system issue
+	}
+
+	if _, err := m.SendImage(types.FromBytes(img), types.Options{}); err != nil {
+		m.Reply(m.T("toimg.send_failed"))
+		return err // Return the error to indicate a system issue
+	}
+	return nil
+}
+
+// init function for automatic registration
+func init() {
+	handler := NewToImageHandler()
+	MustRegister([]string{"toimg", "toimage"}, handler, "tools")
+}
@@ -0,0 +1,414 @@
+// Package console implements a local simulator that runs the bot's commands without
+// a WhatsApp connection. Typed lines are turned into message events and fed through
+// handler.EventHandler with a utilstest.FakeClient; everything the bot sends back is
+// printed to the terminal, and sent media is saved to a temporary directory.
+package console
+
+import (
+	"aemy/config"
+	"aemy/handler"
+	"aemy/utils"
+	"aemy/utils/utilstest"
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// BotNumber is the phone number the simulated bot account uses.
+const BotNumber = "10000000000"
+
+// helpText lists the console directives.
+const helpText = `Lines are sent to the bot as text messages from the simulated sender.
+Lines starting with ':' control the simulation:
+  :as <number> [name]       switch the sender
+  :group [name]             talk in a simulated group (created on first use)
+  :private                  talk in the sender's private chat
+  :owner on|off             treat the sender as a bot owner or not
+  :media <path> [caption]   send an image, video, audio, sticker or document
+  :reply <text>             send text quoting the last message in the chat
+  :help                     show this help
+  :quit                     leave the console`
+
+// Console is a running simulator session.
+type Console struct {
+	client   *utilstest.FakeClient
+	out      io.Writer
+	mediaDir string
+
+	sender   types.JID
+	pushname string
+	chat     types.JID
+	owner    bool
+	owners   []string
+
+	counter int
+	last    *events.Message
+}
+
+// New creates a console session writing to out. The simulated sender starts as the
+// first configured owner so that owner-only commands and self mode work out of the box.
+//
+// Parameters:
+//   - out: where bot output is printed
+//
+// Returns:
+//   - *Console: the session
+//   - error: if the temporary media directory cannot be created
+func New(out io.Writer) (*Console, error) {
+	mediaDir, err := os.MkdirTemp("", "aemy-console-")
+	if err != nil {
+		return nil, err
+	}
+
+	number := "6280000000000"
+	if len(config.Owners) > 0 {
+		number = config.Owners[0]
+	}
+
+	c := &Console{
+		client:   utilstest.NewFakeClient(types.NewJID(BotNumber, types.DefaultUserServer)),
+		out:      out,
+		mediaDir: mediaDir,
+		pushname: "Console",
+		owner:    true,
+		owners:   append([]string(nil), config.Owners...),
+	}
+	c.sender = types.NewJID(number, types.DefaultUserServer)
+	c.chat = c.sender
+	c.client.OnSend = c.print
+	return c, nil
+}
+
+// Client returns the fake client the session runs on.
+func (c *Console) Client() *utilstest.FakeClient {
+	return c.client
+}
+
+// MediaDir returns the directory where media sent by the bot is saved.
+func (c *Console) MediaDir() string {
+	return c.mediaDir
+}
+
+// Run reads lines from in until it is exhausted or ":quit" is entered.
+//
+// Parameters:
+//   - in: the input, usually os.Stdin
+//
+// Returns:
+//   - error: a read error, if any
+func (c *Console) Run(in io.Reader) error {
+	fmt.Fprintln(c.out, "Aemy console. Type :help for help. Media sent by the bot is saved to", c.mediaDir)
+
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for {
+		fmt.Fprint(c.out, c.prompt())
+		if !scanner.Scan() {
+			fmt.Fprintln(c.out)
+			return scanner.Err()
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if line == ":quit" || line == ":q" {
+			return nil
+		}
+		if err := c.Exec(line); err != nil {
+			fmt.Fprintln(c.out, "error:", err)
+		}
+	}
+}
+
+// Exec handles a single input line: a directive if it starts with ':', a text message otherwise.
+func (c *Console) Exec(line string) error {
+	if !strings.HasPrefix(line, ":") {
+		return c.Send(&waE2E.Message{Conversation: proto.String(line)})
+	}
+
+	directive, rest, _ := strings.Cut(strings.TrimPrefix(line, ":"), " ")
+	rest = strings.TrimSpace(rest)
+
+	switch directive {
+	case "help", "h":
+		fmt.Fprintln(c.out, helpText)
+	case "as":
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			return fmt.Errorf("usage: :as <number> [name]")
+		}
+		wasPrivate := c.chat == c.sender
+		c.sender = types.NewJID(strings.TrimPrefix(fields[0], "+"), types.DefaultUserServer)
+		c.pushname = "Console"
+		if len(fields) > 1 {
+			c.pushname = strings.Join(fields[1:], " ")
+		}
+		c.owner = contains(c.owners, c.sender.User)
+		if wasPrivate {
+			c.chat = c.sender
+		} else {
+			c.joinGroup(c.chat, "")
+		}
+	case "group":
+		c.chat = types.NewJID("120363000000000000", types.GroupServer)
+		c.joinGroup(c.chat, rest)
+	case "private":
+		c.chat = c.sender
+	case "owner":
+		switch rest {
+		case "on":
+			c.owner = true
+		case "off":
+			c.owner = false
+		default:
+			return fmt.Errorf("usage: :owner on|off")
+		}
+	case "media":
+		path, caption, _ := strings.Cut(rest, " ")
+		if path == "" {
+			return fmt.Errorf("usage: :media <path> [caption]")
+		}
+		msg, err := c.media(path, strings.TrimSpace(caption))
+		if err != nil {
+			return err
+		}
+		return c.Send(msg)
+	case "reply":
+		if c.last == nil {
+			return fmt.Errorf("nothing to reply to yet")
+		}
+		return c.Send(&waE2E.Message{
+			ExtendedTextMessage: &waE2E.ExtendedTextMessage{
+				Text: proto.String(rest),
+				ContextInfo: &waE2E.ContextInfo{
+					StanzaID:      proto.String(c.last.Info.ID),
+					Participant:   proto.String(c.last.Info.Sender.String()),
+					QuotedMessage: c.last.Message,
+				},
+			},
+		})
+	default:
+		return fmt.Errorf("unknown directive :%s, type :help for help", directive)
+	}
+	return nil
+}
+
+// Send delivers msg to the bot as if the simulated sender had sent it in the current chat.
+func (c *Console) Send(msg *waE2E.Message) error {
+	c.counter++
+	evt := &events.Message{
+		Info: types.MessageInfo{
+			MessageSource: types.MessageSource{
+				Chat:    c.chat,
+				Sender:  c.sender,
+				IsGroup: c.chat.Server == types.GroupServer,
+			},
+			ID:        fmt.Sprintf("CONSOLE%06d", c.counter),
+			PushName:  c.pushname,
+			Timestamp: time.Now(),
+		},
+		Message: msg,
+	}
+	c.last = evt
+
+	// Owner status is derived from config.Owners, so the sender is added or removed for this message
+	config.Owners = append([]string(nil), c.owners...)
+	if c.owner && !contains(c.owners, c.sender.User) {
+		config.Owners = append(config.Owners, c.sender.User)
+	} else if !c.owner {
+		config.Owners = without(c.owners, c.sender.User)
+	}
+	defer func() { config.Owners = c.owners }()
+
+	handler.EventHandler(evt, c.client)
+	handler.Wait()
+	return nil
+}
+
+// prompt describes the current sender and chat.
+func (c *Console) prompt() string {
+	where := "private"
+	if c.chat.Server == types.GroupServer {
+		where = "group"
+	}
+	role := ""
+	if c.owner {
+		role = ", owner"
+	}
+	return fmt.Sprintf("[%s%s @ %s] > ", c.sender.User, role, where)
+}
+
+// joinGroup creates the simulated group if needed and makes sure the bot and the
+// current sender are members of it.
+func (c *Console) joinGroup(jid types.JID, name string) {
+	group, err := c.client.GetGroupInfo(jid)
+	if err != nil {
+		group = &types.GroupInfo{
+			JID:          jid,
+			OwnerJID:     c.sender,
+			GroupName:    types.GroupName{Name: "Console Group"},
+			GroupCreated: time.Now(),
+			Participants: []types.GroupParticipant{{JID: c.client.OwnID(), IsAdmin: true}},
+		}
+	}
+	if name != "" {
+		group.Name = name
+	}
+
+	member := false
+	for _, p := range group.Participants {
+		member = member || p.JID.User == c.sender.User
+	}
+	if !member {
+		group.Participants = append(group.Participants, types.GroupParticipant{JID: c.sender})
+	}
+	c.client.SetGroup(group)
+}
+
+// media builds an incoming media message from a local file. The file is "uploaded" to
+// the fake client so commands can download it again.
+func (c *Console) media(path, caption string) (*waE2E.Message, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	mimetype := http.DetectContentType(data)
+	mediaType := whatsmeow.MediaDocument
+	switch {
+	case strings.HasPrefix(mimetype, "image/"):
+		mediaType = whatsmeow.MediaImage
+	case strings.HasPrefix(mimetype, "video/"):
+		mediaType = whatsmeow.MediaVideo
+	case strings.HasPrefix(mimetype, "audio/") || mimetype == "application/ogg":
+		mediaType = whatsmeow.MediaAudio
+		mimetype = utils.AudioMimetype(data)
+	}
+
+	uploaded, err := c.client.Upload(context.Background(), data, mediaType)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case mimetype == "image/webp":
+		return &waE2E.Message{StickerMessage: &waE2E.StickerMessage{
+			DirectPath: proto.String(uploaded.DirectPath),
+			Mimetype:   proto.String(mimetype),
+			FileLength: proto.Uint64(uploaded.FileLength),
+			IsAnimated: proto.Bool(utils.IsAnimatedWebP(data)),
+		}}, nil
+	case mediaType == whatsmeow.MediaImage:
+		return &waE2E.Message{ImageMessage: &waE2E.ImageMessage{
+			DirectPath: proto.String(uploaded.DirectPath),
+			Mimetype:   proto.String(mimetype),
+			FileLength: proto.Uint64(uploaded.FileLength),
+			Caption:    proto.String(caption),
+		}}, nil
+	case mediaType == whatsmeow.MediaVideo:
+		return &waE2E.Message{VideoMessage: &waE2E.VideoMessage{
+			DirectPath: proto.String(uploaded.DirectPath),
+			Mimetype:   proto.String(mimetype),
+			FileLength: proto.Uint64(uploaded.FileLength),
+			Caption:    proto.String(caption),
+		}}, nil
+	case mediaType == whatsmeow.MediaAudio:
+		return &waE2E.Message{AudioMessage: &waE2E.AudioMessage{
+			DirectPath: proto.String(uploaded.DirectPath),
+			Mimetype:   proto.String(mimetype),
+			FileLength: proto.Uint64(uploaded.FileLength),
+		}}, nil
+	default:
+		return &waE2E.Message{DocumentMessage: &waE2E.DocumentMessage{
+			DirectPath: proto.String(uploaded.DirectPath),
+			Mimetype:   proto.String(mimetype),
+			FileLength: proto.Uint64(uploaded.FileLength),
+			FileName:   proto.String(filepath.Base(path)),
+			Caption:    proto.String(caption),
+		}}, nil
+	}
+}
+
+// print writes a message sent by the bot to the terminal, saving any media it carries.
+func (c *Console) print(sent utilstest.FakeMessage) {
+	msg := utils.UnwrapMessage(sent.Message)
+	prefix := "bot ›"
+	if sent.To != c.chat {
+		prefix = fmt.Sprintf("bot → %s ›", sent.To.User)
+	}
+
+	switch {
+	case msg.GetReactionMessage() != nil:
+		fmt.Fprintf(c.out, "%s reacted %s to %s\n", prefix, msg.GetReactionMessage().GetText(), msg.GetReactionMessage().GetKey().GetID())
+	case msg.GetProtocolMessage() != nil && msg.GetProtocolMessage().GetType() == waE2E.ProtocolMessage_REVOKE:
+		fmt.Fprintf(c.out, "%s deleted %s\n", prefix, msg.GetProtocolMessage().GetKey().GetID())
+	case msg.GetAlbumMessage() != nil:
+		album := msg.GetAlbumMessage()
+		fmt.Fprintf(c.out, "%s album of %d images and %d videos:\n", prefix, album.GetExpectedImageCount(), album.GetExpectedVideoCount())
+	default:
+		if _, kind := utils.MediaOf(msg); kind != "" {
+			fmt.Fprintf(c.out, "%s [%s] %s\n", prefix, kind, c.save(sent))
+		}
+		if text := utils.MessageText(msg); text != "" {
+			fmt.Fprintf(c.out, "%s %s\n", prefix, strings.ReplaceAll(strings.TrimRight(text, "\n"), "\n", "\n      "))
+		}
+	}
+
+	c.last = &events.Message{
+		Info: types.MessageInfo{
+			MessageSource: types.MessageSource{Chat: sent.To, Sender: c.client.OwnID(), IsFromMe: true},
+			ID:            sent.ID,
+			Timestamp:     sent.Timestamp,
+		},
+		Message: sent.Message,
+	}
+}
+
+// save writes the media of a sent message to the media directory and describes the result.
+func (c *Console) save(sent utilstest.FakeMessage) string {
+	media, err := utils.DownloadMedia(context.Background(), c.client, sent.Message)
+	if err != nil {
+		return fmt.Sprintf("(not saved: %v)", err)
+	}
+
+	name := sent.ID + filepath.Ext(utils.FileName("", media.Mimetype))
+	path := filepath.Join(c.mediaDir, name)
+	if err := os.WriteFile(path, media.Data, 0o644); err != nil {
+		return fmt.Sprintf("(not saved: %v)", err)
+	}
+	return fmt.Sprintf("%s (%d KB)", path, (len(media.Data)+1023)/1024)
+}
+
+// contains reports whether list contains value.
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// without returns a copy of list without value.
+func without(list []string, value string) []string {
+	result := make([]string, 0, len(list))
+	for _, v := range list {
+		if v != value {
+			result = append(result, v)
+		}
+	}
+	return result
+}
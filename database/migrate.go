@@ -0,0 +1,106 @@
+// Package database opens the database that holds the WhatsApp sessions and the bot's own tables.
+// This file, migrate.go, creates and upgrades the bot's own tables. whatsmeow upgrades its
+// tables itself (sqlstore.Container.Upgrade).
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// migration upgrades the bot's tables by one version.
+type migration struct {
+	// name describes the migration in logs.
+	name string
+
+	// up returns the statements to run for the given dialect.
+	up func(dialect string) []string
+}
+
+// migrations are applied in order; the version of a database is the number of
+// migrations applied to it. Never change or reorder released migrations, only append.
+var migrations = []migration{
+	{
+		name: "create preferences",
+		up: func(dialect string) []string {
+			return []string{`CREATE TABLE IF NOT EXISTS aemy_preferences (
+				jid   TEXT NOT NULL,
+				key   TEXT NOT NULL,
+				value TEXT NOT NULL,
+				PRIMARY KEY (jid, key)
+			)`}
+		},
+	},
+}
+
+// Version returns the number of migrations applied to db, 0 for a new database.
+func Version(ctx context.Context, db *sql.DB) (int, error) {
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS aemy_version (version INTEGER NOT NULL)`); err != nil {
+		return 0, err
+	}
+	var version int
+	err := db.QueryRowContext(ctx, `SELECT version FROM aemy_version`).Scan(&version)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return version, err
+}
+
+// Latest returns the version Migrate upgrades to.
+func Latest() int {
+	return len(migrations)
+}
+
+// Migrate applies the migrations db is missing. Each migration runs in a transaction
+// together with the version update, so an interrupted upgrade can simply be run again.
+//
+// Parameters:
+//   - ctx: cancels the upgrade
+//   - db: the database, opened with Open
+//   - dialect: the dialect db was opened with
+//
+// Returns:
+//   - int: the number of migrations applied
+//   - error: if a migration fails, or db is newer than this version of the bot
+func Migrate(ctx context.Context, db *sql.DB, dialect string) (int, error) {
+	version, err := Version(ctx, db)
+	if err != nil {
+		return 0, fmt.Errorf("read database version: %w", err)
+	}
+	if version > len(migrations) {
+		return 0, fmt.Errorf("database version %d is newer than this bot supports (%d)", version, len(migrations))
+	}
+
+	for i := version; i < len(migrations); i++ {
+		if err := apply(ctx, db, dialect, i); err != nil {
+			return i - version, fmt.Errorf("migration %d (%s): %w", i+1, migrations[i].name, err)
+		}
+	}
+	return len(migrations) - version, nil
+}
+
+// apply runs migration i and records the new version.
+func apply(ctx context.Context, db *sql.DB, dialect string, i int) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, statement := range migrations[i].up(dialect) {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+
+	if i == 0 {
+		_, err = tx.ExecContext(ctx, `INSERT INTO aemy_version (version) VALUES ($1)`, i+1)
+	} else {
+		_, err = tx.ExecContext(ctx, `UPDATE aemy_version SET version = $1`, i+1)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,54 @@
+package database_test
+
+import (
+	"aemy/database"
+	"aemy/database/databasetest"
+	"context"
+	"database/sql"
+	"testing"
+)
+
+func TestMigrate(t *testing.T) {
+	databasetest.Each(t, func(t *testing.T, db *sql.DB, dialect string) {
+		ctx := context.Background()
+
+		if version, err := database.Version(ctx, db); err != nil || version != 0 {
+			t.Fatalf("new database: version %d, err %v; want 0", version, err)
+		}
+
+		applied, err := database.Migrate(ctx, db, dialect)
+		if err != nil {
+			t.Fatalf("Migrate: %v", err)
+		}
+		if applied != database.Latest() {
+			t.Errorf("applied %d migrations, want %d", applied, database.Latest())
+		}
+		if version, err := database.Version(ctx, db); err != nil || version != database.Latest() {
+			t.Fatalf("migrated database: version %d, err %v; want %d", version, err, database.Latest())
+		}
+
+		// A second run has nothing left to do
+		if applied, err := database.Migrate(ctx, db, dialect); err != nil || applied != 0 {
+			t.Errorf("second Migrate: applied %d, err %v; want 0", applied, err)
+		}
+
+		if _, err := db.ExecContext(ctx, `INSERT INTO aemy_preferences (jid, key, value) VALUES ($1, $2, $3)`, "a", "b", "c"); err != nil {
+			t.Errorf("preferences table: %v", err)
+		}
+	})
+}
+
+func TestMigrateRejectsNewerDatabase(t *testing.T) {
+	databasetest.Each(t, func(t *testing.T, db *sql.DB, dialect string) {
+		ctx := context.Background()
+		if _, err := database.Migrate(ctx, db, dialect); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.ExecContext(ctx, `UPDATE aemy_version SET version = $1`, database.Latest()+1); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := database.Migrate(ctx, db, dialect); err == nil {
+			t.Error("Migrate accepted a database from a newer version")
+		}
+	})
+}
@@ -5,12 +5,11 @@ package handler
 import (
 	"aemy/commands"
 	"aemy/config"
+	"aemy/types"
 	"aemy/utils"
-	"context"
-	"fmt"
 	"strings"
+	"time"
 
-	"go.mau.fi/whatsmeow"
 	waTypes "go.mau.fi/whatsmeow/types"
 	"go.mau.fi/whatsmeow/types/events"
 )
@@ -22,18 +21,26 @@ import (
 // Parameters:
 //   evt: The event interface{} received from the client. This can be any event type
 //        defined by the whatsmeow library (e.g., *events.Message, *events.Receipt, etc.).
-//   client: A pointer to the active whatsmeow.Client instance, used to perform actions
-//           like sending messages or marking them as read.
-func EventHandler(evt interface{}, client *whatsmeow.Client) {
+//   client: The client the event was received on, used to perform actions like sending
+//           messages or marking them as read. This is a utils.WhatsmeowClient when
+//           connected, or a utilstest.FakeClient when simulating.
+func EventHandler(evt interface{}, client types.Client) {
 	switch v := evt.(type) {
 	// Case for handling incoming messages.
 	case *events.Message:
 		// Serialize the raw message event into a more manageable custom format.
-		m := utils.Serialize(v, client)
-		
-		
+		// The message helpers send with a context that is cancelled if the bot has to
+		// abort running commands on shutdown.
+		m := utils.Serialize(baseCtx, v, client)
+
+		// Every log entry about this message carries its account, chat, sender, command and request ID.
+		log := utils.MessageLogger(m, utils.NewRequestID())
+
+		// Owners, prefixes and modes can differ between bot accounts.
+		settings := config.For(m.Account)
+
 		// Automatically mark status updates as read. 
-		if m.From.String() == "status@broadcast" && config.ReadStatus && !m.FromMe {
+		if m.From.String() == "status@broadcast" && settings.ReadStatus && !m.FromMe {
 			err := client.MarkRead(
 				[]waTypes.MessageID{m.ID},
 				m.Timestamp,
@@ -42,7 +49,7 @@ func EventHandler(evt interface{}, client *whatsmeow.Client) {
 			)
 			if err != nil {
 				// Log if marking the status as read fails.
-				fmt.Println("Failed to mark status as read:", err)
+				log.Warn().Err(err).Msg("Failed to mark status as read")
 			}
 		}
 		
@@ -50,7 +57,8 @@ func EventHandler(evt interface{}, client *whatsmeow.Client) {
 		// Ignore certain messages:
 		// - Skip messages from newsletters to avoid processing channel-type messages (like WhatsApp Channels).
 		// - If 'Self' mode is enabled, only allow commands from the bot owner.
-		if m.FromServer == "newsletter" || (config.Self && !m.IsOwner) {
+		// - Skip edits, so correcting a typo does not run the command a second time.
+		if m.FromServer == "newsletter" || (settings.Self && !m.IsOwner) || m.IsEdit {
 			return
 		}
 		
@@ -63,14 +71,30 @@ func EventHandler(evt interface{}, client *whatsmeow.Client) {
 
 		// Lookup the handler for the command from the automatic registry.
 		if handler, ok := commands.Get(cmd); ok {
-			// Create a context for the command execution.
-			ctx := context.Background()
-			
-			// Execute the command handler.
-			// In a more complex application, you might want to handle errors differently,
-			// perhaps by logging them or sending an error message back to the user.
-			// For now, we'll just ignore the error.
-			_ = handler.Handle(ctx, client, m, v)
+			// No new commands are started once the bot is shutting down.
+			if !begin() {
+				log.Info().Msg("Shutting down, command ignored")
+				return
+			}
+
+			// Create a context for the command execution carrying the contextual logger,
+			// available to commands through utils.LoggerFrom. It is cancelled if the
+			// command is still running when the shutdown deadline passes.
+			ctx := log.WithContext(baseCtx)
+
+			// Execute the command handler in its own goroutine, as whatsmeow delivers
+			// events one at a time and a slow command would hold up every other chat.
+			go func() {
+				defer running.Done()
+				defer recovered(&log)
+				start := time.Now()
+				err := handler.Handle(ctx, client, m, v)
+				if err != nil {
+					log.Error().Err(err).Dur("duration", time.Since(start)).Msg("Command failed")
+				} else {
+					log.Debug().Dur("duration", time.Since(start)).Msg("Command handled")
+				}
+			}()
 		}
 		// If no handler is found, the command is silently ignored.
 		// You could add a default handler here if desired.
@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"aemy/commands"
+	"aemy/config"
+	"aemy/prefs"
+	"aemy/types"
+	"aemy/utils/utilstest"
+	"context"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	waTypes "go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// panicHandler panics on every command, like a handler dereferencing a missing field
+// of a scraper response.
+type panicHandler struct{}
+
+// Handle implements types.CommandHandler.
+func (panicHandler) Handle(ctx context.Context, client types.Client, m types.Messages, evt *events.Message) error {
+	var data *struct{ URL string }
+	_ = data.URL
+	return nil
+}
+
+func init() {
+	commands.MustRegister([]string{"testpanic"}, panicHandler{}, "")
+}
+
+func TestPanickingCommandIsRecovered(t *testing.T) {
+	owners, accounts, self := config.Owners, config.Accounts, config.Self
+	config.Owners, config.Accounts, config.Self = nil, nil, false
+	t.Cleanup(func() { config.Owners, config.Accounts, config.Self = owners, accounts, self })
+	prefs.Use(prefs.NewMemoryStore())
+
+	bot := waTypes.NewJID("10000000000", waTypes.DefaultUserServer)
+	sender := waTypes.NewJID("6280000000001", waTypes.DefaultUserServer)
+	client := utilstest.NewFakeClient(bot)
+	evt := &events.Message{
+		Info: waTypes.MessageInfo{
+			MessageSource: waTypes.MessageSource{Chat: sender, Sender: sender},
+			ID:            "TEST",
+			Timestamp:     time.Now(),
+		},
+		Message: &waE2E.Message{Conversation: proto.String(".testpanic")},
+	}
+
+	// A panic would end the test binary; the command must also stop counting as running
+	EventHandler(evt, client)
+	Wait()
+
+	if !Go(func() { panic("background work failed") }) {
+		t.Fatal("Go did not start the work")
+	}
+	Wait()
+}
@@ -0,0 +1,123 @@
+// Package handler provides functions for processing events received from the WhatsApp client.
+// This file, shutdown.go, tracks the commands that are running so that the bot can
+// stop accepting new ones and wait for the rest before it exits.
+package handler
+
+import (
+	"aemy/commands"
+	"aemy/utils"
+	"context"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// cancelGrace is how long Drain waits for handlers to return after cancelling them.
+const cancelGrace = 5 * time.Second
+
+var (
+	// mu guards draining, so that no command starts once Drain has begun waiting.
+	mu       sync.Mutex
+	draining bool
+
+	// running counts the command handlers that have not returned yet.
+	running sync.WaitGroup
+
+	// baseCtx is the parent of every command's context; cancelAll cancels them all.
+	baseCtx, cancelAll = context.WithCancel(context.Background())
+)
+
+// begin registers a command that is about to run.
+//
+// Returns:
+//   - bool: false if the bot is shutting down and the command must not run
+func begin() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	if draining {
+		return false
+	}
+	running.Add(1)
+	return true
+}
+
+func init() {
+	commands.Go = Go
+}
+
+// Go runs f in the background like a command: Drain waits for it, and it is not started
+// once the bot is shutting down. f should stop when the command's context is cancelled.
+//
+// Parameters:
+//   - f: the work to run
+//
+// Returns:
+//   - bool: false if the bot is shutting down and f was not started
+func Go(f func()) bool {
+	if !begin() {
+		return false
+	}
+	go func() {
+		defer running.Done()
+		defer recovered(&utils.Log)
+		f()
+	}()
+	return true
+}
+
+// recovered logs a panic of a command or of work started with Go, instead of letting it
+// crash the bot with every account. It must be deferred directly by the goroutine.
+func recovered(log *zerolog.Logger) {
+	if r := recover(); r != nil {
+		log.Error().Interface("panic", r).Bytes("stack", debug.Stack()).Msg("Command panicked")
+	}
+}
+
+// Drain stops accepting new commands and waits for the running ones to finish. If they
+// are not done within timeout, their contexts are cancelled (aborting downloads, uploads
+// and sends) and Drain waits a few more seconds for them to return.
+//
+// Parameters:
+//   - timeout: how long to wait before cancelling the running commands
+//
+// Returns:
+//   - bool: true if every command finished on its own, false if they had to be cancelled
+func Drain(timeout time.Duration) bool {
+	mu.Lock()
+	draining = true
+	mu.Unlock()
+
+	if wait(timeout) {
+		return true
+	}
+	cancelAll()
+	wait(cancelGrace)
+	return false
+}
+
+// Wait waits until no command, nor work started with Go, is running anymore. The console
+// and replays call it after each event, to read the replies of its command.
+func Wait() {
+	running.Wait()
+}
+
+// wait waits up to timeout for the running commands to finish.
+//
+// Returns:
+//   - bool: true if none is running anymore
+func wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
@@ -0,0 +1,185 @@
+// Package i18n translates the bot's replies. Messages are looked up by key in the
+// bundles under locales/ (one JSON file per language), may contain {name} placeholders,
+// and can have plural forms selected by a "count" value.
+package i18n
+
+import (
+	"aemy/config"
+	"aemy/prefs"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+//go:embed locales/*.json
+var locales embed.FS
+
+// Fallback is the language used for keys missing from another bundle.
+const Fallback = "en"
+
+// message is a catalog entry: a single text, or plural forms keyed by CLDR category
+// ("zero", "one", "two", "few", "many", "other").
+type message struct {
+	text  string
+	forms map[string]string
+}
+
+// UnmarshalJSON accepts either a string or an object of plural forms.
+func (m *message) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &m.text); err == nil {
+		return nil
+	}
+	return json.Unmarshal(data, &m.forms)
+}
+
+// catalog holds all bundles by language code.
+var catalog = loadCatalog()
+
+// loadCatalog parses the embedded bundles. A broken bundle is a programming error.
+func loadCatalog() map[string]map[string]message {
+	entries, err := locales.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+
+	result := make(map[string]map[string]message)
+	for _, entry := range entries {
+		data, err := locales.ReadFile(path.Join("locales", entry.Name()))
+		if err != nil {
+			panic(err)
+		}
+		bundle := make(map[string]message)
+		if err := json.Unmarshal(data, &bundle); err != nil {
+			panic(fmt.Sprintf("i18n: %s: %v", entry.Name(), err))
+		}
+		result[strings.TrimSuffix(entry.Name(), ".json")] = bundle
+	}
+	return result
+}
+
+// Languages returns the codes of all shipped languages, sorted.
+func Languages() []string {
+	langs := make([]string, 0, len(catalog))
+	for lang := range catalog {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// Supported reports whether lang has a bundle.
+func Supported(lang string) bool {
+	_, ok := catalog[lang]
+	return ok
+}
+
+// T returns the message for key in lang with its placeholders filled in. vars are
+// name/value pairs; a "count" value selects the plural form. Keys missing from lang
+// fall back to English, and unknown keys are returned as is.
+//
+// Parameters:
+//   - lang: the language code, e.g. "en" or "id"
+//   - key: the message key, e.g. "tiktok.no_link"
+//   - vars: placeholder values, e.g. "count", 3, "total", 5
+//
+// Returns:
+//   - string: the translated text
+//
+// Example:
+//
+//	i18n.T("en", "album.failed", "failed", 1, "count", 3) // "Failed to send 1 of 3 items:"
+func T(lang, key string, vars ...any) string {
+	msg, ok := catalog[lang][key]
+	if !ok {
+		lang = Fallback
+		if msg, ok = catalog[Fallback][key]; !ok {
+			return key
+		}
+	}
+
+	values := make(map[string]string, len(vars)/2)
+	pairs := make([]string, 0, len(vars))
+	for i := 0; i+1 < len(vars); i += 2 {
+		name, value := fmt.Sprint(vars[i]), fmt.Sprint(vars[i+1])
+		values[name] = value
+		pairs = append(pairs, "{"+name+"}", value)
+	}
+
+	text := msg.text
+	if msg.forms != nil {
+		text = msg.forms[pluralCategory(lang, values["count"])]
+		if text == "" {
+			text = msg.forms["other"]
+		}
+	}
+
+	// One pass, so placeholders inside substituted values are left alone
+	return strings.NewReplacer(pairs...).Replace(text)
+}
+
+// pluralCategory returns the CLDR plural category of count in lang.
+func pluralCategory(lang, count string) string {
+	switch lang {
+	case "id":
+		// Indonesian does not inflect for number
+		return "other"
+	default:
+		if count == "1" {
+			return "one"
+		}
+		return "other"
+	}
+}
+
+// countryLanguages maps phone country calling codes to the language of the users there.
+// Numbers from other countries get config.Language.
+var countryLanguages = map[string]string{
+	"62": "id", // Indonesia
+}
+
+// Guess returns a language for a user from the country code of their phone number,
+// or config.Language if it cannot tell (e.g. for LID users, whose number is hidden).
+func Guess(user types.JID) string {
+	if user.Server == types.DefaultUserServer {
+		for code, lang := range countryLanguages {
+			if strings.HasPrefix(user.User, code) && Supported(lang) {
+				return lang
+			}
+		}
+	}
+	return Default()
+}
+
+// Default returns config.Language, or English if it has no bundle.
+func Default() string {
+	if Supported(config.Language) {
+		return config.Language
+	}
+	return Fallback
+}
+
+// For returns the language to reply in: the sender's own setting, then the chat's,
+// then a guess from the sender's phone number.
+//
+// Parameters:
+//   - chat: the chat the reply goes to
+//   - sender: the user being replied to
+//
+// Returns:
+//   - string: the language code
+func For(chat, sender types.JID) string {
+	for _, jid := range []types.JID{sender, chat} {
+		if jid.IsEmpty() {
+			continue
+		}
+		if lang := prefs.Get(jid, prefs.KeyLanguage); Supported(lang) {
+			return lang
+		}
+	}
+	return Guess(sender)
+}
@@ -0,0 +1,26 @@
+package i18n
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTSubstitutesOnce(t *testing.T) {
+	// A value that looks like another placeholder must be shown as is
+	for i := 0; i < 20; i++ {
+		got := T("en", "backup.caption", "time", "{file}", "file", "x.tar.gz")
+		if !strings.Contains(got, "{file}") || strings.Count(got, "x.tar.gz") != 1 {
+			t.Fatalf("T = %q", got)
+		}
+	}
+}
+
+func TestCategoryKeysAreLowercase(t *testing.T) {
+	for lang, messages := range catalog {
+		for key := range messages {
+			if strings.HasPrefix(key, "menu.category.") && key != strings.ToLower(key) {
+				t.Errorf("%s: %s is not lowercase", lang, key)
+			}
+		}
+	}
+}
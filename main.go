@@ -1,22 +1,144 @@
 // Package main is the entry point for the WhatsApp bot application.
-// It initializes the bot client, connects to WhatsApp, and handles graceful shutdown.
+// It runs the bot (initializing the client, connecting to WhatsApp and shutting down
+// gracefully) and the subcommands for operating it, see subcommands.
 package main
 
 import (
 	"aemy/client"
+	"aemy/config"
+	"aemy/handler"
+	"aemy/outbox"
+	"aemy/utils"
+	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 )
 
-// main is the primary function that starts the application.
-// It sets up the WhatsApp client and listens for system signals (like Ctrl+C)
-// to disconnect the client gracefully.
+// subcommand is a command of the aemy executable, e.g. "aemy login".
+type subcommand struct {
+	// name is the word after "aemy" that selects the subcommand.
+	name string
+
+	// usage lists the arguments, shown in the help.
+	usage string
+
+	// summary is a one-line description, shown in the help.
+	summary string
+
+	// run runs the subcommand with the remaining arguments and returns the exit status.
+	run func(args []string) int
+}
+
+// subcommands are the commands of the aemy executable, in the order they are listed in
+// the help. Without a subcommand (or with only flags) the bot is run.
+var subcommands = []subcommand{
+	{"run", "[-login qr|code] [-phone n] [-qr-addr addr] [-log-level l]", "connect every linked account and handle commands (default)", runBot},
+	{"login", "[-login qr|code] [-phone n] [-qr-addr addr]", "link a new account by QR code or pairing code", runLogin},
+	{"logout", "[phone]", "log an account out and delete its session", runLogout},
+	{"send", "[-account phone] <jid|phone> <text>", `send a text message ("-" reads the text from stdin)`, runSend},
+	{"accounts", "[list | add [phone] | remove <phone>]", "list, link or remove accounts", runAccounts},
+	{"config", "check", "validate the configuration and the database connection", runConfig},
+	{"migrate", "[-status]", "upgrade the database, or show its version", runMigrate},
+	{"backup", "[-list]", "back up the session database, or list the backups", runBackup},
+	{"restore", "<backup>", "replace the session database with a backup (stop the bot first)", runRestore},
+	{"console", "", "try the commands in a local simulator", runConsole},
+	{"replay", "[-update] [-golden dir] <recording>...", "replay recorded events and compare the replies", runReplay},
+	{"version", "", "print the version and build information", runVersion},
+}
+
+// main is the primary function that starts the application. It runs the subcommand
+// named by the first argument; without one it runs the bot, see runBot.
+//
+// Exit status: 0 on success, 1 if the subcommand failed (for the bot: it failed to start,
+// lost its connection for good, or had to cancel running commands), and 2 for usage errors.
 func main() {
+	args := os.Args[1:]
+	if len(args) == 0 || (strings.HasPrefix(args[0], "-") && !isHelp(args[0])) {
+		os.Exit(runBot(args))
+	}
+	if isHelp(args[0]) {
+		usage(os.Stdout)
+		return
+	}
+
+	for _, cmd := range subcommands {
+		if cmd.name == args[0] {
+			os.Exit(cmd.run(args[1:]))
+		}
+	}
+	fmt.Fprintf(os.Stderr, "aemy: unknown command %q\n\n", args[0])
+	usage(os.Stderr)
+	os.Exit(2)
+}
+
+// isHelp reports whether arg asks for the help.
+func isHelp(arg string) bool {
+	return arg == "help" || arg == "-h" || arg == "-help" || arg == "--help"
+}
+
+// usage prints the list of subcommands to w.
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: aemy [command] [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+	for _, cmd := range subcommands {
+		fmt.Fprintf(w, "  %-9s %s\n", cmd.name, cmd.summary)
+		if cmd.usage != "" {
+			fmt.Fprintf(w, "  %-9s   aemy %s %s\n", "", cmd.name, cmd.usage)
+		}
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `Settings come from config/config.go; flags override them for one run, and the
+database can be chosen with AEMY_DATABASE_DIALECT and AEMY_DATABASE_URL.`)
+}
+
+// loginFlags adds the flags that override the login settings from config to flags.
+func loginFlags(flags *flag.FlagSet) {
+	flags.StringVar(&config.LoginMethod, "login", config.LoginMethod, `how to link a new session: "qr" or "code"`)
+	flags.StringVar(&config.PairPhone, "phone", config.PairPhone, "phone number for pairing-code login, in international format")
+	flags.StringVar(&config.QRAddr, "qr-addr", config.QRAddr, `serve the login QR code over HTTP on this address, e.g. "127.0.0.1:8080"`)
+}
+
+// logFlags adds the flags that override the logging settings from config to flags.
+func logFlags(flags *flag.FlagSet) {
+	flags.StringVar(&config.LogLevel, "log-level", config.LogLevel, `minimum severity that is logged: "debug", "info", "warn" or "error"`)
+}
+
+// runBot implements the run subcommand: it connects every linked account (linking a
+// first one if there is none) and handles commands until SIGINT or SIGTERM, then shuts
+// down gracefully, see shutdown. It returns the process exit code.
+func runBot(args []string) int {
+	// Flags override the login and logging settings from config.
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	loginFlags(flags)
+	logFlags(flags)
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "usage: aemy run [-login qr|code] [-phone n] [-qr-addr addr] [-log-level l]")
+		return 2
+	}
+	if err := client.CheckLogin(); err != nil {
+		fmt.Fprintln(os.Stderr, "Login configuration error:", err)
+		return 2
+	}
+
+	// Apply the logging configuration before anything is logged.
+	if err := utils.InitLogger(); err != nil {
+		utils.Error(fmt.Sprintf("Logger configuration error: %v", err))
+	}
+
 	// Initialize the WhatsApp client, which sets up the database connection,
 	// logs in, and registers the event handler.
-	client.Init()
+	if err := client.Init(); err != nil {
+		utils.Error(fmt.Sprintf("Startup failed: %v", err))
+		utils.CloseLogger()
+		return 1
+	}
 
 	// Create a channel to listen for termination signals.
 	// This allows the application to shut down cleanly when it receives
@@ -24,10 +146,61 @@ func main() {
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 
-	// Block execution until a signal is received on the 'stop' channel.
-	<-stop
+	// Block execution until a signal is received on the 'stop' channel,
+	// or the connection fails in a way the bot cannot recover from.
+	code := 0
+	select {
+	case <-stop:
+		utils.Info("Shutting down the bot.")
+	case err := <-client.Fatal():
+		utils.Error(fmt.Sprintf("Stopping: %v", err))
+		code = 1
+	}
+
+	// A second signal skips waiting for the running commands.
+	go func() {
+		<-stop
+		utils.Error("Forced shutdown.")
+		utils.CloseLogger()
+		os.Exit(1)
+	}()
+
+	if shutdown() != nil && code == 0 {
+		code = 1
+	}
+	return code
+}
+
+// shutdown stops the bot in order: no new commands are accepted, running commands and
+// the queued outgoing messages get config.ShutdownTimeout to finish (and are cancelled
+// after that), the accounts are disconnected, and the databases and the log file are closed.
+//
+// Returns:
+//   - error: if commands or messages had to be cancelled or the databases could not be closed cleanly
+func shutdown() error {
+	var err error
+	deadline := time.Now().Add(config.ShutdownTimeout)
+	if !handler.Drain(config.ShutdownTimeout) {
+		err = fmt.Errorf("commands still running after %s were cancelled", config.ShutdownTimeout)
+		utils.Warn(err.Error())
+	}
+
+	// Messages not sent by a command, e.g. notices to the owners, may still be queued
+	if !outbox.Drain(time.Until(deadline)) && err == nil {
+		err = fmt.Errorf("messages still queued after %s were dropped", config.ShutdownTimeout)
+		utils.Warn(err.Error())
+	}
+	stats := outbox.Totals()
+	utils.Info(fmt.Sprintf("Sent %d messages (%d failed, %d retried, %d dropped).", stats.Sent, stats.Failed, stats.Retried, stats.Cancelled))
+
+	client.Disconnect()
+	if closeErr := client.Close(); closeErr != nil {
+		utils.Error(fmt.Sprintf("Failed to close the database: %v", closeErr))
+		if err == nil {
+			err = closeErr
+		}
+	}
 
-	// Once a signal is received, log a shutdown message and disconnect the client.
-	fmt.Println("Shutting down the bot.")
-	client.WhatsAppClient.Disconnect()
+	utils.CloseLogger()
+	return err
 }
@@ -0,0 +1,60 @@
+// Package outbox queues the messages the bot sends and paces them, see Queue.
+// This file, bucket.go, implements the token buckets the queue is limited by.
+package outbox
+
+import "time"
+
+// bucket is a token bucket: it holds up to burst tokens and gains rate tokens per
+// second. Sending a message takes one token. A rate of zero or less means no limit.
+type bucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newBucket returns a full bucket.
+func newBucket(rate float64, burst int, now time.Time) *bucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &bucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: now}
+}
+
+// refill adds the tokens gained since the last refill.
+func (b *bucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = min(b.burst, b.tokens+elapsed*b.rate)
+	}
+	b.last = now
+}
+
+// wait returns how long until a token is available, 0 if one is available now.
+func (b *bucket) wait(now time.Time) time.Duration {
+	if b.rate <= 0 {
+		return 0
+	}
+	b.refill(now)
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// take takes a token. The caller must have checked that one is available.
+func (b *bucket) take(now time.Time) {
+	if b.rate <= 0 {
+		return
+	}
+	b.refill(now)
+	b.tokens--
+}
+
+// full reports whether the bucket is full, i.e. it limits nothing and can be dropped.
+func (b *bucket) full(now time.Time) bool {
+	if b.rate <= 0 {
+		return true
+	}
+	b.refill(now)
+	return b.tokens >= b.burst
+}
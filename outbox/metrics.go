@@ -0,0 +1,141 @@
+// Package outbox queues the messages the bot sends and paces them.
+// This file, metrics.go, keeps track of the running queues for metrics and shutdown.
+package outbox
+
+import (
+	"sync"
+	"time"
+)
+
+// Stats are the metrics of a queue, or of all queues (see Totals).
+type Stats struct {
+	// Queued counts the messages queued so far.
+	Queued int
+
+	// Sent and Failed count the messages that were sent, or failed for good.
+	Sent   int
+	Failed int
+
+	// Retried counts the sends that were tried again after a transient failure.
+	Retried int
+
+	// Cancelled counts the messages dropped before they were sent, because their
+	// context was done or the queue was closed.
+	Cancelled int
+
+	// Throttled counts the messages that were ready to be sent but had to wait for the
+	// account's rate limit.
+	Throttled int
+
+	// Pending and InFlight are the messages queued and being sent right now.
+	Pending  int
+	InFlight int
+
+	// TotalWait and MaxWait are the total and longest time sent messages spent
+	// between being queued and sent.
+	TotalWait time.Duration
+	MaxWait   time.Duration
+}
+
+// AverageWait returns the average time sent messages spent in the queue.
+func (s Stats) AverageWait() time.Duration {
+	if s.Sent == 0 {
+		return 0
+	}
+	return s.TotalWait / time.Duration(s.Sent)
+}
+
+// add adds the metrics of other to s.
+func (s *Stats) add(other Stats) {
+	s.Queued += other.Queued
+	s.Sent += other.Sent
+	s.Failed += other.Failed
+	s.Retried += other.Retried
+	s.Cancelled += other.Cancelled
+	s.Throttled += other.Throttled
+	s.Pending += other.Pending
+	s.InFlight += other.InFlight
+	s.TotalWait += other.TotalWait
+	s.MaxWait = max(s.MaxWait, other.MaxWait)
+}
+
+var (
+	// queuesMu guards queues, the queues that are not closed yet, and closedStats,
+	// the metrics of the closed ones.
+	queuesMu    sync.Mutex
+	queues      = map[*Queue]bool{}
+	closedStats Stats
+)
+
+// register adds a new queue to the running queues.
+func register(q *Queue) {
+	queuesMu.Lock()
+	defer queuesMu.Unlock()
+	queues[q] = true
+}
+
+// unregister removes a closed queue, keeping its metrics in the totals.
+func unregister(q *Queue) {
+	stats := q.Stats()
+	queuesMu.Lock()
+	defer queuesMu.Unlock()
+	if queues[q] {
+		delete(queues, q)
+		closedStats.add(stats)
+		closedStats.Pending, closedStats.InFlight = 0, 0
+	}
+}
+
+// running returns the queues that are not closed yet.
+func running() []*Queue {
+	queuesMu.Lock()
+	defer queuesMu.Unlock()
+	result := make([]*Queue, 0, len(queues))
+	for q := range queues {
+		result = append(result, q)
+	}
+	return result
+}
+
+// Totals returns the metrics of all queues since the bot started.
+func Totals() Stats {
+	queuesMu.Lock()
+	total := closedStats
+	queuesMu.Unlock()
+	for _, q := range running() {
+		total.add(q.Stats())
+	}
+	return total
+}
+
+// Drain waits until every queue has sent its messages. Messages queued during the wait
+// are sent too. If the queues are not empty within timeout, they are closed and the
+// remaining messages fail with ErrClosed.
+//
+// Parameters:
+//   - timeout: how long to wait
+//
+// Returns:
+//   - bool: true if every message was sent (or failed) on its own
+func Drain(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		idle := true
+		for _, q := range running() {
+			if !q.idle() {
+				idle = false
+				break
+			}
+		}
+		if idle {
+			return true
+		}
+		if time.Now().After(deadline) {
+			for _, q := range running() {
+				q.Close()
+			}
+			return false
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
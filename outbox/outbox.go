@@ -0,0 +1,455 @@
+// Package outbox queues the messages the bot sends and paces them, so that bursts
+// (albums, broadcasts, many commands at once) do not get the account banned. Every
+// account has a Queue, limited by a token bucket for the whole account and one per chat
+// (see config.OutboxRate). Messages are sent by priority, replies first, and sent again
+// after transient failures.
+package outbox
+
+import (
+	"aemy/config"
+	"context"
+	"errors"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	waLog "go.mau.fi/whatsmeow/util/log"
+)
+
+const (
+	// retryDelay is the wait before the first retry; it doubles for every further attempt.
+	retryDelay = time.Second
+
+	// maxChats is how many chat buckets a queue keeps before dropping the full ones.
+	maxChats = 256
+)
+
+// ErrClosed is returned for messages that were still queued when the queue was closed.
+var ErrClosed = errors.New("outbox closed")
+
+// Priority orders the queued messages: higher priorities are sent first.
+type Priority int
+
+// Priorities, from lowest to highest.
+const (
+	// Low is for bulk messages such as broadcasts.
+	Low Priority = iota
+
+	// Normal is the default, e.g. for notices to the owners.
+	Normal
+
+	// High is for replies to commands, which someone is waiting for.
+	High
+)
+
+// priorityKey is the context key of the priority.
+type priorityKey struct{}
+
+// WithPriority returns a context whose messages are queued with priority p.
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// PriorityFrom returns the priority set with WithPriority, Normal if none was set.
+func PriorityFrom(ctx context.Context) Priority {
+	if p, ok := ctx.Value(priorityKey{}).(Priority); ok {
+		return p
+	}
+	return Normal
+}
+
+// SendFunc sends a message right away, like (*whatsmeow.Client).SendMessage.
+type SendFunc func(ctx context.Context, to types.JID, message *waE2E.Message, extra ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error)
+
+// IDFunc generates a message ID, like (*whatsmeow.Client).GenerateMessageID.
+type IDFunc func() types.MessageID
+
+// Limits are the rates a queue sends at, see config.OutboxRate.
+type Limits struct {
+	Rate      float64
+	Burst     int
+	ChatRate  float64
+	ChatBurst int
+	Retries   int
+}
+
+// DefaultLimits returns the limits from config.
+func DefaultLimits() Limits {
+	return Limits{
+		Rate:      config.OutboxRate,
+		Burst:     config.OutboxBurst,
+		ChatRate:  config.OutboxChatRate,
+		ChatBurst: config.OutboxChatBurst,
+		Retries:   config.OutboxRetries,
+	}
+}
+
+// job is a queued message.
+type job struct {
+	ctx      context.Context
+	to       types.JID
+	message  *waE2E.Message
+	extra    []whatsmeow.SendRequestExtra
+	priority Priority
+	seq      uint64
+	queued   time.Time
+
+	// attempt counts the failed sends; notBefore delays the next one.
+	attempt   int
+	notBefore time.Time
+
+	// retrying is set while the message waits to be sent again; see Queue.retrying.
+	retrying bool
+
+	// throttled is set once the message had to wait for the account's rate limit, so
+	// that it is only counted once in Stats.Throttled.
+	throttled bool
+
+	result chan result
+}
+
+// result is the outcome of a job.
+type result struct {
+	resp whatsmeow.SendResponse
+	err  error
+}
+
+// Queue sends the messages of one account in priority order, within its limits. Only
+// one message per chat is sent at a time, and a message waiting to be sent again after
+// a failure holds back the later ones, so messages to a chat keep their order.
+type Queue struct {
+	send   SendFunc
+	newID  IDFunc
+	limits Limits
+	log    waLog.Logger
+
+	mu       sync.Mutex
+	pending  []*job // sorted by priority, then by seq
+	global   *bucket
+	chats    map[types.JID]*bucket
+	busy     map[types.JID]bool
+	retrying map[types.JID]bool // chats with a message waiting to be sent again
+	inflight int
+	seq      uint64
+	closed   bool
+	stats    Stats
+
+	wake chan struct{}
+	done chan struct{}
+}
+
+// New creates a queue sending with send and starts it. Close it when the account is
+// no longer used.
+//
+// Parameters:
+//   - send: sends a message right away
+//   - newID: generates the ID of messages queued without one, so that every attempt to
+//     send a message uses the same ID and WhatsApp drops duplicates of a retried send
+//   - limits: the rates to send at, usually DefaultLimits()
+//   - log: where retries and failures are logged
+//
+// Returns:
+//   - *Queue: the running queue
+func New(send SendFunc, newID IDFunc, limits Limits, log waLog.Logger) *Queue {
+	q := &Queue{
+		send:     send,
+		newID:    newID,
+		limits:   limits,
+		log:      log,
+		global:   newBucket(limits.Rate, limits.Burst, time.Now()),
+		chats:    map[types.JID]*bucket{},
+		busy:     map[types.JID]bool{},
+		retrying: map[types.JID]bool{},
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	register(q)
+	go q.run()
+	return q
+}
+
+// Send queues a message and waits until it is sent. It has the signature of
+// (*whatsmeow.Client).SendMessage; the priority is taken from ctx (see WithPriority).
+//
+// Returns:
+//   - whatsmeow.SendResponse: the response of the successful send
+//   - error: the error of the last attempt, ctx.Err() if ctx was done first, or ErrClosed
+func (q *Queue) Send(ctx context.Context, to types.JID, message *waE2E.Message, extra ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error) {
+	// The ID is fixed before the first attempt, so that retries send the same message
+	extra = append([]whatsmeow.SendRequestExtra(nil), extra...)
+	if len(extra) == 0 {
+		extra = append(extra, whatsmeow.SendRequestExtra{})
+	}
+	if extra[0].ID == "" {
+		extra[0].ID = q.newID()
+	}
+
+	j := &job{
+		ctx:      ctx,
+		to:       to,
+		message:  message,
+		extra:    extra,
+		priority: PriorityFrom(ctx),
+		queued:   time.Now(),
+		result:   make(chan result, 1),
+	}
+
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return whatsmeow.SendResponse{}, ErrClosed
+	}
+	q.seq++
+	j.seq = q.seq
+	q.push(j)
+	q.stats.Queued++
+	q.mu.Unlock()
+	q.signal()
+
+	select {
+	case r := <-j.result:
+		return r.resp, r.err
+	case <-ctx.Done():
+		q.mu.Lock()
+		removed := q.remove(j)
+		if removed {
+			q.stats.Cancelled++
+			q.unblock(j)
+		}
+		q.mu.Unlock()
+		if removed {
+			q.signal()
+			return whatsmeow.SendResponse{}, ctx.Err()
+		}
+		// Already being sent: the send sees the cancelled context too
+		r := <-j.result
+		return r.resp, r.err
+	}
+}
+
+// Close stops the queue. Messages still queued fail with ErrClosed; a message being
+// sent is finished.
+func (q *Queue) Close() {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return
+	}
+	q.closed = true
+	pending := q.pending
+	q.pending = nil
+	q.retrying = map[types.JID]bool{}
+	q.stats.Cancelled += len(pending)
+	q.mu.Unlock()
+
+	close(q.done)
+	unregister(q)
+	for _, j := range pending {
+		j.result <- result{err: ErrClosed}
+	}
+}
+
+// Stats returns the metrics of the queue.
+func (q *Queue) Stats() Stats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	stats := q.stats
+	stats.Pending = len(q.pending)
+	stats.InFlight = q.inflight
+	return stats
+}
+
+// idle reports whether no message is queued or being sent.
+func (q *Queue) idle() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending) == 0 && q.inflight == 0
+}
+
+// signal wakes up the dispatcher.
+func (q *Queue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run dispatches the queued messages until the queue is closed.
+func (q *Queue) run() {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		q.mu.Lock()
+		now := time.Now()
+		j, wait := q.next(now)
+		if j != nil {
+			q.remove(j)
+			q.unblock(j)
+			q.global.take(now)
+			q.chat(j.to, now).take(now)
+			q.busy[j.to] = true
+			q.inflight++
+			q.mu.Unlock()
+			go q.deliver(j)
+			continue
+		}
+		q.mu.Unlock()
+
+		// Sleep until a token is due or something changes
+		if wait <= 0 {
+			wait = time.Hour
+		}
+		timer.Reset(wait)
+		select {
+		case <-q.wake:
+		case <-timer.C:
+		case <-q.done:
+			return
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+	}
+}
+
+// next returns the first message that may be sent now. Otherwise it returns how long
+// until one may be sent, or 0 if that depends on a send in progress or a new message.
+// q.mu must be held.
+func (q *Queue) next(now time.Time) (*job, time.Duration) {
+	if len(q.pending) == 0 {
+		return nil, 0
+	}
+
+	var soonest time.Duration
+	later := func(d time.Duration) {
+		if soonest == 0 || d < soonest {
+			soonest = d
+		}
+	}
+	for _, j := range q.pending {
+		// Later messages to a chat wait for the one being sent or retried
+		if q.busy[j.to] || (q.retrying[j.to] && !j.retrying) {
+			continue
+		}
+		if j.notBefore.After(now) {
+			later(j.notBefore.Sub(now))
+			continue
+		}
+		if wait := q.chat(j.to, now).wait(now); wait > 0 {
+			later(wait)
+			continue
+		}
+		if wait := q.global.wait(now); wait > 0 {
+			if !j.throttled {
+				j.throttled = true
+				q.stats.Throttled++
+			}
+			return nil, wait
+		}
+		return j, 0
+	}
+	return nil, soonest
+}
+
+// deliver sends j and reports the result, or queues it again after a transient failure.
+func (q *Queue) deliver(j *job) {
+	resp, err := q.send(j.ctx, j.to, j.message, j.extra...)
+
+	q.mu.Lock()
+	delete(q.busy, j.to)
+	q.inflight--
+	if err != nil && transient(err) && j.attempt < q.limits.Retries && j.ctx.Err() == nil && !q.closed {
+		j.attempt++
+		delay := retryDelay << (j.attempt - 1)
+		delay += time.Duration(rand.Int63n(int64(delay)/5 + 1))
+		j.notBefore = time.Now().Add(delay)
+		j.retrying = true
+		q.retrying[j.to] = true
+		q.push(j)
+		q.stats.Retried++
+		q.mu.Unlock()
+		q.log.Warnf("Sending to %s failed (%v), retrying in %s", j.to, err, delay.Round(time.Millisecond))
+		q.signal()
+		return
+	}
+
+	if err != nil {
+		q.stats.Failed++
+	} else {
+		q.stats.Sent++
+		wait := time.Since(j.queued)
+		q.stats.TotalWait += wait
+		q.stats.MaxWait = max(q.stats.MaxWait, wait)
+	}
+	q.mu.Unlock()
+	q.signal()
+	j.result <- result{resp: resp, err: err}
+}
+
+// push inserts j into the pending messages, after those of the same or higher priority
+// queued before it. q.mu must be held.
+func (q *Queue) push(j *job) {
+	i := sort.Search(len(q.pending), func(i int) bool {
+		p := q.pending[i]
+		return p.priority < j.priority || (p.priority == j.priority && p.seq > j.seq)
+	})
+	q.pending = append(q.pending, nil)
+	copy(q.pending[i+1:], q.pending[i:])
+	q.pending[i] = j
+}
+
+// unblock lets the messages queued after j to the same chat be sent, if j was waiting to
+// be sent again. q.mu must be held.
+func (q *Queue) unblock(j *job) {
+	if j.retrying {
+		j.retrying = false
+		delete(q.retrying, j.to)
+	}
+}
+
+// remove removes j from the pending messages. q.mu must be held.
+//
+// Returns:
+//   - bool: false if j was not pending, i.e. it is being sent or done
+func (q *Queue) remove(j *job) bool {
+	for i, p := range q.pending {
+		if p == j {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// chat returns the bucket of a chat, creating it if needed. q.mu must be held.
+func (q *Queue) chat(jid types.JID, now time.Time) *bucket {
+	if b, ok := q.chats[jid]; ok {
+		return b
+	}
+	if len(q.chats) >= maxChats {
+		for other, b := range q.chats {
+			if !q.busy[other] && b.full(now) {
+				delete(q.chats, other)
+			}
+		}
+	}
+	b := newBucket(q.limits.ChatRate, q.limits.ChatBurst, now)
+	q.chats[jid] = b
+	return b
+}
+
+// transient reports whether a send that failed with err may succeed if tried again.
+func transient(err error) bool {
+	var disconnected *whatsmeow.DisconnectedError
+	return errors.Is(err, whatsmeow.ErrIQTimedOut) ||
+		errors.Is(err, whatsmeow.ErrMessageTimedOut) ||
+		errors.Is(err, whatsmeow.ErrNotConnected) ||
+		errors.As(err, &disconnected)
+}
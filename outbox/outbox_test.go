@@ -0,0 +1,128 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	waLog "go.mau.fi/whatsmeow/util/log"
+	"google.golang.org/protobuf/proto"
+)
+
+// counter generates the message IDs "ID1", "ID2", ...
+type counter struct {
+	mu sync.Mutex
+	n  int
+}
+
+func (c *counter) next() types.MessageID {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.n++
+	return fmt.Sprintf("ID%d", c.n)
+}
+
+func TestRetryKeepsMessageID(t *testing.T) {
+	var ids []types.MessageID
+	send := func(ctx context.Context, to types.JID, message *waE2E.Message, extra ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error) {
+		ids = append(ids, extra[0].ID)
+		if len(ids) == 1 {
+			return whatsmeow.SendResponse{}, whatsmeow.ErrIQTimedOut
+		}
+		return whatsmeow.SendResponse{ID: extra[0].ID}, nil
+	}
+	q := New(send, (&counter{}).next, Limits{Retries: 1}, waLog.Noop)
+	defer q.Close()
+
+	resp, err := q.Send(context.Background(), types.NewJID("1", types.DefaultUserServer), &waE2E.Message{})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if len(ids) != 2 || ids[0] != ids[1] || ids[0] == "" {
+		t.Fatalf("attempts used IDs %q, want the same ID twice", ids)
+	}
+	if resp.ID != ids[0] {
+		t.Errorf("response ID = %q, want %q", resp.ID, ids[0])
+	}
+	if stats := q.Stats(); stats.Retried != 1 || stats.Sent != 1 {
+		t.Errorf("stats = %+v, want 1 retry and 1 sent", stats)
+	}
+
+	// An ID chosen by the caller is kept
+	resp, err = q.Send(context.Background(), types.NewJID("1", types.DefaultUserServer), &waE2E.Message{}, whatsmeow.SendRequestExtra{ID: "MINE"})
+	if err != nil || resp.ID != "MINE" {
+		t.Errorf("Send with an ID: %q, %v; want MINE", resp.ID, err)
+	}
+}
+
+func TestThrottledCountsMessagesOnce(t *testing.T) {
+	send := func(ctx context.Context, to types.JID, message *waE2E.Message, extra ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error) {
+		return whatsmeow.SendResponse{ID: extra[0].ID}, nil
+	}
+	q := New(send, (&counter{}).next, Limits{Rate: 10, Burst: 1}, waLog.Noop)
+	defer q.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			to := types.NewJID(fmt.Sprint(i+1), types.DefaultUserServer)
+			if _, err := q.Send(context.Background(), to, &waE2E.Message{}); err != nil {
+				t.Errorf("Send: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// The first message takes the only token; each of the other two waits once
+	if stats := q.Stats(); stats.Throttled != 2 {
+		t.Errorf("throttled = %d, want 2", stats.Throttled)
+	}
+}
+
+func TestRetryKeepsChatOrder(t *testing.T) {
+	var mu sync.Mutex
+	var order []string
+	first := make(chan struct{})
+	send := func(ctx context.Context, to types.JID, message *waE2E.Message, extra ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, message.GetConversation())
+		if len(order) == 1 {
+			close(first)
+			// Give the second message time to be queued behind the first
+			time.Sleep(50 * time.Millisecond)
+			return whatsmeow.SendResponse{}, whatsmeow.ErrIQTimedOut
+		}
+		return whatsmeow.SendResponse{ID: extra[0].ID}, nil
+	}
+	q := New(send, (&counter{}).next, Limits{Retries: 1}, waLog.Noop)
+	defer q.Close()
+
+	chat := types.NewJID("1", types.DefaultUserServer)
+	var wg sync.WaitGroup
+	for i, text := range []string{"first", "second"} {
+		if i > 0 {
+			<-first
+		}
+		wg.Add(1)
+		go func(text string) {
+			defer wg.Done()
+			if _, err := q.Send(context.Background(), chat, &waE2E.Message{Conversation: proto.String(text)}); err != nil {
+				t.Errorf("Send(%s): %v", text, err)
+			}
+		}(text)
+	}
+	wg.Wait()
+
+	want := []string{"first", "first", "second"}
+	if fmt.Sprint(order) != fmt.Sprint(want) {
+		t.Errorf("send order = %q, want %q", order, want)
+	}
+}
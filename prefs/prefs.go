@@ -0,0 +1,134 @@
+// Package prefs stores per-user and per-chat preferences such as the timezone.
+// Preferences are kept in the bot's database when the client is running and in
+// memory otherwise (e.g. in the console simulator).
+package prefs
+
+import (
+	"sync"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Preference keys.
+const (
+	// KeyTimezone is the IANA name or UTC offset of a user's or chat's timezone.
+	KeyTimezone = "timezone"
+
+	// KeyLanguage is the code of the language a user or chat gets replies in.
+	KeyLanguage = "language"
+)
+
+// Store persists preferences. A preference is a string value stored under a key for a
+// user or chat JID; an empty value means the preference is not set.
+type Store interface {
+	// Get returns the value of key for jid, or "" if it is not set.
+	Get(jid types.JID, key string) (string, error)
+
+	// Set stores value under key for jid. An empty value removes the preference.
+	Set(jid types.JID, key, value string) error
+}
+
+// cacheSize is the number of values Get keeps in memory before it starts over.
+const cacheSize = 10000
+
+var (
+	// mutex guards current, the store used by Get and Set, and cache, the values read
+	// from it. Every message looks up several preferences, so they are only read from
+	// the store once; generation changes with every Set, so that a value read before a
+	// Set finished is not cached.
+	mutex      sync.RWMutex
+	current    Store = NewMemoryStore()
+	cache            = map[string]string{}
+	generation uint64
+)
+
+// Use makes s the store used by Get and Set.
+func Use(s Store) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	current = s
+	cache = map[string]string{}
+	generation++
+}
+
+// cacheKey returns the key under which the value of key for jid is kept in memory.
+func cacheKey(jid types.JID, key string) string {
+	return jid.String() + "\x00" + key
+}
+
+// Get returns the value of key for jid from the current store, or "" if it is not set
+// or cannot be read. Values are cached, including unset ones, until they are Set.
+func Get(jid types.JID, key string) string {
+	jid = jid.ToNonAD()
+	k := cacheKey(jid, key)
+
+	mutex.RLock()
+	value, ok := cache[k]
+	s, gen := current, generation
+	mutex.RUnlock()
+	if ok {
+		return value
+	}
+
+	value, err := s.Get(jid, key)
+	if err != nil {
+		return ""
+	}
+
+	mutex.Lock()
+	if generation == gen {
+		if len(cache) >= cacheSize {
+			cache = map[string]string{}
+		}
+		cache[k] = value
+	}
+	mutex.Unlock()
+	return value
+}
+
+// Set stores value under key for jid in the current store. An empty value removes it.
+func Set(jid types.JID, key, value string) error {
+	jid = jid.ToNonAD()
+
+	mutex.RLock()
+	s := current
+	mutex.RUnlock()
+
+	err := s.Set(jid, key, value)
+
+	mutex.Lock()
+	delete(cache, cacheKey(jid, key))
+	generation++
+	mutex.Unlock()
+	return err
+}
+
+// MemoryStore keeps preferences in memory. It is safe for concurrent use.
+type MemoryStore struct {
+	mu     sync.RWMutex
+	values map[string]string
+}
+
+// NewMemoryStore returns an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{values: make(map[string]string)}
+}
+
+// Get implements Store.
+func (s *MemoryStore) Get(jid types.JID, key string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.values[cacheKey(jid, key)], nil
+}
+
+// Set implements Store.
+func (s *MemoryStore) Set(jid types.JID, key, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if value == "" {
+		delete(s.values, cacheKey(jid, key))
+	} else {
+		s.values[cacheKey(jid, key)] = value
+	}
+	return nil
+}
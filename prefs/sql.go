@@ -0,0 +1,53 @@
+// Package prefs stores per-user and per-chat preferences.
+// This file, sql.go, implements the database-backed store.
+package prefs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// SQLStore keeps preferences in the aemy_preferences table, which is created by
+// database.Migrate. The queries work on both SQLite and PostgreSQL.
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore returns a store backed by db.
+//
+// Parameters:
+//   - db: an open, migrated database, usually the one holding the WhatsApp session
+//
+// Returns:
+//   - *SQLStore: the store
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// Get implements Store.
+func (s *SQLStore) Get(jid types.JID, key string) (string, error) {
+	var value string
+	err := s.db.QueryRowContext(context.Background(),
+		`SELECT value FROM aemy_preferences WHERE jid = $1 AND key = $2`, jid.String(), key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return value, err
+}
+
+// Set implements Store.
+func (s *SQLStore) Set(jid types.JID, key, value string) error {
+	var err error
+	if value == "" {
+		_, err = s.db.ExecContext(context.Background(),
+			`DELETE FROM aemy_preferences WHERE jid = $1 AND key = $2`, jid.String(), key)
+	} else {
+		_, err = s.db.ExecContext(context.Background(),
+			`INSERT INTO aemy_preferences (jid, key, value) VALUES ($1, $2, $3)
+			ON CONFLICT (jid, key) DO UPDATE SET value = excluded.value`, jid.String(), key, value)
+	}
+	return err
+}
@@ -0,0 +1,84 @@
+package prefs_test
+
+import (
+	"aemy/database"
+	"aemy/database/databasetest"
+	"aemy/prefs"
+	"context"
+	"database/sql"
+	"testing"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+func TestSQLStore(t *testing.T) {
+	databasetest.Each(t, func(t *testing.T, db *sql.DB, dialect string) {
+		if _, err := database.Migrate(context.Background(), db, dialect); err != nil {
+			t.Fatal(err)
+		}
+		store := prefs.NewSQLStore(db)
+		user := types.NewJID("6280000000001", types.DefaultUserServer)
+		group := types.NewJID("120363000000000001", types.GroupServer)
+
+		get := func(jid types.JID, key, want string) {
+			t.Helper()
+			got, err := store.Get(jid, key)
+			if err != nil {
+				t.Fatalf("Get(%s, %s): %v", jid, key, err)
+			}
+			if got != want {
+				t.Errorf("Get(%s, %s) = %q, want %q", jid, key, got, want)
+			}
+		}
+		set := func(jid types.JID, key, value string) {
+			t.Helper()
+			if err := store.Set(jid, key, value); err != nil {
+				t.Fatalf("Set(%s, %s, %q): %v", jid, key, value, err)
+			}
+		}
+
+		get(user, prefs.KeyTimezone, "")
+
+		set(user, prefs.KeyTimezone, "Asia/Jakarta")
+		set(group, prefs.KeyTimezone, "UTC+7")
+		get(user, prefs.KeyTimezone, "Asia/Jakarta")
+		get(group, prefs.KeyTimezone, "UTC+7")
+		get(user, prefs.KeyLanguage, "")
+
+		// Setting a value again replaces it
+		set(user, prefs.KeyTimezone, "Europe/Berlin")
+		get(user, prefs.KeyTimezone, "Europe/Berlin")
+
+		// An empty value removes the preference
+		set(user, prefs.KeyTimezone, "")
+		get(user, prefs.KeyTimezone, "")
+		get(group, prefs.KeyTimezone, "UTC+7")
+	})
+}
+
+func TestGetSetThroughSQLStore(t *testing.T) {
+	db := databasetest.SQLite(t)
+	if _, err := database.Migrate(context.Background(), db, database.SQLite); err != nil {
+		t.Fatal(err)
+	}
+	prefs.Use(prefs.NewSQLStore(db))
+	t.Cleanup(func() { prefs.Use(prefs.NewMemoryStore()) })
+
+	user := types.NewJID("6280000000001", types.DefaultUserServer)
+	if got := prefs.Get(user, prefs.KeyLanguage); got != "" {
+		t.Fatalf("language = %q before it was set", got)
+	}
+	// The unset value was cached; Set must replace it
+	if err := prefs.Set(user, prefs.KeyLanguage, "id"); err != nil {
+		t.Fatal(err)
+	}
+	if got := prefs.Get(user, prefs.KeyLanguage); got != "id" {
+		t.Errorf("language = %q, want id", got)
+	}
+
+	// A new store starts without the cached values of the old one
+	prefs.Use(prefs.NewSQLStore(db))
+	if got := prefs.Get(user, prefs.KeyLanguage); got != "id" {
+		t.Errorf("language read from the database = %q, want id", got)
+	}
+}
@@ -0,0 +1,348 @@
+// Package replay records incoming message events to a file and replays them through
+// handler.EventHandler against a utilstest.FakeClient, comparing what the bot sends with
+// golden files. It makes bugs seen in production reproducible without a phone.
+//
+// A recording starts with a one-line text header followed by length-delimited
+// waWeb.WebMessageInfo protobuf records, one per incoming message.
+package replay
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waCommon"
+	"go.mau.fi/whatsmeow/proto/waWeb"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/encoding/protodelim"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// magic starts the header line of every recording.
+const magic = "AEMYREC1"
+
+// header describes a recording. It is stored as JSON after the magic on the first line.
+type header struct {
+	// Redacted is true if phone numbers and push names were replaced with pseudonyms.
+	Redacted bool `json:"redacted"`
+
+	// Own is the bot account the events were received on (redacted if Redacted).
+	Own string `json:"own,omitempty"`
+}
+
+var (
+	// jidPattern matches the user part of personal JIDs in any string field, with or
+	// without a device part, e.g. 6281234567890:12@s.whatsapp.net.
+	jidPattern = regexp.MustCompile(`\b(\d{5,20})((?::\d+)?(?:@s\.whatsapp\.net|@c\.us|@lid))`)
+
+	// mentionPattern matches @mentions in message text.
+	mentionPattern = regexp.MustCompile(`@(\d{5,20})\b`)
+
+	// vcardPattern matches the phone number attributes of shared contacts.
+	vcardPattern = regexp.MustCompile(`(waid=)(\d{5,20})|(TEL[^:\n]*:)\+?[\d \-()]{5,25}`)
+)
+
+// Recorder appends incoming message events to a recording file.
+// It is safe for concurrent use.
+type Recorder struct {
+	mu     sync.Mutex
+	file   *os.File
+	redact bool
+	empty  bool
+}
+
+// NewRecorder opens path for recording, creating it if needed. Appending to an existing
+// recording is allowed as long as its redaction setting matches.
+//
+// Parameters:
+//   - path: the recording file
+//   - redact: replace phone numbers and push names with pseudonyms (see RedactNumber)
+//
+// Returns:
+//   - *Recorder: the recorder
+//   - error: if the file cannot be opened or was recorded with a different redaction setting
+func NewRecorder(path string, redact bool) (*Recorder, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if stat.Size() > 0 {
+		h, err := readHeader(bufio.NewReader(io.NewSectionReader(file, 0, stat.Size())))
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		if h.Redacted != redact {
+			file.Close()
+			return nil, fmt.Errorf("%s was recorded with redaction %v", path, h.Redacted)
+		}
+	}
+
+	return &Recorder{file: file, redact: redact, empty: stat.Size() == 0}, nil
+}
+
+// Record appends evt to the recording.
+//
+// Parameters:
+//   - evt: the incoming message event, as received from whatsmeow
+//   - own: the JID of the bot account that received it
+//
+// Returns:
+//   - error: if the event cannot be written
+func (r *Recorder) Record(evt *events.Message, own types.JID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.empty {
+		h := header{Redacted: r.redact, Own: own.ToNonAD().String()}
+		if r.redact && !own.IsEmpty() {
+			h.Own = types.NewJID(RedactNumber(own.User), own.Server).String()
+		}
+		line, _ := json.Marshal(h)
+		if _, err := fmt.Fprintf(r.file, "%s %s\n", magic, line); err != nil {
+			return err
+		}
+		r.empty = false
+	}
+
+	info := encodeEvent(evt)
+	if r.redact {
+		// The message is shared with the live handlers, so redact a copy
+		info = proto.Clone(info).(*waWeb.WebMessageInfo)
+		info.Key.RemoteJID = proto.String(redactJID(evt.Info.Chat).String())
+		info.Key.Participant = proto.String(redactJID(evt.Info.Sender).String())
+		redactMessage(info)
+	}
+	_, err := protodelim.MarshalTo(r.file, info)
+	return err
+}
+
+// Close closes the recording file.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.file.Close()
+}
+
+// RedactNumber returns a stable pseudonym for a phone number or LID. The pseudonym starts
+// with 0, which no real number does, and is the same every time so that conversations
+// and owner checks keep working in replays.
+//
+// Parameters:
+//   - number: the user part of a JID
+//
+// Returns:
+//   - string: a 13-digit pseudonym
+func RedactNumber(number string) string {
+	if strings.HasPrefix(number, "0") && len(number) == 13 {
+		// Already a pseudonym
+		return number
+	}
+	sum := sha256.Sum256([]byte("aemy-replay:" + number))
+	return fmt.Sprintf("0%012d", binary.BigEndian.Uint64(sum[:8])%1_000_000_000_000)
+}
+
+// redactJID returns jid with its user replaced by RedactNumber if it is a person (phone
+// number or LID). The device is kept, so messages from linked devices stay apart.
+func redactJID(jid types.JID) types.JID {
+	if jid.Server != types.DefaultUserServer && jid.Server != types.HiddenUserServer && jid.Server != types.LegacyUserServer {
+		return jid
+	}
+	redacted := jid.ToNonAD()
+	redacted.User = RedactNumber(redacted.User)
+	redacted.Device = jid.Device
+	return redacted
+}
+
+// redactName returns a stable pseudonym for a push name.
+func redactName(name string) string {
+	if name == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte("aemy-replay:" + name))
+	return "User " + hex.EncodeToString(sum[:3])
+}
+
+// encodeEvent converts a message event to the protobuf stored in recordings.
+// The raw message is kept, so ephemeral and view-once wrappers survive a replay.
+func encodeEvent(evt *events.Message) *waWeb.WebMessageInfo {
+	message := evt.RawMessage
+	if message == nil {
+		message = evt.Message
+	}
+
+	return &waWeb.WebMessageInfo{
+		Key: &waCommon.MessageKey{
+			RemoteJID:   proto.String(evt.Info.Chat.String()),
+			FromMe:      proto.Bool(evt.Info.IsFromMe),
+			ID:          proto.String(evt.Info.ID),
+			Participant: proto.String(evt.Info.Sender.String()),
+		},
+		Message:          message,
+		MessageTimestamp: proto.Uint64(uint64(evt.Info.Timestamp.Unix())),
+		PushName:         proto.String(evt.Info.PushName),
+	}
+}
+
+// decodeEvent converts a recorded protobuf back to a message event.
+func decodeEvent(info *waWeb.WebMessageInfo) (*events.Message, error) {
+	chat, err := types.ParseJID(info.GetKey().GetRemoteJID())
+	if err != nil {
+		return nil, err
+	}
+	sender, err := types.ParseJID(info.GetKey().GetParticipant())
+	if err != nil {
+		return nil, err
+	}
+
+	evt := &events.Message{
+		Info: types.MessageInfo{
+			MessageSource: types.MessageSource{
+				Chat:     chat,
+				Sender:   sender,
+				IsFromMe: info.GetKey().GetFromMe(),
+				IsGroup:  chat.Server == types.GroupServer,
+			},
+			ID:        info.GetKey().GetID(),
+			PushName:  info.GetPushName(),
+			Timestamp: time.Unix(int64(info.GetMessageTimestamp()), 0),
+		},
+		RawMessage: info.GetMessage(),
+	}
+	return evt.UnwrapRaw(), nil
+}
+
+// redactMessage replaces phone numbers and push names in a recorded event, including
+// JIDs and mentions nested anywhere in the message (quotes, captions, contacts).
+func redactMessage(info *waWeb.WebMessageInfo) {
+	info.PushName = proto.String(redactName(info.GetPushName()))
+	redactStrings(info.ProtoReflect())
+}
+
+// redactStrings rewrites every string field of msg and its nested messages.
+func redactStrings(msg protoreflect.Message) {
+	msg.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case fd.IsList() && fd.Kind() == protoreflect.StringKind:
+			list := v.List()
+			for i := 0; i < list.Len(); i++ {
+				list.Set(i, protoreflect.ValueOfString(redactText(list.Get(i).String())))
+			}
+		case fd.IsList() && fd.Kind() == protoreflect.MessageKind:
+			list := v.List()
+			for i := 0; i < list.Len(); i++ {
+				redactStrings(list.Get(i).Message())
+			}
+		case fd.IsMap():
+			// No WhatsApp message fields that carry personal data are maps
+		case fd.Kind() == protoreflect.StringKind:
+			msg.Set(fd, protoreflect.ValueOfString(redactText(v.String())))
+		case fd.Kind() == protoreflect.MessageKind:
+			redactStrings(v.Message())
+		}
+		return true
+	})
+}
+
+// redactText replaces personal JIDs, @mentions and vCard phone numbers in s.
+func redactText(s string) string {
+	s = jidPattern.ReplaceAllStringFunc(s, func(match string) string {
+		parts := jidPattern.FindStringSubmatch(match)
+		return RedactNumber(parts[1]) + parts[2]
+	})
+	s = mentionPattern.ReplaceAllStringFunc(s, func(match string) string {
+		return "@" + RedactNumber(match[1:])
+	})
+	return vcardPattern.ReplaceAllStringFunc(s, func(match string) string {
+		parts := vcardPattern.FindStringSubmatch(match)
+		if parts[1] != "" {
+			return parts[1] + RedactNumber(parts[2])
+		}
+		digits := strings.Map(func(r rune) rune {
+			if r >= '0' && r <= '9' {
+				return r
+			}
+			return -1
+		}, match[len(parts[3]):])
+		return parts[3] + "+" + RedactNumber(digits)
+	})
+}
+
+// readHeader reads and validates the header line of a recording.
+func readHeader(r *bufio.Reader) (header, error) {
+	var h header
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return h, fmt.Errorf("invalid recording header: %w", err)
+	}
+	rest, ok := strings.CutPrefix(strings.TrimSpace(line), magic+" ")
+	if !ok {
+		return h, fmt.Errorf("not an aemy recording")
+	}
+	if err := json.Unmarshal([]byte(rest), &h); err != nil {
+		return h, fmt.Errorf("invalid recording header: %w", err)
+	}
+	return h, nil
+}
+
+// ReadRecording reads all events of a recording.
+//
+// Parameters:
+//   - path: the recording file
+//
+// Returns:
+//   - []*events.Message: the recorded events, in order
+//   - types.JID: the bot account the events were received on (may be empty)
+//   - bool: whether the recording is redacted
+//   - error: if the file cannot be read or is corrupt
+func ReadRecording(path string) ([]*events.Message, types.JID, bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, types.EmptyJID, false, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	h, err := readHeader(reader)
+	if err != nil {
+		return nil, types.EmptyJID, false, err
+	}
+	own, _ := types.ParseJID(h.Own)
+
+	var evts []*events.Message
+	for {
+		info := &waWeb.WebMessageInfo{}
+		err := protodelim.UnmarshalFrom(reader, info)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, own, h.Redacted, fmt.Errorf("record %d: %w", len(evts)+1, err)
+		}
+
+		evt, err := decodeEvent(info)
+		if err != nil {
+			return nil, own, h.Redacted, fmt.Errorf("record %d: %w", len(evts)+1, err)
+		}
+		evts = append(evts, evt)
+	}
+	return evts, own, h.Redacted, nil
+}
@@ -0,0 +1,252 @@
+// Package replay records incoming message events and replays them against a fake client.
+// This file, replay.go, implements the replay harness and golden file comparison.
+package replay
+
+import (
+	"aemy/config"
+	"aemy/handler"
+	"aemy/prefs"
+	"aemy/utils"
+	"aemy/utils/utilstest"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// DefaultGoldenDir is where golden files are kept unless Options.GoldenDir is set.
+const DefaultGoldenDir = "testdata/replay"
+
+// Options controls a replay run.
+type Options struct {
+	// GoldenDir is the directory holding golden files, named after the recording.
+	GoldenDir string
+
+	// Update rewrites the golden file with the current output instead of comparing.
+	Update bool
+
+	// Transport answers the HTTP requests commands make, e.g. with canned API responses.
+	// If nil, every request fails, so a replay never depends on the network.
+	Transport http.RoundTripper
+}
+
+// offline is the transport used when Options.Transport is nil.
+type offline struct{}
+
+// RoundTrip fails every request.
+func (offline) RoundTrip(req *http.Request) (*http.Response, error) {
+	return nil, fmt.Errorf("replay: no network access for %s", req.URL)
+}
+
+// Sent is a message the bot sent while handling a replayed event.
+type Sent struct {
+	// To is the destination chat.
+	To string `json:"to"`
+
+	// Message is the sent message as protobuf JSON.
+	Message json.RawMessage `json:"message"`
+}
+
+// Step is the outcome of replaying one event.
+type Step struct {
+	// ID is the ID of the replayed message.
+	ID string `json:"id"`
+
+	// Text is the text of the replayed message, for orientation when reading golden files.
+	Text string `json:"text,omitempty"`
+
+	// Sent lists the messages the bot sent in response, in order.
+	Sent []Sent `json:"sent"`
+}
+
+// Result summarizes a replay run.
+type Result struct {
+	// Steps is the outcome of every replayed event.
+	Steps []Step
+
+	// Mismatches lists the indexes of steps that differ from the golden file.
+	Mismatches []int
+
+	// GoldenPath is the golden file that was compared or written.
+	GoldenPath string
+}
+
+// Run replays the events of a recording through handler.EventHandler against a
+// utilstest.FakeClient and compares what the bot sends with the golden file. Owners from
+// config are pseudonymized the same way as the recording, so owner-only commands behave
+// as they did in production. HTTP requests go to opts.Transport, and the replay starts
+// with an empty cache and default preferences, so the result only depends on the
+// recording.
+//
+// Parameters:
+//   - path: the recording file
+//   - opts: golden file location and update mode
+//   - out: where differences are reported
+//
+// Returns:
+//   - Result: the steps and any mismatches
+//   - error: if the recording or golden file cannot be read or written
+func Run(path string, opts Options, out io.Writer) (Result, error) {
+	goldenDir := opts.GoldenDir
+	if goldenDir == "" {
+		goldenDir = DefaultGoldenDir
+	}
+	result := Result{GoldenPath: filepath.Join(goldenDir, strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))+".golden.json")}
+
+	evts, own, redacted, err := ReadRecording(path)
+	if err != nil {
+		return result, err
+	}
+
+	if own.IsEmpty() {
+		own = types.NewJID("10000000000", types.DefaultUserServer)
+	}
+	client := utilstest.NewFakeClient(own)
+
+	transport := opts.Transport
+	if transport == nil {
+		transport = offline{}
+	}
+	defer utils.UseTransport(transport)()
+
+	cacheDir, err := os.MkdirTemp("", "aemy-replay-")
+	if err != nil {
+		return result, err
+	}
+	defer os.RemoveAll(cacheDir)
+	cache := utils.DefaultCache
+	utils.DefaultCache = utils.NewCache(cacheDir, config.CacheTTL, config.CacheMaxSize)
+	defer func() { utils.DefaultCache = cache }()
+
+	prefs.Use(prefs.NewMemoryStore())
+
+	owners := config.Owners
+	defer func() { config.Owners = owners }()
+	if redacted {
+		config.Owners = make([]string, 0, len(owners))
+		for _, owner := range owners {
+			config.Owners = append(config.Owners, RedactNumber(owner))
+		}
+	}
+
+	for _, evt := range evts {
+		// Each event sees the clock at its original time, so replies are reproducible
+		timestamp := evt.Info.Timestamp
+		client.Clock = func() time.Time { return timestamp }
+		client.Reset()
+
+		handler.EventHandler(evt, client)
+		handler.Wait()
+
+		step := Step{ID: evt.Info.ID, Text: utils.MessageText(utils.UnwrapMessage(evt.Message)), Sent: []Sent{}}
+		for _, sent := range client.Sent() {
+			message, err := normalize(sent.Message)
+			if err != nil {
+				return result, err
+			}
+			step.Sent = append(step.Sent, Sent{To: sent.To.String(), Message: message})
+		}
+		result.Steps = append(result.Steps, step)
+	}
+
+	if opts.Update {
+		data, err := json.MarshalIndent(result.Steps, "", "  ")
+		if err != nil {
+			return result, err
+		}
+		if err := os.MkdirAll(goldenDir, 0o755); err != nil {
+			return result, err
+		}
+		return result, os.WriteFile(result.GoldenPath, append(data, '\n'), 0o644)
+	}
+
+	data, err := os.ReadFile(result.GoldenPath)
+	if err != nil {
+		return result, fmt.Errorf("read golden file (run with update to create it): %w", err)
+	}
+	var golden []Step
+	if err := json.Unmarshal(data, &golden); err != nil {
+		return result, fmt.Errorf("invalid golden file: %w", err)
+	}
+
+	for i, step := range result.Steps {
+		got := canonical(step)
+		want := "(missing)"
+		if i < len(golden) {
+			want = canonical(golden[i])
+		}
+		if got != want {
+			result.Mismatches = append(result.Mismatches, i)
+			fmt.Fprintf(out, "--- event %d (%s) %q\nwant: %s\n got: %s\n", i+1, step.ID, step.Text, want, got)
+		}
+	}
+	if len(golden) > len(result.Steps) {
+		for i := len(result.Steps); i < len(golden); i++ {
+			result.Mismatches = append(result.Mismatches, i)
+			fmt.Fprintf(out, "--- event %d (%s) is in the golden file but not in the recording\n", i+1, golden[i].ID)
+		}
+	}
+	return result, nil
+}
+
+// normalize converts a sent message to stable, indented JSON. Fields that change on
+// every run, such as reaction timestamps, are cleared first.
+func normalize(msg proto.Message) (json.RawMessage, error) {
+	msg = proto.Clone(msg)
+	clearVolatile(msg.ProtoReflect())
+
+	data, err := protojson.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	// protojson output is deliberately unstable in whitespace, so reformat it
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "    ", "  "); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// volatileFields are cleared before comparing sent messages.
+var volatileFields = map[protoreflect.Name]bool{
+	"senderTimestampMS": true,
+	"messageSecret":     true,
+}
+
+// clearVolatile clears volatileFields in msg and its nested messages.
+func clearVolatile(msg protoreflect.Message) {
+	msg.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case volatileFields[fd.Name()]:
+			msg.Clear(fd)
+		case fd.IsList() && fd.Kind() == protoreflect.MessageKind:
+			list := v.List()
+			for i := 0; i < list.Len(); i++ {
+				clearVolatile(list.Get(i).Message())
+			}
+		case !fd.IsMap() && fd.Kind() == protoreflect.MessageKind:
+			clearVolatile(v.Message())
+		}
+		return true
+	})
+}
+
+// canonical returns the compact JSON of a step's sent messages, used for comparison.
+func canonical(step Step) string {
+	data, _ := json.Marshal(step.Sent)
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err != nil {
+		return string(data)
+	}
+	return buf.String()
+}
@@ -0,0 +1,147 @@
+package replay
+
+import (
+	"aemy/config"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/golden")
+
+// fixtures maps the URLs requested while replaying the recordings in testdata to the
+// files in testdata/http that answer them. Other requests fail, like in a replay
+// without a transport.
+var fixtures = map[string]string{
+	"https://api.seaavey.my.id/api/downloader/tiktok?url=https%3A%2F%2Fvt.tiktok.com%2FZSslide%2F": "tiktok-slide.json",
+	"https://p16.tiktokcdn.example/slide-1.png": "slide-1.png",
+	"https://p16.tiktokcdn.example/slide-2.png": "slide-2.png",
+}
+
+// fixtureTransport answers requests from fixtures.
+type fixtureTransport struct{}
+
+// RoundTrip implements http.RoundTripper.
+func (fixtureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	name, ok := fixtures[req.URL.String()]
+	if !ok {
+		return nil, fmt.Errorf("no fixture for %s", req.URL)
+	}
+	data, err := os.ReadFile(filepath.Join("testdata", "http", name))
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {http.DetectContentType(data)}},
+		Body:       io.NopCloser(bytes.NewReader(data)),
+		Request:    req,
+	}, nil
+}
+
+// testdataOwner is the bot owner the recordings in testdata were made with.
+const testdataOwner = "6289513081052"
+
+func TestReplayRecordings(t *testing.T) {
+	// The goldens must not depend on the local configuration
+	owners, accounts, self, language := config.Owners, config.Accounts, config.Self, config.Language
+	config.Owners, config.Accounts, config.Self, config.Language = []string{testdataOwner}, nil, true, "en"
+	t.Cleanup(func() {
+		config.Owners, config.Accounts, config.Self, config.Language = owners, accounts, self, language
+	})
+
+	recordings, err := filepath.Glob(filepath.Join("testdata", "*.aemyrec"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recordings) == 0 {
+		t.Fatal("no recordings in testdata")
+	}
+
+	for _, path := range recordings {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			var out bytes.Buffer
+			opts := Options{GoldenDir: filepath.Join("testdata", "golden"), Update: *update, Transport: fixtureTransport{}}
+			result, err := Run(path, opts, &out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(result.Mismatches) > 0 {
+				t.Errorf("%d of %d events differ from %s (run go test ./replay -update to accept):\n%s",
+					len(result.Mismatches), len(result.Steps), result.GoldenPath, out.String())
+			}
+		})
+	}
+}
+
+func TestRecorderRedactsDevices(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.aemyrec")
+	recorder, err := NewRecorder(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := &waE2E.Message{ExtendedTextMessage: &waE2E.ExtendedTextMessage{
+		Text: proto.String("hi @6289876543210"),
+		ContextInfo: &waE2E.ContextInfo{
+			Participant:  proto.String("6289876543210:3@s.whatsapp.net"),
+			MentionedJID: []string{"6289876543210@s.whatsapp.net", "123456789012345:7@lid"},
+		},
+	}}
+	evt := &events.Message{
+		Info: types.MessageInfo{
+			MessageSource: types.MessageSource{
+				Chat:   types.NewJID("6281234567890", types.DefaultUserServer),
+				Sender: types.JID{User: "6281234567890", Device: 12, Server: types.DefaultUserServer},
+			},
+			ID:        "TEST",
+			PushName:  "Real Name",
+			Timestamp: time.Unix(1700000000, 0),
+		},
+		Message:    msg,
+		RawMessage: msg,
+	}
+	if err := recorder.Record(evt, types.NewJID("10000000000", types.DefaultUserServer)); err != nil {
+		t.Fatal(err)
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"6281234567890", "6289876543210", "123456789012345", "Real Name", "10000000000"} {
+		if bytes.Contains(data, []byte(secret)) {
+			t.Errorf("recording contains %q", secret)
+		}
+	}
+
+	evts, _, redacted, err := ReadRecording(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !redacted || len(evts) != 1 {
+		t.Fatalf("read %d events, redacted %v", len(evts), redacted)
+	}
+	sender := evts[0].Info.Sender
+	if sender.User != RedactNumber("6281234567890") || sender.Device != 12 {
+		t.Errorf("sender = %s, want the pseudonym with device 12", sender)
+	}
+	if !strings.HasSuffix(evts[0].Message.GetExtendedTextMessage().GetContextInfo().GetParticipant(), ":3@s.whatsapp.net") {
+		t.Errorf("quoted participant lost its device: %s", evts[0].Message.GetExtendedTextMessage().GetContextInfo().GetParticipant())
+	}
+}
@@ -0,0 +1,46 @@
+// Package types defines custom data structures used throughout the application.
+// This file, Accounts.go, defines how commands manage the WhatsApp accounts the bot runs on.
+package types
+
+import (
+	"context"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Account describes one WhatsApp account the bot runs on.
+type Account struct {
+	// JID is the account's own JID. It is empty while the account is being linked.
+	JID types.JID
+
+	// Name is the push name of the account, if known.
+	Name string
+
+	// State is the connection state, e.g. "connected", "disconnected" or "pairing".
+	State string
+}
+
+// LoginPrompt is shown to whoever links a new account. Exactly one field is set.
+type LoginPrompt struct {
+	// QR is the content of a QR code to scan in WhatsApp > Linked devices.
+	QR string
+
+	// PairCode is a code to enter in WhatsApp > Linked devices > Link with phone number.
+	PairCode string
+}
+
+// AccountManager adds and removes bot accounts while the bot is running.
+// It is implemented by client.Manager.
+type AccountManager interface {
+	// Accounts lists the accounts, in the order they were started.
+	Accounts() []Account
+
+	// AddAccount links a new account and starts it. With a phone number the account is
+	// linked by pairing code, otherwise by QR code. prompt is called with every code to
+	// show; AddAccount blocks until the account is linked, ctx is done or linking fails.
+	AddAccount(ctx context.Context, phone string, prompt func(LoginPrompt)) (Account, error)
+
+	// RemoveAccount logs the account with the given phone number out, unlinks it from the
+	// phone and stops it.
+	RemoveAccount(ctx context.Context, number string) error
+}
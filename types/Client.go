@@ -0,0 +1,63 @@
+// Package types defines custom data structures used throughout the application.
+// This file, Client.go, defines the messaging interface the bot talks to WhatsApp through.
+package types
+
+import (
+	"context"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Client is the set of WhatsApp operations used by Messages, the event handler and the
+// commands. Its methods mirror those of *whatsmeow.Client, which is wrapped by
+// utils.WhatsmeowClient for live use; utilstest.FakeClient implements it in memory so that
+// commands can run without a connection.
+type Client interface {
+	// OwnID returns the bot's own phone-number JID, or an empty JID if not logged in.
+	OwnID() types.JID
+
+	// OwnLID returns the bot's own hidden-user (LID) JID, or an empty JID if unknown.
+	OwnLID() types.JID
+
+	// SendMessage sends any message: text, media, reactions and revocations alike.
+	SendMessage(ctx context.Context, to types.JID, message *waE2E.Message, extra ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error)
+
+	// Upload encrypts and uploads a media file so it can be attached to a message.
+	Upload(ctx context.Context, plaintext []byte, mediaType whatsmeow.MediaType) (whatsmeow.UploadResponse, error)
+
+	// Download fetches and decrypts the media attached to a message.
+	Download(ctx context.Context, msg whatsmeow.DownloadableMessage) ([]byte, error)
+
+	// SendPresence sets the bot's global online/offline presence.
+	SendPresence(state types.Presence) error
+
+	// SendChatPresence shows or clears the typing/recording indicator in a chat.
+	SendChatPresence(jid types.JID, state types.ChatPresence, media types.ChatPresenceMedia) error
+
+	// MarkRead marks messages in a chat as read.
+	MarkRead(ids []types.MessageID, timestamp time.Time, chat, sender types.JID, receiptTypeExtra ...types.ReceiptType) error
+
+	// GetGroupInfo returns the metadata and participants of a group.
+	GetGroupInfo(jid types.JID) (*types.GroupInfo, error)
+
+	// GetJoinedGroups returns all groups the bot is a member of.
+	GetJoinedGroups() ([]*types.GroupInfo, error)
+
+	// UpdateGroupParticipants adds, removes, promotes or demotes group members.
+	UpdateGroupParticipants(jid types.JID, participantChanges []types.JID, action whatsmeow.ParticipantChange) ([]types.GroupParticipant, error)
+
+	// SetGroupName changes the subject of a group.
+	SetGroupName(jid types.JID, name string) error
+
+	// SetGroupTopic changes the description of a group.
+	SetGroupTopic(jid types.JID, previousID, newID, topic string) error
+
+	// GetGroupInviteLink returns the invite link of a group, optionally revoking the old one.
+	GetGroupInviteLink(jid types.JID, reset bool) (string, error)
+
+	// LeaveGroup makes the bot leave a group.
+	LeaveGroup(jid types.JID) error
+}
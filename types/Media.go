@@ -0,0 +1,73 @@
+package types
+
+import "io"
+
+// MediaSource describes where the bytes of an outgoing media message come from.
+// Exactly one of its fields is expected to be set; use the From* constructors.
+type MediaSource struct {
+	// URL is a remote file that is downloaded (and cached) before sending.
+	URL string
+
+	// Data is media that is already in memory, e.g. a generated QR code.
+	Data []byte
+
+	// Path is a file on the local filesystem.
+	Path string
+
+	// Reader is read to the end before sending.
+	Reader io.Reader
+}
+
+// FromURL returns a MediaSource that downloads the media from url.
+func FromURL(url string) MediaSource {
+	return MediaSource{URL: url}
+}
+
+// FromBytes returns a MediaSource for media already held in memory.
+func FromBytes(data []byte) MediaSource {
+	return MediaSource{Data: data}
+}
+
+// FromFile returns a MediaSource that reads the media from a local file.
+func FromFile(path string) MediaSource {
+	return MediaSource{Path: path}
+}
+
+// FromReader returns a MediaSource that reads the media from r.
+func FromReader(r io.Reader) MediaSource {
+	return MediaSource{Reader: r}
+}
+
+// FromURLs converts a list of URLs into media sources, e.g. for SendAlbum.
+func FromURLs(urls []string) []MediaSource {
+	sources := make([]MediaSource, 0, len(urls))
+	for _, url := range urls {
+		sources = append(sources, FromURL(url))
+	}
+	return sources
+}
+
+// Origin returns the URL or path the media came from, used to derive file names.
+// It is empty for in-memory and reader sources.
+func (s MediaSource) Origin() string {
+	if s.URL != "" {
+		return s.URL
+	}
+	return s.Path
+}
+
+// Media is a file downloaded from an incoming or quoted message.
+type Media struct {
+	// Type is the kind of message the media came from:
+	// "image", "video", "audio", "sticker" or "document".
+	Type string
+
+	// Data is the decrypted file content.
+	Data []byte
+
+	// Mimetype is the mimetype declared by the sender, or sniffed from Data if missing.
+	Mimetype string
+
+	// FileName is the document file name, or a name derived from the mimetype.
+	FileName string
+}
@@ -4,6 +4,10 @@ import "net/http"
 
 
 type ResponseAPIs struct {
+	// URL is the request URL, which the response is cached under (see utils.StoreResponse).
+	URL string
+	// Cached is true if the response was served from the cache.
+	Cached bool
 	Status int
 	Body []byte
 	Headers http.Header
@@ -4,6 +4,7 @@
 package types
 
 import (
+	"aemy/i18n"
 	"time"
 
 	"go.mau.fi/whatsmeow"
@@ -17,10 +18,58 @@ type Options struct {
 	Caption string
 
 	// ContextInfo contains additional message context such as mentions,
-	// quoted messages, or forwarded info.
+	// quoted messages, or forwarded info. If set, it replaces the default
+	// context that quotes the incoming message.
 	ContextInfo *waE2E.ContextInfo
+
+	// Mentions lists the users mentioned in the caption.
+	Mentions []types.JID
+
+	// ViewOnce sends images, videos and voice notes as view-once media.
+	ViewOnce bool
+
+	// NoQuote sends the media without quoting the incoming message.
+	NoQuote bool
+
+	// PTT sends audio as a voice note (push-to-talk) instead of a regular audio file.
+	// It is ignored by non-audio senders.
+	PTT bool
+
+	// FileName is the name shown for a document. If empty, it is derived from the source or mimetype.
+	FileName string
+
+	// Mimetype overrides the detected mimetype of a document.
+	Mimetype string
+
+	// NoCache uploads the media afresh and keeps the upload out of the upload cache, for
+	// files that must not be left behind on disk, such as backups.
+	NoCache bool
 }
 
+// Message types reported in Messages.Type.
+const (
+	TypeText                = "text"
+	TypeImage               = "image"
+	TypeVideo               = "video"
+	TypeAudio               = "audio"
+	TypeSticker             = "sticker"
+	TypeDocument            = "document"
+	TypeLocation            = "location"
+	TypeLiveLocation        = "liveLocation"
+	TypeContact             = "contact"
+	TypeContacts            = "contacts"
+	TypePoll                = "poll"
+	TypePollUpdate          = "pollUpdate"
+	TypeReaction            = "reaction"
+	TypeButtonsResponse     = "buttonsResponse"
+	TypeListResponse        = "listResponse"
+	TypeTemplateReply       = "templateButtonReply"
+	TypeInteractiveResponse = "interactiveResponse"
+	TypeGroupInvite         = "groupInvite"
+	TypeProtocol            = "protocol"
+	TypeUnknown             = "unknown"
+)
+
 // Messages represents a parsed and structured WhatsApp message.
 // It abstracts the raw WhatsMeow message event into a cleaner format
 // with easy access to sender, chat, and content information.
@@ -47,6 +96,10 @@ type Messages struct {
 	// IsOwner is true if the message sender is listed as a bot owner in the configuration.
 	IsOwner bool
 
+	// IsGlobalOwner is true if the sender is listed in config.Owners, the owners of every
+	// account, rather than only among the owners of this account in config.Accounts.
+	IsGlobalOwner bool
+
 	// Sender is the JID of the actual message sender.
 	// In groups, this is the participant’s JID; in private chats, it’s the same as From.
 	Sender types.JID
@@ -57,12 +110,25 @@ type Messages struct {
 	// SenderServer is the server domain part of the Sender JID.
 	SenderServer string
 
+	// Account is the phone number of the bot account the message was received on.
+	// Settings such as owners and prefixes are per account, see config.For.
+	Account string
+
 	// Pushname is the display name set by the sender in their WhatsApp profile.
 	Pushname string
 
 	// Timestamp is the exact time when the message was sent.
+	// It is zero for Quoted, as WhatsApp does not include it in replies.
 	Timestamp time.Time
 
+	// TimeZone is the timezone of the sender (their own setting, the chat's, or the
+	// configured default). Times shown to the sender should be converted to it.
+	TimeZone *time.Location
+
+	// Lang is the language replies to the sender are written in (their own setting, the
+	// chat's, or a guess from their phone number). Use T to translate replies.
+	Lang string
+
 	// Prefix is the bot command prefix used (e.g., "!", ".", "/").
 	Prefix string
 
@@ -72,6 +138,14 @@ type Messages struct {
 	// Args contains any arguments following the command, split by spaces.
 	Args []string
 
+	// Type is the kind of message after unwrapping ephemeral, view-once, device-sent
+	// and edit containers, e.g. TypeText or TypeImage.
+	Type string
+
+	// IsEdit is true if the message is an edit of an earlier one. Its content is the
+	// edited text, but commands are not run again for it.
+	IsEdit bool
+
 	// Text is the complete raw text content of the message.
 	Text string
 
@@ -89,21 +163,74 @@ type Messages struct {
 	// Example: m.Reply("Hello!")
 	Reply func(text string) error
 	
+	// Delete revokes the message for everyone. Messages from others can only be
+	// deleted in groups where the bot is an admin.
+	// Example: m.Quoted.Delete()
+	Delete func() error
+
 	// ReplyContext sends a text reply with custom ContextInfo.
 	// Example: m.ReplyContext("Hello!", contextInfo)
 	ReplyContext func(text string, contextInfo *waE2E.ContextInfo) error
 
 	// SendImage sends an image to the chat.
-	// url: direct URL to the image file.
-	// opts: optional parameters such as Caption and ContextInfo.
-	SendImage func(url string, opts Options) (whatsmeow.SendResponse, error)
-
-	SendVideo func(url string, opts Options) (whatsmeow.SendResponse, error)
+	// src: where the image comes from (see FromURL, FromBytes, FromFile, FromReader).
+	// opts: optional parameters such as Caption, Mentions, ViewOnce and quoting.
+	SendImage func(src MediaSource, opts Options) (whatsmeow.SendResponse, error)
+
+	// SendVideo sends a video to the chat.
+	// src: where the video comes from.
+	// opts: optional parameters such as Caption, Mentions, ViewOnce and quoting.
+	SendVideo func(src MediaSource, opts Options) (whatsmeow.SendResponse, error)
+
+	// SendAudio sends an audio file to the chat.
+	// src: where the audio comes from.
+	// opts: set PTT to send it as a voice note; Caption is ignored.
+	SendAudio func(src MediaSource, opts Options) (whatsmeow.SendResponse, error)
+
+	// SendDocument sends a file as a document, keeping its original quality.
+	// src: where the file comes from.
+	// opts: Caption, FileName and Mimetype are used.
+	SendDocument func(src MediaSource, opts Options) (whatsmeow.SendResponse, error)
+
+	// SendSticker sends a sticker to the chat.
+	// src: a WebP sticker, or an image or short video that is converted first.
+	// opts: optional parameters such as Mentions and quoting; Caption is ignored.
+	SendSticker func(src MediaSource, opts Options) (whatsmeow.SendResponse, error)
+
+	// SendAlbum sends several images and videos as a single album with one caption.
+	// Items are loaded in parallel but delivered in order. Failures are reported in
+	// one summary reply, so callers should not reply again; an error is returned only
+	// if nothing was sent.
+	// srcs: where the media files come from.
+	// opts: Caption is placed on the first item.
+	SendAlbum func(srcs []MediaSource, opts Options) error
 	
-	// Quoted contains the serialized data of the message being replied to.
-	// It is nil if the message is not a reply.
+	// Download fetches the image, video, audio, sticker or document attached to this message.
+	// It fails with utils.ErrNoMedia if there is none and utils.ErrMediaTooLarge if the file
+	// exceeds config.MaxDownloadSize.
+	// Example: media, err := m.Quoted.Download()
+	Download func() (*Media, error)
+
+	// Client is the client the message was received on. Commands use it for
+	// operations not covered by the helpers, e.g. group management.
+	Client Client
+
+	// Quoted contains the serialized data of the message being replied to, with the same
+	// helpers (Reply, React, Delete, Download, ...) acting on the quoted message.
+	// It is nil if the message is not a reply. Pushname and Timestamp are not available for it.
 	Quoted *Messages
 
+	// RemoteJID is set on Quoted when the quoted message was sent in another chat than
+	// the reply, e.g. status@broadcast for replies to a status. From is still the chat
+	// of the reply, so the helpers answer where the reply was sent.
+	RemoteJID types.JID
+
 	// Message is the raw *waE2E.Message from whatsmeow.
 	Message *waE2E.Message
 }
+
+// T returns the catalog message for key in the sender's language, see i18n.T.
+// Example: m.Reply(m.T("toimg.usage", "command", m.Prefix+m.Command))
+func (m Messages) T(key string, vars ...any) string {
+	return i18n.T(m.Lang, key, vars...)
+}
@@ -5,7 +5,6 @@ package types
 import (
 	"context"
 
-	"go.mau.fi/whatsmeow"
 	"go.mau.fi/whatsmeow/types/events"
 )
 
@@ -14,5 +13,5 @@ import (
 type CommandHandler interface {
 	// Handle processes the command with the given context, client, message, and event.
 	// It returns an error if the command processing fails.
-	Handle(ctx context.Context, client *whatsmeow.Client, m Messages, evt *events.Message) error
+	Handle(ctx context.Context, client Client, m Messages, evt *events.Message) error
 }
\ No newline at end of file
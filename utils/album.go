@@ -0,0 +1,181 @@
+// Package utils provides helper functions and utilities for the bot.
+// This file, album.go, groups several images and videos into a single
+// WhatsApp album instead of flooding the chat with separate messages.
+package utils
+
+import (
+	"aemy/i18n"
+	"aemy/outbox"
+	local "aemy/types"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waCommon"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"google.golang.org/protobuf/proto"
+)
+
+// albumConcurrency is the number of album items loaded at the same time.
+const albumConcurrency = 4
+
+// albumItem is a single loaded entry of an album.
+type albumItem struct {
+	origin    string
+	data      []byte
+	mediaType whatsmeow.MediaType
+	err       error
+}
+
+// AlbumFailure describes an album item that could not be delivered.
+type AlbumFailure struct {
+	// Index is the 1-based position of the item in the album.
+	Index int
+
+	// Err is the reason the item failed.
+	Err error
+}
+
+// loadAlbum loads all sources in parallel and classifies each item as image,
+// video or document. The result keeps the order of srcs.
+func loadAlbum(srcs []local.MediaSource) []albumItem {
+	items := make([]albumItem, len(srcs))
+	sem := make(chan struct{}, albumConcurrency)
+	var wg sync.WaitGroup
+
+	for i, src := range srcs {
+		wg.Add(1)
+		go func(i int, src local.MediaSource) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			item := albumItem{origin: src.Origin()}
+			item.data, item.err = LoadMedia(src)
+			if item.err == nil {
+				item.mediaType = albumMediaType(item.data)
+			}
+			items[i] = item
+		}(i, src)
+	}
+
+	wg.Wait()
+	return items
+}
+
+// albumMediaType returns the media type an item is sent as: image or video when
+// WhatsApp can show it in an album, document otherwise.
+func albumMediaType(data []byte) whatsmeow.MediaType {
+	mimetype := http.DetectContentType(data)
+	switch {
+	case strings.HasPrefix(mimetype, "image/") && !NeedsDocument(data, whatsmeow.MediaImage):
+		return whatsmeow.MediaImage
+	case strings.HasPrefix(mimetype, "video/") && !NeedsDocument(data, whatsmeow.MediaVideo):
+		return whatsmeow.MediaVideo
+	default:
+		return whatsmeow.MediaDocument
+	}
+}
+
+// sendAlbum loads srcs in parallel and delivers them in input order as one album with
+// opts.Caption on the first item. Items that cannot be part of an album are sent as
+// documents in their place, and a lone image or video is sent as a regular message.
+// Items after the first are queued with outbox.Low priority, so that a long album does
+// not hold up the replies to other commands.
+//
+// Returns:
+//   - int: the number of items delivered
+//   - []AlbumFailure: items that failed to download or send
+func (t mediaTarget) sendAlbum(srcs []local.MediaSource, opts local.Options) (int, []AlbumFailure) {
+	items := loadAlbum(srcs)
+
+	var failures []AlbumFailure
+	images, videos := 0, 0
+	for i, item := range items {
+		switch {
+		case item.err != nil:
+			failures = append(failures, AlbumFailure{Index: i + 1, Err: item.err})
+		case item.mediaType == whatsmeow.MediaImage:
+			images++
+		case item.mediaType == whatsmeow.MediaVideo:
+			videos++
+		}
+	}
+
+	// Only groups of two or more are worth an album; otherwise items go out individually.
+	itemTarget := t
+	if images+videos > 1 {
+		parent, err := t.client.SendMessage(t.ctx, t.chat, &waE2E.Message{
+			AlbumMessage: &waE2E.AlbumMessage{
+				ExpectedImageCount: proto.Uint32(uint32(images)),
+				ExpectedVideoCount: proto.Uint32(uint32(videos)),
+				ContextInfo:        t.contextFor(opts),
+			},
+		})
+		if err == nil {
+			itemTarget.messageContextInfo = &waE2E.MessageContextInfo{
+				MessageAssociation: &waE2E.MessageAssociation{
+					AssociationType: waE2E.MessageAssociation_MEDIA_ALBUM.Enum(),
+					ParentMessageKey: &waCommon.MessageKey{
+						RemoteJID: proto.String(t.chat.String()),
+						FromMe:    proto.Bool(true),
+						ID:        proto.String(parent.ID),
+					},
+				},
+			}
+		}
+	}
+
+	sent := 0
+	caption := opts.Caption
+	docTarget := t
+	for i, item := range items {
+		if item.err != nil {
+			continue
+		}
+		itemOpts := opts
+		itemOpts.Caption = caption
+
+		var err error
+		switch item.mediaType {
+		case whatsmeow.MediaImage:
+			_, err = itemTarget.sendImage(item.data, item.origin, itemOpts)
+		case whatsmeow.MediaVideo:
+			_, err = itemTarget.sendVideo(item.data, item.origin, itemOpts)
+		default:
+			_, err = docTarget.sendDocument(item.data, item.origin, itemOpts)
+		}
+
+		// The items after the first give way to the replies to other commands
+		low := outbox.WithPriority(t.ctx, outbox.Low)
+		itemTarget.ctx, docTarget.ctx = low, low
+
+		if err != nil {
+			failures = append(failures, AlbumFailure{Index: i + 1, Err: err})
+			continue
+		}
+		sent++
+		caption = ""
+	}
+
+	sort.Slice(failures, func(a, b int) bool {
+		return failures[a].Index < failures[b].Index
+	})
+	return sent, failures
+}
+
+// AlbumSummary formats album failures as a single reply in lang, e.g. for SendAlbum.
+// It returns an empty string when there were no failures.
+func AlbumSummary(lang string, total int, failures []AlbumFailure) string {
+	if len(failures) == 0 {
+		return ""
+	}
+
+	lines := []string{i18n.T(lang, "album.failed", "failed", len(failures), "count", total)}
+	for _, f := range failures {
+		lines = append(lines, i18n.T(lang, "album.failure", "index", f.Index, "error", f.Err))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,122 @@
+// Package utils provides helper functions and utilities for the bot.
+// This file, audio.go, prepares audio for sending: Opus conversion for voice
+// notes, duration detection and the waveform shown in the voice note bubble.
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net/http"
+)
+
+// waveformSamples is the number of bars WhatsApp draws for a voice note waveform.
+const waveformSamples = 64
+
+// waveformRate is the sample rate audio is decoded at for waveform and duration analysis.
+const waveformRate = 8000
+
+// OpusMimetype is the mimetype WhatsApp requires for PTT voice notes.
+const OpusMimetype = "audio/ogg; codecs=opus"
+
+// IsOggOpus reports whether data is an Ogg container carrying an Opus stream.
+func IsOggOpus(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("OggS")) && bytes.Contains(data[:min(len(data), 128)], []byte("OpusHead"))
+}
+
+// AudioMimetype returns the mimetype to advertise for an audio file.
+// http.DetectContentType misses MP3 files without an ID3 tag, so MPEG frame
+// sync bytes are checked as well.
+func AudioMimetype(data []byte) string {
+	if IsOggOpus(data) {
+		return OpusMimetype
+	}
+	if len(data) >= 2 && data[0] == 0xFF && data[1]&0xE0 == 0xE0 {
+		return "audio/mpeg"
+	}
+	return http.DetectContentType(data)
+}
+
+// ToOpus converts any audio (or the audio track of a video) to mono Ogg/Opus,
+// the only format WhatsApp plays as a voice note.
+//
+// Returns:
+//   - []byte: the converted audio, or data itself if it already is Ogg/Opus
+//   - error: ErrFFmpegUnavailable if conversion is needed but ffmpeg is missing
+func ToOpus(ctx context.Context, data []byte) ([]byte, error) {
+	if IsOggOpus(data) {
+		return data, nil
+	}
+	return FFmpeg(ctx, data, "", ".ogg", "-vn", "-c:a", "libopus", "-b:a", "48k", "-ac", "1", "-ar", "48000", "-application", "voip")
+}
+
+// AudioInfo determines the duration and waveform of an audio file.
+// With ffmpeg available the audio is decoded and both values are computed from
+// the samples; otherwise the duration is read from Ogg headers when possible and
+// the waveform is left empty.
+//
+// Returns:
+//   - MediaInfo: Seconds is set when the duration could be determined
+//   - []byte: the waveform as waveformSamples values from 0 to 100, or nil
+func AudioInfo(ctx context.Context, data []byte) (MediaInfo, []byte) {
+	pcm, err := FFmpeg(ctx, data, "", ".raw", "-vn", "-f", "s16le", "-ac", "1", "-ar", "8000")
+	if err != nil || len(pcm) < 2 {
+		return MediaInfo{Seconds: oggDuration(data)}, nil
+	}
+
+	samples := make([]int16, len(pcm)/2)
+	for i := range samples {
+		samples[i] = int16(binary.LittleEndian.Uint16(pcm[i*2:]))
+	}
+
+	return MediaInfo{Seconds: uint32(len(samples) / waveformRate)}, waveform(samples)
+}
+
+// waveform reduces PCM samples to waveformSamples bars of average loudness,
+// normalized so the loudest bar is 100.
+func waveform(samples []int16) []byte {
+	if len(samples) < waveformSamples {
+		return nil
+	}
+
+	bucket := len(samples) / waveformSamples
+	levels := make([]float64, waveformSamples)
+	peak := 0.0
+	for i := range levels {
+		sum := 0.0
+		for _, s := range samples[i*bucket : (i+1)*bucket] {
+			if s < 0 {
+				sum -= float64(s)
+			} else {
+				sum += float64(s)
+			}
+		}
+		levels[i] = sum / float64(bucket)
+		peak = max(peak, levels[i])
+	}
+
+	wave := make([]byte, waveformSamples)
+	if peak == 0 {
+		return wave
+	}
+	for i, level := range levels {
+		wave[i] = byte(level / peak * 100)
+	}
+	return wave
+}
+
+// oggDuration reads the duration of an Ogg/Opus stream from the granule position of
+// its last page. Opus granules always count 48 kHz samples. It returns 0 for other formats.
+func oggDuration(data []byte) uint32 {
+	if !IsOggOpus(data) {
+		return 0
+	}
+
+	last := bytes.LastIndex(data, []byte("OggS"))
+	if last < 0 || len(data) < last+14 {
+		return 0
+	}
+
+	granule := binary.LittleEndian.Uint64(data[last+6 : last+14])
+	return uint32(granule / 48000)
+}
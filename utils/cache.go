@@ -0,0 +1,331 @@
+// Package utils provides helper functions and utilities for the bot.
+// This file, cache.go, implements an on-disk cache for API responses and
+// downloaded media, so repeated requests for the same link are served locally.
+package utils
+
+import (
+	"aemy/config"
+	"aemy/types"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Subdirectories of the cache directory.
+const (
+	cacheResponsesDir = "responses"
+	cacheMediaDir     = "media"
+	cacheURLsDir      = "urls"
+)
+
+// Cache is an on-disk store for API responses and downloaded media.
+//
+// API responses are keyed by request URL and expire after a TTL. Media is
+// stored once per content hash, with a separate URL index (also subject to
+// the TTL) pointing at it, so identical files fetched from different links
+// share a single copy. When the total size exceeds the limit, the least
+// recently used files are evicted.
+type Cache struct {
+	dir     string
+	ttl     time.Duration
+	maxSize int64
+
+	mu     sync.Mutex
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// CacheStats is a snapshot of cache usage.
+type CacheStats struct {
+	// Hits is the number of lookups served from the cache since startup.
+	Hits int64
+
+	// Misses is the number of lookups that were not found or had expired.
+	Misses int64
+
+	// Entries is the number of files currently stored in the cache.
+	Entries int
+
+	// Size is the total size of the cached files in bytes.
+	Size int64
+}
+
+// cachedResponse is the on-disk representation of a cached API response.
+type cachedResponse struct {
+	Expires  time.Time          `json:"expires"`
+	Response types.ResponseAPIs `json:"response"`
+}
+
+// cachedURL is the on-disk representation of a URL index entry for media.
+type cachedURL struct {
+	Expires time.Time `json:"expires"`
+	Hash    string    `json:"hash"`
+}
+
+// DefaultCache is the shared cache used by SeaaveyAPIs and FetchBuffer.
+// It is configured from config.CacheDir, config.CacheTTL and config.CacheMaxSize.
+var DefaultCache = NewCache(config.CacheDir, config.CacheTTL, config.CacheMaxSize)
+
+// NewCache creates a cache rooted at dir. Directories are created lazily on first write.
+//
+// Parameters:
+//   - dir: root directory of the cache
+//   - ttl: how long API responses and URL index entries stay valid
+//   - maxSize: maximum total size in bytes; zero or negative disables eviction
+func NewCache(dir string, ttl time.Duration, maxSize int64) *Cache {
+	return &Cache{
+		dir:     dir,
+		ttl:     ttl,
+		maxSize: maxSize,
+	}
+}
+
+// HashKey returns the hex-encoded SHA256 of data. It is used both for cache
+// file names derived from URLs and for content addressing of media.
+func HashKey(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// path returns the location of a cache file inside the given subdirectory.
+func (c *Cache) path(sub, name string) string {
+	return filepath.Join(c.dir, sub, name)
+}
+
+// GetResponse returns a cached API response for key if it exists and has not expired.
+//
+// Parameters:
+//   - key: the request identifier, usually the full request URL
+//
+// Returns:
+//   - *types.ResponseAPIs: the cached response, or nil on a miss
+//   - bool: true if the response was served from the cache
+func (c *Cache) GetResponse(key string) (*types.ResponseAPIs, bool) {
+	var entry cachedResponse
+	file := c.path(cacheResponsesDir, HashKey([]byte(key))+".json")
+	if !c.readJSON(file, &entry) || time.Now().After(entry.Expires) {
+		c.misses.Add(1)
+		return nil, false
+	}
+
+	c.touch(file)
+	c.hits.Add(1)
+	return &entry.Response, true
+}
+
+// SetResponse stores an API response under key for the configured TTL.
+func (c *Cache) SetResponse(key string, res *types.ResponseAPIs) error {
+	entry := cachedResponse{
+		Expires:  time.Now().Add(c.ttl),
+		Response: *res,
+	}
+	return c.writeJSON(c.path(cacheResponsesDir, HashKey([]byte(key))+".json"), entry)
+}
+
+// GetMedia returns cached media previously downloaded from url.
+//
+// Returns:
+//   - []byte: the media bytes, or nil on a miss
+//   - bool: true if the media was served from the cache
+func (c *Cache) GetMedia(url string) ([]byte, bool) {
+	var entry cachedURL
+	index := c.path(cacheURLsDir, HashKey([]byte(url))+".json")
+	if !c.readJSON(index, &entry) || time.Now().After(entry.Expires) {
+		c.misses.Add(1)
+		return nil, false
+	}
+
+	file := c.path(cacheMediaDir, entry.Hash)
+	data, err := os.ReadFile(file)
+	if err != nil {
+		c.misses.Add(1)
+		return nil, false
+	}
+
+	c.touch(index)
+	c.touch(file)
+	c.hits.Add(1)
+	return data, true
+}
+
+// SetMedia stores media downloaded from url, addressed by its content hash.
+// If identical bytes are already cached, only the URL index is written.
+//
+// Returns:
+//   - string: the content hash the media is stored under
+//   - error: if writing to disk fails
+func (c *Cache) SetMedia(url string, data []byte) (string, error) {
+	hash := HashKey(data)
+	if err := c.store(c.path(cacheMediaDir, hash), data, false); err != nil {
+		return "", err
+	}
+
+	entry := cachedURL{
+		Expires: time.Now().Add(c.ttl),
+		Hash:    hash,
+	}
+	return hash, c.writeJSON(c.path(cacheURLsDir, HashKey([]byte(url))+".json"), entry)
+}
+
+// Clear removes every cached response and media file and resets the metrics.
+func (c *Cache) Clear() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.hits.Store(0)
+	c.misses.Store(0)
+	return os.RemoveAll(c.dir)
+}
+
+// Stats returns the current hit/miss counters and the size of the cache on disk.
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := CacheStats{
+		Hits:   c.hits.Load(),
+		Misses: c.misses.Load(),
+	}
+	for _, f := range c.files() {
+		stats.Entries++
+		stats.Size += f.size
+	}
+	return stats
+}
+
+// cacheFile describes a single file in the cache directory, used for eviction.
+type cacheFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// files lists all regular files under the cache directory.
+// The caller must hold c.mu.
+func (c *Cache) files() []cacheFile {
+	var files []cacheFile
+	filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		files = append(files, cacheFile{path: path, size: info.Size(), modTime: info.ModTime()})
+		return nil
+	})
+	return files
+}
+
+// evict removes the least recently used files until the cache fits in maxSize.
+// The caller must hold c.mu.
+func (c *Cache) evict() {
+	if c.maxSize <= 0 {
+		return
+	}
+
+	files := c.files()
+	var total int64
+	for _, f := range files {
+		total += f.size
+	}
+	if total <= c.maxSize {
+		return
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+	for _, f := range files {
+		if total <= c.maxSize {
+			break
+		}
+		if os.Remove(f.path) == nil {
+			total -= f.size
+		}
+	}
+}
+
+// touch updates the modification time of a cache file so eviction treats it as recently used.
+func (c *Cache) touch(path string) {
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+}
+
+// readJSON decodes a cache file into v, returning false if it is missing or malformed.
+func (c *Cache) readJSON(path string, v any) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal(data, v) == nil
+}
+
+// writeJSON encodes v and stores it in a cache file.
+func (c *Cache) writeJSON(path string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.writeFile(path, data)
+}
+
+// writeFile atomically writes data to a cache file and then enforces the size limit.
+func (c *Cache) writeFile(path string, data []byte) error {
+	return c.store(path, data, true)
+}
+
+// store atomically writes data to a cache file and then enforces the size limit. The
+// existence check, the write and the eviction all happen under c.mu, and every write
+// goes through its own temporary file, so concurrent writers of the same key cannot
+// corrupt each other.
+//
+// Parameters:
+//   - path: the cache file
+//   - data: its contents
+//   - overwrite: false to keep an existing file, e.g. content-addressed media
+func (c *Cache) store(path string, data []byte, overwrite bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !overwrite {
+		if _, err := os.Stat(path); err == nil {
+			return nil
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	c.evict()
+	return nil
+}
@@ -0,0 +1,107 @@
+// Package utils provides helper functions and utilities for the bot.
+// This file, document.go, decides when media must be sent as a document and
+// derives file names for documents.
+package utils
+
+import (
+	"aemy/config"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"go.mau.fi/whatsmeow"
+)
+
+// mediaFormats lists the mimetypes WhatsApp renders inline for each media type.
+// Anything else is delivered as a document.
+var mediaFormats = map[whatsmeow.MediaType][]string{
+	whatsmeow.MediaImage: {"image/jpeg", "image/png"},
+	whatsmeow.MediaVideo: {"video/mp4", "video/3gpp"},
+}
+
+// preferredExts maps common mimetypes to their usual extension, since
+// mime.ExtensionsByType returns alternatives in alphabetical order (".jfif" for JPEG).
+var preferredExts = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/webp":      ".webp",
+	"image/gif":       ".gif",
+	"video/mp4":       ".mp4",
+	"audio/mpeg":      ".mp3",
+	"audio/ogg":       ".ogg",
+	"application/pdf": ".pdf",
+	"application/zip": ".zip",
+}
+
+// NeedsDocument reports whether data cannot be sent as the given media type,
+// either because it exceeds the configured size limit or because WhatsApp
+// does not support its format inline.
+//
+// Parameters:
+//   - data: the raw media bytes
+//   - mediaType: whatsmeow.MediaImage or whatsmeow.MediaVideo
+//
+// Returns:
+//   - bool: true if the media should be sent with SendDocument instead
+func NeedsDocument(data []byte, mediaType whatsmeow.MediaType) bool {
+	size := int64(len(data))
+	switch mediaType {
+	case whatsmeow.MediaImage:
+		if size > config.MaxImageSize {
+			return true
+		}
+	case whatsmeow.MediaVideo:
+		if size > config.MaxVideoSize {
+			return true
+		}
+	}
+
+	formats, ok := mediaFormats[mediaType]
+	if !ok {
+		return false
+	}
+	mimetype := http.DetectContentType(data)
+	for _, format := range formats {
+		if strings.HasPrefix(mimetype, format) {
+			return false
+		}
+	}
+	return true
+}
+
+// FileName returns a file name for a document, taken from the last path segment
+// of rawURL when it has an extension, or built from the mimetype otherwise.
+//
+// Parameters:
+//   - rawURL: the URL the file was downloaded from (may be empty)
+//   - mimetype: the detected mimetype of the file
+//
+// Returns:
+//   - string: a file name such as "video.mp4" or "file.bin"
+func FileName(rawURL, mimetype string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		if base := path.Base(u.Path); base != "." && base != "/" && path.Ext(base) != "" {
+			return base
+		}
+	}
+
+	if parsed, _, err := mime.ParseMediaType(mimetype); err == nil {
+		mimetype = parsed
+	}
+
+	ext, ok := preferredExts[mimetype]
+	if !ok {
+		ext = ".bin"
+		if exts, err := mime.ExtensionsByType(mimetype); err == nil && len(exts) > 0 {
+			ext = exts[0]
+		}
+	}
+
+	name := "file"
+	if kind, _, ok := strings.Cut(mimetype, "/"); ok && kind != "application" {
+		name = kind
+	}
+	return name + ext
+}
@@ -0,0 +1,107 @@
+// Package utils provides helper functions and utilities for the bot.
+// This file, download.go, finds and downloads the media attached to a message,
+// the foundation for commands that act on a sent or replied-to photo.
+package utils
+
+import (
+	"aemy/config"
+	local "aemy/types"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+)
+
+// ErrNoMedia is returned by DownloadMedia when the message carries no downloadable media.
+var ErrNoMedia = errors.New("message has no media")
+
+// ErrMediaTooLarge is returned by DownloadMedia when the media exceeds config.MaxDownloadSize.
+var ErrMediaTooLarge = errors.New("media is too large")
+
+// downloadable is a media message that also reports its mimetype and size.
+type downloadable interface {
+	whatsmeow.DownloadableMessage
+	GetMimetype() string
+	GetFileLength() uint64
+}
+
+// MediaOf returns the downloadable part of msg and the kind of media it is
+// ("image", "video", "audio", "sticker" or "document").
+//
+// Returns:
+//   - whatsmeow.DownloadableMessage: the media message to pass to client.Download, or nil
+//   - string: the media kind, empty if msg has no media
+func MediaOf(msg *waE2E.Message) (whatsmeow.DownloadableMessage, string) {
+	msg = UnwrapMessage(msg)
+	switch {
+	case msg == nil:
+		return nil, ""
+	case msg.GetImageMessage() != nil:
+		return msg.GetImageMessage(), "image"
+	case msg.GetVideoMessage() != nil:
+		return msg.GetVideoMessage(), "video"
+	case msg.GetPtvMessage() != nil:
+		return msg.GetPtvMessage(), "video"
+	case msg.GetAudioMessage() != nil:
+		return msg.GetAudioMessage(), "audio"
+	case msg.GetStickerMessage() != nil:
+		return msg.GetStickerMessage(), "sticker"
+	case msg.GetDocumentMessage() != nil:
+		return msg.GetDocumentMessage(), "document"
+	default:
+		return nil, ""
+	}
+}
+
+// DownloadMedia downloads and decrypts the media attached to msg.
+//
+// Parameters:
+//   - ctx: context for the download request
+//   - client: the whatsmeow client used to download
+//   - msg: the raw message, e.g. Messages.Message or Quoted.Message
+//
+// Returns:
+//   - *local.Media: the file with its type, mimetype and file name
+//   - error: ErrNoMedia, ErrMediaTooLarge, or a download error
+func DownloadMedia(ctx context.Context, client local.Client, msg *waE2E.Message) (*local.Media, error) {
+	media, kind := MediaOf(msg)
+	if media == nil {
+		return nil, ErrNoMedia
+	}
+
+	file, _ := media.(downloadable)
+	if file != nil && int64(file.GetFileLength()) > config.MaxDownloadSize {
+		return nil, ErrMediaTooLarge
+	}
+
+	data, err := client.Download(ctx, media)
+	if err != nil {
+		return nil, fmt.Errorf("download error: %s", err)
+	}
+	if int64(len(data)) > config.MaxDownloadSize {
+		return nil, ErrMediaTooLarge
+	}
+
+	mimetype := ""
+	if file != nil {
+		mimetype = file.GetMimetype()
+	}
+	if mimetype == "" {
+		mimetype = http.DetectContentType(data)
+	}
+
+	fileName := FileName("", mimetype)
+	if doc, ok := media.(*waE2E.DocumentMessage); ok && doc.GetFileName() != "" {
+		fileName = doc.GetFileName()
+	}
+
+	return &local.Media{
+		Type:     kind,
+		Data:     data,
+		Mimetype: mimetype,
+		FileName: fileName,
+	}, nil
+}
@@ -4,18 +4,22 @@
 package utils
 
 import (
-	"aemy/config"
+	local "aemy/types"
 	"bytes"
+	"encoding/json"
 	"os/exec"
 	"strings"
 
 	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
 	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
 // GetText extracts the primary text content from a message event.
 // It intelligently checks different message types (e.g., image/video captions,
 // extended text, or a simple conversation) and returns the relevant text.
+// Nested containers such as ephemeral, view-once and edited messages are unwrapped first.
 //
 // Parameters:
 //   ctx: A pointer to the raw message event (*events.Message) from whatsmeow.
@@ -28,61 +32,290 @@ func GetText(ctx *events.Message) string {
 		return ""
 	}
 
-	msg := ctx.Message
+	return MessageText(UnwrapMessage(ctx.Message))
+}
+
+
+// GetQuotedText extracts the text content from a quoted message.
+func GetQuotedText(msg *waE2E.Message) string {
+	return MessageText(UnwrapMessage(msg))
+}
+
+// UnwrapMessage returns the actual content of a message, removing the containers
+// WhatsApp wraps it in: device-sent copies, ephemeral (disappearing) messages,
+// view-once messages, documents with captions and edits.
+//
+// Parameters:
+//   msg: The raw message, possibly wrapped several times.
+//
+// Returns:
+//   The innermost message. For an edit, this is the new content of the edited message.
+func UnwrapMessage(msg *waE2E.Message) *waE2E.Message {
+	for msg != nil {
+		inner := unwrapOnce(msg)
+		if inner == nil {
+			return msg
+		}
+		msg = inner
+	}
+	return nil
+}
+
+// unwrapOnce removes the outermost container of msg, returning nil if it has none.
+func unwrapOnce(msg *waE2E.Message) *waE2E.Message {
+	switch {
+	case msg.GetDeviceSentMessage().GetMessage() != nil:
+		return msg.GetDeviceSentMessage().GetMessage()
+	case msg.GetBotInvokeMessage().GetMessage() != nil:
+		return msg.GetBotInvokeMessage().GetMessage()
+	case msg.GetEphemeralMessage().GetMessage() != nil:
+		return msg.GetEphemeralMessage().GetMessage()
+	case msg.GetViewOnceMessage().GetMessage() != nil:
+		return msg.GetViewOnceMessage().GetMessage()
+	case msg.GetViewOnceMessageV2().GetMessage() != nil:
+		return msg.GetViewOnceMessageV2().GetMessage()
+	case msg.GetViewOnceMessageV2Extension().GetMessage() != nil:
+		return msg.GetViewOnceMessageV2Extension().GetMessage()
+	case msg.GetLottieStickerMessage().GetMessage() != nil:
+		return msg.GetLottieStickerMessage().GetMessage()
+	case msg.GetDocumentWithCaptionMessage().GetMessage() != nil:
+		return msg.GetDocumentWithCaptionMessage().GetMessage()
+	case msg.GetEditedMessage().GetMessage() != nil:
+		return msg.GetEditedMessage().GetMessage()
+	case msg.GetProtocolMessage().GetEditedMessage() != nil:
+		return msg.GetProtocolMessage().GetEditedMessage()
+	default:
+		return nil
+	}
+}
+
+// MessageType returns the kind of an (unwrapped) message as one of the local.Type* constants.
+func MessageType(msg *waE2E.Message) string {
+	switch {
+	case msg == nil:
+		return local.TypeUnknown
+	case msg.Conversation != nil || msg.ExtendedTextMessage != nil:
+		return local.TypeText
+	case msg.ImageMessage != nil:
+		return local.TypeImage
+	case msg.VideoMessage != nil || msg.PtvMessage != nil:
+		return local.TypeVideo
+	case msg.AudioMessage != nil:
+		return local.TypeAudio
+	case msg.StickerMessage != nil:
+		return local.TypeSticker
+	case msg.DocumentMessage != nil:
+		return local.TypeDocument
+	case msg.LocationMessage != nil:
+		return local.TypeLocation
+	case msg.LiveLocationMessage != nil:
+		return local.TypeLiveLocation
+	case msg.ContactMessage != nil:
+		return local.TypeContact
+	case msg.ContactsArrayMessage != nil:
+		return local.TypeContacts
+	case pollCreation(msg) != nil:
+		return local.TypePoll
+	case msg.PollUpdateMessage != nil:
+		return local.TypePollUpdate
+	case msg.ReactionMessage != nil:
+		return local.TypeReaction
+	case msg.ButtonsResponseMessage != nil:
+		return local.TypeButtonsResponse
+	case msg.ListResponseMessage != nil:
+		return local.TypeListResponse
+	case msg.TemplateButtonReplyMessage != nil:
+		return local.TypeTemplateReply
+	case msg.InteractiveResponseMessage != nil:
+		return local.TypeInteractiveResponse
+	case msg.GroupInviteMessage != nil:
+		return local.TypeGroupInvite
+	case msg.ProtocolMessage != nil:
+		return local.TypeProtocol
+	default:
+		return local.TypeUnknown
+	}
+}
+
+// CommandText returns the text of an (unwrapped) message that may contain a command:
+// the body of text messages and the caption of media. Names of contacts, polls and
+// locations are chosen by other people, so a contact named ".menu" must not run a command.
+func CommandText(msg *waE2E.Message) string {
+	if msg == nil {
+		return ""
+	}
 
 	switch {
-	case msg.ImageMessage != nil && msg.ImageMessage.Caption != nil:
-		return *msg.ImageMessage.Caption
-	case msg.VideoMessage != nil && msg.VideoMessage.Caption != nil:
-		return *msg.VideoMessage.Caption
-	case msg.ExtendedTextMessage != nil && msg.ExtendedTextMessage.Text != nil:
-		return *msg.ExtendedTextMessage.Text
-	case msg.DocumentMessage != nil && msg.DocumentMessage.Caption != nil:
-		return *msg.DocumentMessage.Caption
 	case msg.Conversation != nil:
-		return *msg.Conversation
+		return msg.GetConversation()
+	case msg.ExtendedTextMessage != nil:
+		return msg.GetExtendedTextMessage().GetText()
+	case msg.ImageMessage != nil:
+		return msg.GetImageMessage().GetCaption()
+	case msg.VideoMessage != nil:
+		return msg.GetVideoMessage().GetCaption()
+	case msg.PtvMessage != nil:
+		return msg.GetPtvMessage().GetCaption()
+	case msg.DocumentMessage != nil:
+		return msg.GetDocumentMessage().GetCaption()
 	default:
 		return ""
 	}
 }
 
+// IsEdit reports whether a raw message is an edit of an earlier message, in any of the
+// containers UnwrapMessage removes.
+func IsEdit(msg *waE2E.Message) bool {
+	for ; msg != nil; msg = unwrapOnce(msg) {
+		if msg.GetEditedMessage().GetMessage() != nil || msg.GetProtocolMessage().GetEditedMessage() != nil {
+			return true
+		}
+	}
+	return false
+}
 
-// GetQuotedText extracts the text content from a quoted message.
-func GetQuotedText(msg *waE2E.Message) string {
+// MessageText returns the text of an (unwrapped) message for display: the body of text
+// messages, the caption of media, the name of polls, contacts and locations, or the
+// selected id of button and list replies. Use CommandText for the text commands are
+// parsed from.
+func MessageText(msg *waE2E.Message) string {
 	if msg == nil {
 		return ""
 	}
+
 	switch {
-	case msg.ImageMessage != nil && msg.ImageMessage.Caption != nil:
-		return *msg.ImageMessage.Caption
-	case msg.VideoMessage != nil && msg.VideoMessage.Caption != nil:
-		return *msg.VideoMessage.Caption
-	case msg.ExtendedTextMessage != nil && msg.ExtendedTextMessage.Text != nil:
-		return *msg.ExtendedTextMessage.Text
-	case msg.DocumentMessage != nil && msg.DocumentMessage.Caption != nil:
-		return *msg.DocumentMessage.Caption
 	case msg.Conversation != nil:
-		return *msg.Conversation
+		return msg.GetConversation()
+	case msg.ExtendedTextMessage != nil:
+		return msg.GetExtendedTextMessage().GetText()
+	case msg.ImageMessage != nil:
+		return msg.GetImageMessage().GetCaption()
+	case msg.VideoMessage != nil:
+		return msg.GetVideoMessage().GetCaption()
+	case msg.PtvMessage != nil:
+		return msg.GetPtvMessage().GetCaption()
+	case msg.DocumentMessage != nil:
+		return msg.GetDocumentMessage().GetCaption()
+	case msg.LiveLocationMessage != nil:
+		return msg.GetLiveLocationMessage().GetCaption()
+	case msg.LocationMessage != nil:
+		return firstNonEmpty(msg.GetLocationMessage().GetComment(), msg.GetLocationMessage().GetName(), msg.GetLocationMessage().GetAddress())
+	case msg.ContactMessage != nil:
+		return msg.GetContactMessage().GetDisplayName()
+	case msg.ContactsArrayMessage != nil:
+		return msg.GetContactsArrayMessage().GetDisplayName()
+	case pollCreation(msg) != nil:
+		return pollCreation(msg).GetName()
+	case msg.ButtonsResponseMessage != nil:
+		return firstNonEmpty(msg.GetButtonsResponseMessage().GetSelectedButtonID(), msg.GetButtonsResponseMessage().GetSelectedDisplayText())
+	case msg.ListResponseMessage != nil:
+		return firstNonEmpty(msg.GetListResponseMessage().GetSingleSelectReply().GetSelectedRowID(), msg.GetListResponseMessage().GetTitle())
+	case msg.TemplateButtonReplyMessage != nil:
+		return firstNonEmpty(msg.GetTemplateButtonReplyMessage().GetSelectedID(), msg.GetTemplateButtonReplyMessage().GetSelectedDisplayText())
+	case msg.InteractiveResponseMessage != nil:
+		return interactiveResponseText(msg.GetInteractiveResponseMessage())
+	case msg.GroupInviteMessage != nil:
+		return msg.GetGroupInviteMessage().GetCaption()
 	default:
 		return ""
 	}
 }
 
+// ContextInfoOf returns the ContextInfo of an (unwrapped) message, whatever its type.
+// Text, media captions, locations, contacts, polls and button replies all carry their
+// quote and mentions in a ContextInfo field of their own.
+//
+// Parameters:
+//   msg: The unwrapped message.
+//
+// Returns:
+//   The message's ContextInfo, or nil if it has none.
+func ContextInfoOf(msg *waE2E.Message) *waE2E.ContextInfo {
+	if msg == nil {
+		return nil
+	}
+
+	var contextInfo *waE2E.ContextInfo
+	msg.ProtoReflect().Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if fd.Kind() != protoreflect.MessageKind || fd.IsList() || fd.IsMap() {
+			return true
+		}
+		if content, ok := v.Message().Interface().(interface{ GetContextInfo() *waE2E.ContextInfo }); ok && content.GetContextInfo() != nil {
+			contextInfo = content.GetContextInfo()
+			return false
+		}
+		return true
+	})
+	return contextInfo
+}
+
+// MentionsOf returns the users mentioned in a ContextInfo. Invalid JIDs are skipped.
+func MentionsOf(contextInfo *waE2E.ContextInfo) []types.JID {
+	mentioned := []types.JID{}
+	for _, jid := range contextInfo.GetMentionedJID() {
+		if parsed, err := types.ParseJID(jid); err == nil {
+			mentioned = append(mentioned, parsed)
+		}
+	}
+	return mentioned
+}
+
+// pollCreation returns the poll of a message, whichever protocol version it uses.
+func pollCreation(msg *waE2E.Message) *waE2E.PollCreationMessage {
+	switch {
+	case msg.PollCreationMessage != nil:
+		return msg.GetPollCreationMessage()
+	case msg.PollCreationMessageV2 != nil:
+		return msg.GetPollCreationMessageV2()
+	case msg.PollCreationMessageV3 != nil:
+		return msg.GetPollCreationMessageV3()
+	case msg.GetPollCreationMessageV4().GetMessage().GetPollCreationMessage() != nil:
+		return msg.GetPollCreationMessageV4().GetMessage().GetPollCreationMessage()
+	case msg.GetPollCreationMessageV5().GetMessage().GetPollCreationMessage() != nil:
+		return msg.GetPollCreationMessageV5().GetMessage().GetPollCreationMessage()
+	default:
+		return nil
+	}
+}
+
+// interactiveResponseText returns the id of the selected native flow option, which
+// carries the command for interactive buttons, or the response body otherwise.
+func interactiveResponseText(msg *waE2E.InteractiveResponseMessage) string {
+	var params struct {
+		ID string `json:"id"`
+	}
+	if json.Unmarshal([]byte(msg.GetNativeFlowResponseMessage().GetParamsJSON()), &params) == nil && params.ID != "" {
+		return params.ID
+	}
+	return msg.GetBody().GetText()
+}
+
+// firstNonEmpty returns the first of values that is not empty.
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
 // GetPrefix checks if a given text starts with one of the recognized command prefixes.
-// The list of valid prefixes is defined in the config package.
+// The list of valid prefixes is defined in the config package, per account (see config.For).
 //
 // Parameters:
 //   text: The string to check for a prefix.
+//   prefixes: The prefixes of the account the message was received on.
 //
 // Returns:
 //   A string containing the detected prefix if found. Returns an empty string if
 //   the text does not start with a valid prefix.
-func GetPrefix(text string) string {
+func GetPrefix(text string, prefixes []string) string {
 	if len(text) == 0 {
 		return ""
 	}
 
-	for _, prefix := range config.Prefixes {
+	for _, prefix := range prefixes {
 		if strings.HasPrefix(text, prefix) {
 			return prefix
 		}
@@ -8,6 +8,8 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -20,9 +22,25 @@ var httpClient = &http.Client{
 	Timeout: 30 * time.Second,
 }
 
+// UseTransport makes every HTTP request of SeaaveyAPIs, FetchBuffer and GetContentType go
+// through rt instead of the network, e.g. so that replays and tests are reproducible.
+//
+// Parameters:
+//   - rt: the transport to use; nil restores the default transport
+//
+// Returns:
+//   - func(): restores the transport that was used before
+func UseTransport(rt http.RoundTripper) func() {
+	previous := httpClient.Transport
+	httpClient.Transport = rt
+	return func() { httpClient.Transport = previous }
+}
+
 // SeaaveyAPIs performs an HTTP GET request to the Seaavey API with the specified endpoint and parameters.
 // It automatically builds the full URL with query parameters, sends the request, and returns
-// a ResponseAPIs struct with the response data.
+// a ResponseAPIs struct with the response data. Responses stored in DefaultCache with
+// StoreResponse are served from it until they expire; nothing is stored here, because
+// an API may report an error in a body sent with status 200.
 //
 // Parameters:
 //   - endpoint: path after base URL, e.g. "downloader/tiktok"
@@ -44,6 +62,11 @@ func SeaaveyAPIs(endpoint string, params map[string]string) (*types.ResponseAPIs
 	}
 
 	fullURL := base + endpoint + "?" + query.Encode()
+	if cached, ok := DefaultCache.GetResponse(fullURL); ok {
+		cached.URL, cached.Cached = fullURL, true
+		return cached, nil
+	}
+
 	req, err := http.NewRequest("GET", fullURL, nil)
 	if err != nil {
 		return nil, err
@@ -60,15 +83,52 @@ func SeaaveyAPIs(endpoint string, params map[string]string) (*types.ResponseAPIs
 		return nil, err
 	}
 
-	return &types.ResponseAPIs{
+	res := &types.ResponseAPIs{
+		URL:     fullURL,
 		Status:  resp.StatusCode,
 		Body:    body,
 		Headers: resp.Header,
-	}, nil
+	}
+	return res, nil
+}
+
+// StoreResponse stores a response of SeaaveyAPIs in DefaultCache, so that the same
+// request is answered from the cache until config.CacheTTL has passed. Call it once the
+// body has been checked, so that error replies are not served again.
+//
+// Parameters:
+//   - res: the response; responses from the cache, without status 200 or without a
+//     body are not stored
+func StoreResponse(res *types.ResponseAPIs) {
+	if !res.Cached && res.Status == http.StatusOK && len(res.Body) > 0 {
+		_ = DefaultCache.SetResponse(res.URL, res)
+	}
+}
+
+// requestKey returns the key a download is cached under: url, plus the request headers,
+// which may change the response (e.g. a cookie or a range).
+func requestKey(url string, headers map[string]string) string {
+	if len(headers) == 0 {
+		return url
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var key strings.Builder
+	key.WriteString(url)
+	for _, name := range names {
+		key.WriteString("\n" + http.CanonicalHeaderKey(name) + ": " + headers[name])
+	}
+	return key.String()
 }
 
 // FetchBuffer performs a generic HTTP GET request to the specified URL with optional headers,
-// returning the response body as a byte slice.
+// returning the response body as a byte slice. Successful downloads are stored in
+// DefaultCache by content hash, so the same URL with the same headers is only
+// downloaded once.
 //
 // Parameters:
 //   - url: the full URL to fetch
@@ -78,6 +138,11 @@ func SeaaveyAPIs(endpoint string, params map[string]string) (*types.ResponseAPIs
 //   - []byte: response body bytes
 //   - error: if request creation, network call, or reading response fails
 func FetchBuffer(url string, headers map[string]string) ([]byte, error) {
+	key := requestKey(url, headers)
+	if data, ok := DefaultCache.GetMedia(key); ok {
+		return data, nil
+	}
+
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return nil, err
@@ -93,7 +158,16 @@ func FetchBuffer(url string, headers map[string]string) ([]byte, error) {
 	}
 	defer resp.Body.Close()
 
-	return io.ReadAll(resp.Body)
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 && len(data) > 0 {
+		_, _ = DefaultCache.SetMedia(key, data)
+	}
+
+	return data, nil
 }
 
 
@@ -122,7 +196,8 @@ func FetchBuffer(url string, headers map[string]string) ([]byte, error) {
 //
 func GetContentType(url string) (string, error) {
 	client := &http.Client{
-		Timeout: 10 * time.Second,
+		Transport: httpClient.Transport,
+		Timeout:   10 * time.Second,
 	}
 	resp, err := client.Head(url)
 	if err != nil {
@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// countingTransport answers every request with body and counts the requests per URL
+// and Cookie header.
+type countingTransport struct {
+	mu    sync.Mutex
+	body  string
+	calls map[string]int
+}
+
+// RoundTrip implements http.RoundTripper.
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.mu.Lock()
+	c.calls[req.URL.String()+" "+req.Header.Get("Cookie")]++
+	body := c.body
+	c.mu.Unlock()
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+// withTestCache makes DefaultCache an empty cache in a temporary directory.
+func withTestCache(t *testing.T) {
+	t.Helper()
+	cache := DefaultCache
+	DefaultCache = NewCache(t.TempDir(), cache.ttl, cache.maxSize)
+	t.Cleanup(func() { DefaultCache = cache })
+}
+
+func TestSeaaveyAPIsCachesOnlyStoredResponses(t *testing.T) {
+	withTestCache(t)
+	rt := &countingTransport{body: `{"status":500}`, calls: map[string]int{}}
+	t.Cleanup(UseTransport(rt))
+
+	params := map[string]string{"url": "https://example.com/a"}
+	if _, err := SeaaveyAPIs("downloader/test", params); err != nil {
+		t.Fatal(err)
+	}
+
+	// The error reply was not stored, so the next request goes upstream again
+	rt.body = `{"status":200}`
+	res, err := SeaaveyAPIs("downloader/test", params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res.Body) != rt.body || res.Cached {
+		t.Fatalf("second response = %s (cached %v), want a fresh %s", res.Body, res.Cached, rt.body)
+	}
+	StoreResponse(res)
+
+	res, err = SeaaveyAPIs("downloader/test", params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Cached || string(res.Body) != `{"status":200}` {
+		t.Errorf("third response = %s (cached %v), want the stored one", res.Body, res.Cached)
+	}
+	if total := len(rt.calls); total != 1 || rt.calls[res.URL+" "] != 2 {
+		t.Errorf("requests = %v, want 2 to %s", rt.calls, res.URL)
+	}
+}
+
+func TestFetchBufferKeysByHeaders(t *testing.T) {
+	withTestCache(t)
+	rt := &countingTransport{body: "data", calls: map[string]int{}}
+	t.Cleanup(UseTransport(rt))
+
+	url := "https://example.com/file"
+	for _, cookie := range []string{"a", "b", "a"} {
+		if _, err := FetchBuffer(url, map[string]string{"cookie": cookie}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if rt.calls[url+" a"] != 1 || rt.calls[url+" b"] != 1 {
+		t.Errorf("requests = %v, want one per cookie", rt.calls)
+	}
+}
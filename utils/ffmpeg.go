@@ -0,0 +1,74 @@
+// Package utils provides helper functions and utilities for the bot.
+// This file, ffmpeg.go, wraps an optional local ffmpeg installation used for
+// video frames and media conversion.
+package utils
+
+import (
+	"aemy/config"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// ErrFFmpegUnavailable is returned when ffmpeg is required but not installed.
+var ErrFFmpegUnavailable = errors.New("ffmpeg is not available")
+
+// FFmpegAvailable reports whether the configured ffmpeg executable can be found.
+func FFmpegAvailable() bool {
+	_, err := exec.LookPath(config.FFmpegPath)
+	return err == nil
+}
+
+// FFmpeg runs ffmpeg on input and returns the produced output file.
+// The input is written to a temporary file with the given extension, and ffmpeg is
+// invoked as `ffmpeg -y -i <input> <args...> <output>`. ffmpeg is killed when ctx is
+// done or after config.FFmpegTimeout, whichever comes first.
+//
+// Parameters:
+//   - ctx: context for the conversion
+//   - input: the raw media bytes
+//   - inputExt: file extension for the input, e.g. ".mp4"
+//   - outputExt: file extension for the output, which selects the muxer, e.g. ".jpg"
+//   - args: additional ffmpeg arguments placed between input and output
+//
+// Returns:
+//   - []byte: the contents of the output file
+//   - error: ErrFFmpegUnavailable if ffmpeg is missing, or the ffmpeg error output
+func FFmpeg(ctx context.Context, input []byte, inputExt, outputExt string, args ...string) ([]byte, error) {
+	if !FFmpegAvailable() {
+		return nil, ErrFFmpegUnavailable
+	}
+
+	dir, err := os.MkdirTemp("", "aemy-ffmpeg-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	in := filepath.Join(dir, "input"+inputExt)
+	out := filepath.Join(dir, "output"+outputExt)
+	if err := os.WriteFile(in, input, 0o600); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, config.FFmpegTimeout)
+	defer cancel()
+
+	cmdArgs := append([]string{"-y", "-loglevel", "error", "-i", in}, args...)
+	cmd := exec.CommandContext(ctx, config.FFmpegPath, append(cmdArgs, out)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("ffmpeg error: %w", ctx.Err())
+		}
+		return nil, fmt.Errorf("ffmpeg error: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return os.ReadFile(out)
+}
@@ -1,24 +1,30 @@
 package utils
 
 import (
+	"aemy/i18n"
 	"time"
 
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
 )
 
-func Ucapan() string {
-	jam := time.Now().Hour()
+// Ucapan returns a greeting in lang for the current time of day in loc,
+// e.g. the recipient's language and timezone from Messages.Lang and Messages.TimeZone.
+func Ucapan(lang string, loc *time.Location) string {
+	if loc == nil {
+		loc = DefaultLocation()
+	}
+	jam := time.Now().In(loc).Hour()
 
 	switch {
 	case jam >= 5 && jam < 11:
-		return "Selamat Pagi 🌅"
+		return i18n.T(lang, "greeting.morning")
 	case jam >= 11 && jam < 15:
-		return "Selamat Siang 🌞"
+		return i18n.T(lang, "greeting.day")
 	case jam >= 15 && jam < 18:
-		return "Selamat Sore 🌇"
+		return i18n.T(lang, "greeting.afternoon")
 	default:
-		return "Selamat Malam 🌙"
+		return i18n.T(lang, "greeting.evening")
 	}
 }
 
@@ -1,68 +1,267 @@
 // Package utils provides helper functions and utilities for the bot.
-// This file, logger.go, implements a simple, colorful, and formatted logger
-// for displaying messages at different severity levels (Info, Error, Warn, Debug).
+// This file, logger.go, implements the bot's structured, leveled logger. It writes
+// colored lines or JSON to the console and, optionally, JSON to a rotating log file.
+// whatsmeow's own logs are routed through the same backend via WALogger.
 package utils
 
 import (
+	"aemy/config"
+	local "aemy/types"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"time"
-)
 
-// ANSI color codes for formatting log messages in the console.
-const (
-	Reset  = "\033[0m"
-	Green  = "\033[32m"
-	Red    = "\033[31m"
-	Yellow = "\033[33m"
-	Cyan   = "\033[36m"
-	Gray   = "\033[90m"
+	"github.com/rs/zerolog"
+	waLog "go.mau.fi/whatsmeow/util/log"
 )
 
-// timestamp generates a formatted string of the current time in the "Asia/Jakarta" (WIB) timezone.
-// It falls back to a fixed UTC+7 offset if the timezone cannot be loaded.
+// Log is the application logger. It prints to the console at info level until
+// InitLogger applies the configuration.
+var Log = zerolog.New(output).Level(zerolog.InfoLevel).With().Timestamp().Logger()
+
+// output is the writer of Log and of every logger derived from it, such as whatsmeow's.
+var output = &logOutput{console: consoleWriter(os.Stdout)}
+
+// logOutput writes log entries to the console and, while one is open, to the log file.
+// Loggers keep the writer they were created with, so InitLogger and CloseLogger switch
+// the destinations here instead; no logger ever writes to a closed file.
+type logOutput struct {
+	// mu guards console and file; writes hold it for reading, so a file is only closed
+	// once no write is using it anymore.
+	mu      sync.RWMutex
+	console io.Writer
+	file    *RotatingFile
+}
+
+// Write writes p to the console and the log file.
+func (o *logOutput) Write(p []byte) (int, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	_, err := o.console.Write(p)
+	if o.file != nil {
+		if _, fileErr := o.file.Write(p); err == nil {
+			err = fileErr
+		}
+	}
+	return len(p), err
+}
+
+// set switches to console and file, and returns the log file used before, if any.
+func (o *logOutput) set(console io.Writer, file *RotatingFile) *RotatingFile {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	previous := o.file
+	o.console, o.file = console, file
+	return previous
+}
+
+// logLocation is the timezone log timestamps are printed in (config.Timezone).
+// It is resolved once, and again by InitLogger. It is atomic because every log
+// entry reads it, possibly while InitLogger runs.
+var logLocation atomic.Pointer[time.Location]
+
+func init() {
+	logLocation.Store(DefaultLocation())
+	zerolog.TimestampFunc = func() time.Time {
+		return time.Now().In(logLocation.Load())
+	}
+}
+
+// consoleWriter returns a colored, human-readable writer for out, with timestamps in logLocation.
+func consoleWriter(out io.Writer) zerolog.ConsoleWriter {
+	return zerolog.ConsoleWriter{Out: out, TimeFormat: "2006-01-02 15:04:05", TimeLocation: logLocation.Load()}
+}
+
+// InitLogger configures Log from config.LogLevel, config.LogFormat, config.LogFile and config.Timezone.
+// It should be called once at startup, before the client is created.
 //
 // Returns:
-//   A string representing the current timestamp (e.g., "2006-01-02 15:04:05").
-func timestamp() string {
-	loc, err := time.LoadLocation("Asia/Jakarta")
+//   - error: if the level or format is invalid or the log file cannot be opened.
+//     Log keeps writing to the console in that case.
+func InitLogger() error {
+	logLocation.Store(DefaultLocation())
+
+	level, console, err := logConfig()
 	if err != nil {
-		loc = time.FixedZone("WIB", 7*3600)
+		return err
+	}
+
+	var file *RotatingFile
+	if config.LogFile != "" {
+		if file, err = NewRotatingFile(config.LogFile, config.LogMaxSize, config.LogMaxBackups); err != nil {
+			return err
+		}
+	}
+	if previous := output.set(console, file); previous != nil {
+		_ = previous.Close()
+	}
+
+	Log = zerolog.New(output).Level(level).With().Timestamp().Logger()
+	return nil
+}
+
+// CheckLogger validates config.LogLevel, config.LogFormat and config.LogFile like
+// InitLogger, without applying them. The log file, which may belong to a running bot,
+// is neither opened nor rotated.
+//
+// Returns:
+//   - error: if the level or format is invalid, or the log file is a directory or has
+//     a file in place of its directory
+func CheckLogger() error {
+	if _, _, err := logConfig(); err != nil {
+		return err
+	}
+	if config.LogFile == "" {
+		return nil
+	}
+
+	if stat, err := os.Stat(config.LogFile); err == nil && stat.IsDir() {
+		return fmt.Errorf("log file %s is a directory", config.LogFile)
+	}
+	// The file and its missing directories are created on startup
+	for dir := filepath.Dir(config.LogFile); ; dir = filepath.Dir(dir) {
+		stat, err := os.Stat(dir)
+		if err == nil {
+			if !stat.IsDir() {
+				return fmt.Errorf("log directory %s is not a directory", dir)
+			}
+			return nil
+		}
+		if !os.IsNotExist(err) || dir == filepath.Dir(dir) {
+			return err
+		}
+	}
+}
+
+// logConfig parses config.LogLevel and config.LogFormat.
+//
+// Returns:
+//   - zerolog.Level: the level
+//   - io.Writer: the console writer for the format
+//   - error: if the level or format is invalid
+func logConfig() (zerolog.Level, io.Writer, error) {
+	level, err := zerolog.ParseLevel(config.LogLevel)
+	if err != nil || level == zerolog.NoLevel {
+		return 0, nil, fmt.Errorf("invalid log level %q", config.LogLevel)
+	}
+
+	switch config.LogFormat {
+	case "console", "":
+		return level, consoleWriter(os.Stdout), nil
+	case "json":
+		return level, os.Stdout, nil
+	default:
+		return 0, nil, fmt.Errorf("invalid log format %q", config.LogFormat)
+	}
+}
+
+// CloseLogger flushes and closes the log file, if one is open. Later entries only go to
+// the console, including those of loggers created before, such as whatsmeow's.
+func CloseLogger() {
+	output.mu.Lock()
+	file := output.file
+	output.file = nil
+	output.mu.Unlock()
+
+	if file != nil {
+		_ = file.Close()
+	}
+}
+
+// WALogger returns a whatsmeow logger that writes through Log, tagged with module.
+//
+// Parameters:
+//   - module: the whatsmeow component, e.g. "Client" or "Database"
+//
+// Returns:
+//   - waLog.Logger: the logger to pass to whatsmeow
+func WALogger(module string) waLog.Logger {
+	return waLog.Zerolog(Log.With().Str("module", module).Logger())
+}
+
+// AccountWALogger is like WALogger, with the entries also tagged with the bot account
+// they belong to (its phone number, or "new" while it is being linked).
+func AccountWALogger(module, account string) waLog.Logger {
+	return waLog.Zerolog(Log.With().Str("module", module).Str("account", account).Logger())
+}
+
+// NewRequestID returns a short random ID that ties together the log entries of one handled message.
+func NewRequestID() string {
+	b := make([]byte, 6)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// MessageLogger returns a logger carrying the account, chat, sender, command and request ID of a message.
+//
+// Parameters:
+//   - m: the serialized message
+//   - requestID: the ID of this request, see NewRequestID
+//
+// Returns:
+//   - zerolog.Logger: the contextual logger
+func MessageLogger(m local.Messages, requestID string) zerolog.Logger {
+	ctx := Log.With().
+		Str("request_id", requestID).
+		Str("account", m.Account).
+		Str("chat", m.From.String()).
+		Str("sender", m.Sender.String()).
+		Str("message_id", m.ID)
+	if m.Command != "" {
+		ctx = ctx.Str("command", m.Command)
+	}
+	return ctx.Logger()
+}
+
+// LoggerFrom returns the logger attached to ctx by the event handler, or Log if there is none.
+// Commands use it so their entries carry the fields of the message being handled.
+func LoggerFrom(ctx context.Context) *zerolog.Logger {
+	if logger := zerolog.Ctx(ctx); logger.GetLevel() != zerolog.Disabled {
+		return logger
 	}
-	return time.Now().In(loc).Format("2006-01-02 15:04:05")
+	return &Log
 }
 
-// Info logs a message at the INFO level with a green color.
+// Info logs a message at the INFO level.
 // Use this for general application information.
 //
 // Parameters:
 //   msg: The message string to be logged.
 func Info(msg string) {
-	fmt.Printf("%s[%s] [INFO] %s%s\n", Green, timestamp(), msg, Reset)
+	Log.Info().Msg(msg)
 }
 
-// Error logs a message at the ERROR level with a red color.
+// Error logs a message at the ERROR level.
 // Use this for critical errors that prevent normal operation.
 //
 // Parameters:
 //   msg: The message string to be logged.
 func Error(msg string) {
-	fmt.Printf("%s[%s] [ERROR] %s%s\n", Red, timestamp(), msg, Reset)
+	Log.Error().Msg(msg)
 }
 
-// Warn logs a message at the WARN level with a yellow color.
+// Warn logs a message at the WARN level.
 // Use this for potential issues that do not stop the application.
 //
 // Parameters:
 //   msg: The message string to be logged.
 func Warn(msg string) {
-	fmt.Printf("%s[%s] [WARN] %s%s\n", Yellow, timestamp(), msg, Reset)
+	Log.Warn().Msg(msg)
 }
 
-// Debug logs a message at the DEBUG level with a cyan color.
+// Debug logs a message at the DEBUG level.
 // Use this for detailed, verbose information useful for debugging.
 //
 // Parameters:
 //   msg: The message string to be logged.
 func Debug(msg string) {
-	fmt.Printf("%s[%s] [DEBUG] %s%s\n", Cyan, timestamp(), msg, Reset)
+	Log.Debug().Msg(msg)
 }
@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"aemy/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckLoggerLeavesLogFileAlone(t *testing.T) {
+	file, level, format := config.LogFile, config.LogLevel, config.LogFormat
+	t.Cleanup(func() { config.LogFile, config.LogLevel, config.LogFormat = file, level, format })
+
+	dir := t.TempDir()
+	config.LogLevel, config.LogFormat = "info", "json"
+
+	// A full log file is not rotated, and a missing one is not created
+	config.LogFile = filepath.Join(dir, "aemy.log")
+	if err := os.WriteFile(config.LogFile, []byte("{}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	maxSize := config.LogMaxSize
+	config.LogMaxSize = 1
+	t.Cleanup(func() { config.LogMaxSize = maxSize })
+	if err := CheckLogger(); err != nil {
+		t.Fatalf("CheckLogger: %v", err)
+	}
+	if _, err := os.Stat(config.LogFile + ".1"); !os.IsNotExist(err) {
+		t.Error("the log file was rotated")
+	}
+
+	config.LogFile = filepath.Join(dir, "logs", "aemy.log")
+	if err := CheckLogger(); err != nil {
+		t.Fatalf("CheckLogger with a missing directory: %v", err)
+	}
+	if _, err := os.Stat(filepath.Dir(config.LogFile)); !os.IsNotExist(err) {
+		t.Error("the log directory was created")
+	}
+
+	config.LogFile = dir
+	if err := CheckLogger(); err == nil {
+		t.Error("CheckLogger accepted a directory as the log file")
+	}
+
+	config.LogFile, config.LogFormat = filepath.Join(dir, "aemy.log"), "xml"
+	if err := CheckLogger(); err == nil {
+		t.Error("CheckLogger accepted an invalid format")
+	}
+}
+
+func TestCloseLoggerKeepsLoggersWorking(t *testing.T) {
+	file, format := config.LogFile, config.LogFormat
+	t.Cleanup(func() {
+		config.LogFile, config.LogFormat = file, format
+		CloseLogger()
+		_ = InitLogger()
+	})
+
+	config.LogFile, config.LogFormat = filepath.Join(t.TempDir(), "aemy.log"), "json"
+	if err := InitLogger(); err != nil {
+		t.Fatal(err)
+	}
+	// Loggers created before CloseLogger, like whatsmeow's, must not write to the closed file
+	logger := Log.With().Str("module", "test").Logger()
+	logger.Info().Msg("before")
+	CloseLogger()
+
+	stderr := os.Stderr
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stderr = w
+	logger.Info().Msg("after")
+	os.Stderr = stderr
+	w.Close()
+	var complaint [256]byte
+	if n, _ := r.Read(complaint[:]); n > 0 {
+		t.Errorf("logging after CloseLogger printed %q", complaint[:n])
+	}
+
+	data, err := os.ReadFile(config.LogFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "before") || strings.Contains(string(data), "after") {
+		t.Errorf("log file = %q, want only the entry from before CloseLogger", data)
+	}
+}
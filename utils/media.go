@@ -0,0 +1,271 @@
+// Package utils provides helper functions and utilities for the bot.
+// This file, media.go, builds and sends image, video, audio, document and
+// sticker messages from already loaded bytes.
+package utils
+
+import (
+	"aemy/config"
+	local "aemy/types"
+	"context"
+	"net/http"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+// mediaTarget describes where an outgoing media message goes and how it is attached
+// to the conversation. It is shared by the Messages helpers and the album sender.
+type mediaTarget struct {
+	// ctx is used for uploads and sends; cancelling it aborts them.
+	ctx context.Context
+
+	// client is the whatsmeow client used to upload and send.
+	client local.Client
+
+	// chat is the destination chat JID.
+	chat types.JID
+
+	// contextInfo is attached to every message, usually quoting the incoming message.
+	contextInfo *waE2E.ContextInfo
+
+	// messageContextInfo is set on the outer message, e.g. to associate it with an album.
+	messageContextInfo *waE2E.MessageContextInfo
+}
+
+// contextFor returns the ContextInfo for a message sent with opts: opts.ContextInfo
+// if given, otherwise the target's default (unless opts.NoQuote), plus any mentions.
+func (t mediaTarget) contextFor(opts local.Options) *waE2E.ContextInfo {
+	if opts.ContextInfo != nil {
+		return opts.ContextInfo
+	}
+
+	contextInfo := &waE2E.ContextInfo{}
+	if !opts.NoQuote && t.contextInfo != nil {
+		contextInfo = proto.Clone(t.contextInfo).(*waE2E.ContextInfo)
+	}
+	for _, jid := range opts.Mentions {
+		contextInfo.MentionedJID = append(contextInfo.MentionedJID, jid.String())
+	}
+	return contextInfo
+}
+
+// send uploads data and sends the message produced by build, attaching the message context.
+// With opts.NoCache, data is uploaded afresh and the upload is not cached.
+func (t mediaTarget) send(data []byte, mediaType whatsmeow.MediaType, opts local.Options, build func(whatsmeow.UploadResponse) *waE2E.Message) (whatsmeow.SendResponse, error) {
+	return sendUploaded(t.ctx, t.client, t.chat, data, mediaType, !opts.NoCache, func(uploaded whatsmeow.UploadResponse) *waE2E.Message {
+		msg := build(uploaded)
+		msg.MessageContextInfo = t.messageContextInfo
+		return msg
+	})
+}
+
+// sendImage sends data as an image, falling back to a document if WhatsApp cannot show it inline.
+func (t mediaTarget) sendImage(data []byte, origin string, opts local.Options) (whatsmeow.SendResponse, error) {
+	// Oversized or unsupported images are sent as documents
+	if NeedsDocument(data, whatsmeow.MediaImage) {
+		return t.sendDocument(data, origin, opts)
+	}
+
+	// Generate a downscaled thumbnail and read the image dimensions
+	media, err := ImageThumbnail(data)
+	if err != nil {
+		return t.sendDocument(data, origin, opts)
+	}
+
+	// Upload to WhatsApp (reusing a previous upload of the same bytes) and send message
+	return t.send(data, whatsmeow.MediaImage, opts, func(uploaded whatsmeow.UploadResponse) *waE2E.Message {
+		return &waE2E.Message{
+			ImageMessage: &waE2E.ImageMessage{
+				URL:           proto.String(uploaded.URL),
+				DirectPath:    proto.String(uploaded.DirectPath),
+				MediaKey:      uploaded.MediaKey,
+				Caption:       proto.String(opts.Caption),
+				Mimetype:      proto.String(http.DetectContentType(data)),
+				FileEncSHA256: uploaded.FileEncSHA256,
+				FileSHA256:    uploaded.FileSHA256,
+				FileLength:    proto.Uint64(uint64(len(data))),
+				JPEGThumbnail: media.Thumbnail,
+				Width:         proto.Uint32(media.Width),
+				Height:        proto.Uint32(media.Height),
+				ViewOnce:      proto.Bool(opts.ViewOnce),
+				ContextInfo:   t.contextFor(opts),
+			},
+		}
+	})
+}
+
+// sendVideo sends data as a video, falling back to a document if WhatsApp cannot show it inline.
+func (t mediaTarget) sendVideo(data []byte, origin string, opts local.Options) (whatsmeow.SendResponse, error) {
+	// Oversized or unsupported videos are sent as documents
+	if NeedsDocument(data, whatsmeow.MediaVideo) {
+		return t.sendDocument(data, origin, opts)
+	}
+
+	// Generate thumbnail from a video frame and read dimensions and duration
+	media := VideoThumbnail(t.ctx, data)
+
+	// Upload to WhatsApp (reusing a previous upload of the same bytes) and send message
+	return t.send(data, whatsmeow.MediaVideo, opts, func(uploaded whatsmeow.UploadResponse) *waE2E.Message {
+		return &waE2E.Message{
+			VideoMessage: &waE2E.VideoMessage{
+				URL:           proto.String(uploaded.URL),
+				DirectPath:    proto.String(uploaded.DirectPath),
+				MediaKey:      uploaded.MediaKey,
+				Caption:       proto.String(opts.Caption),
+				Mimetype:      proto.String(http.DetectContentType(data)),
+				FileEncSHA256: uploaded.FileEncSHA256,
+				FileSHA256:    uploaded.FileSHA256,
+				FileLength:    proto.Uint64(uint64(len(data))),
+				JPEGThumbnail: media.Thumbnail,
+				Width:         proto.Uint32(media.Width),
+				Height:        proto.Uint32(media.Height),
+				Seconds:       proto.Uint32(media.Seconds),
+				ViewOnce:      proto.Bool(opts.ViewOnce),
+				ContextInfo:   t.contextFor(opts),
+			},
+		}
+	})
+}
+
+// sendAudio sends data as an audio file or, with opts.PTT, as a voice note.
+func (t mediaTarget) sendAudio(data []byte, opts local.Options) (whatsmeow.SendResponse, error) {
+	// Voice notes must be Ogg/Opus. Without ffmpeg the audio is sent as a regular file.
+	ptt := opts.PTT
+	if ptt {
+		if opus, err := ToOpus(t.ctx, data); err == nil {
+			data = opus
+		} else {
+			ptt = false
+		}
+	}
+
+	// Read duration and waveform
+	media, wave := AudioInfo(t.ctx, data)
+	if !ptt {
+		wave = nil
+	}
+
+	// Upload to WhatsApp (reusing a previous upload of the same bytes) and send message
+	return t.send(data, whatsmeow.MediaAudio, opts, func(uploaded whatsmeow.UploadResponse) *waE2E.Message {
+		return &waE2E.Message{
+			AudioMessage: &waE2E.AudioMessage{
+				URL:           proto.String(uploaded.URL),
+				DirectPath:    proto.String(uploaded.DirectPath),
+				MediaKey:      uploaded.MediaKey,
+				Mimetype:      proto.String(AudioMimetype(data)),
+				FileEncSHA256: uploaded.FileEncSHA256,
+				FileSHA256:    uploaded.FileSHA256,
+				FileLength:    proto.Uint64(uint64(len(data))),
+				Seconds:       proto.Uint32(media.Seconds),
+				PTT:           proto.Bool(ptt),
+				Waveform:      wave,
+				ViewOnce:      proto.Bool(opts.ViewOnce && ptt),
+				ContextInfo:   t.contextFor(opts),
+			},
+		}
+	})
+}
+
+// sendDocument sends data as a document. It backs SendDocument and is the fallback
+// for images and videos WhatsApp cannot send as regular media.
+func (t mediaTarget) sendDocument(data []byte, origin string, opts local.Options) (whatsmeow.SendResponse, error) {
+	mimetype := opts.Mimetype
+	if mimetype == "" {
+		mimetype = http.DetectContentType(data)
+	}
+	fileName := opts.FileName
+	if fileName == "" {
+		fileName = FileName(origin, mimetype)
+	}
+
+	// Documents only get a preview if they are decodable images
+	media, _ := ImageThumbnail(data)
+
+	return t.send(data, whatsmeow.MediaDocument, opts, func(uploaded whatsmeow.UploadResponse) *waE2E.Message {
+		return &waE2E.Message{
+			DocumentMessage: &waE2E.DocumentMessage{
+				URL:           proto.String(uploaded.URL),
+				DirectPath:    proto.String(uploaded.DirectPath),
+				MediaKey:      uploaded.MediaKey,
+				Caption:       proto.String(opts.Caption),
+				Mimetype:      proto.String(mimetype),
+				FileName:      proto.String(fileName),
+				Title:         proto.String(fileName),
+				FileEncSHA256: uploaded.FileEncSHA256,
+				FileSHA256:    uploaded.FileSHA256,
+				FileLength:    proto.Uint64(uint64(len(data))),
+				JPEGThumbnail: media.Thumbnail,
+				ContextInfo:   t.contextFor(opts),
+			},
+		}
+	})
+}
+
+// SendDocumentTo sends data as a document to a chat other than the one a command came
+// from, e.g. to the owner's private chat.
+//
+// Parameters:
+//   - ctx: cancels the upload and send
+//   - client: the client to send with
+//   - to: the destination chat
+//   - data: the file
+//   - opts: the caption, file name and mimetype; the message quotes nothing
+//
+// Returns:
+//   - whatsmeow.SendResponse: the response of the send
+//   - error: if the upload or send fails
+func SendDocumentTo(ctx context.Context, client local.Client, to types.JID, data []byte, opts local.Options) (whatsmeow.SendResponse, error) {
+	target := mediaTarget{ctx: ctx, client: client, chat: to}
+	return target.sendDocument(data, opts.FileName, opts)
+}
+
+// SendImageTo sends data as an image to a chat other than the one a command came from,
+// e.g. to the sender's private chat.
+//
+// Parameters:
+//   - ctx: cancels the upload and send
+//   - client: the client to send with
+//   - to: the destination chat
+//   - data: the image
+//   - opts: the caption and mentions; the message quotes nothing
+//
+// Returns:
+//   - whatsmeow.SendResponse: the response of the send
+//   - error: if the upload or send fails
+func SendImageTo(ctx context.Context, client local.Client, to types.JID, data []byte, opts local.Options) (whatsmeow.SendResponse, error) {
+	target := mediaTarget{ctx: ctx, client: client, chat: to}
+	return target.sendImage(data, "", opts)
+}
+
+// sendSticker sends data as a sticker. Anything that is not WebP yet is converted
+// with MakeSticker using the configured pack name and author.
+func (t mediaTarget) sendSticker(data []byte, opts local.Options) (whatsmeow.SendResponse, error) {
+	animated := IsAnimatedWebP(data)
+	if http.DetectContentType(data) != "image/webp" {
+		sticker, isAnimated, err := MakeSticker(t.ctx, data, config.StickerPack, config.StickerAuthor)
+		if err != nil {
+			return whatsmeow.SendResponse{}, err
+		}
+		data, animated = sticker, isAnimated
+	}
+
+	return t.send(data, whatsmeow.MediaImage, opts, func(uploaded whatsmeow.UploadResponse) *waE2E.Message {
+		return &waE2E.Message{
+			StickerMessage: &waE2E.StickerMessage{
+				URL:           proto.String(uploaded.URL),
+				DirectPath:    proto.String(uploaded.DirectPath),
+				MediaKey:      uploaded.MediaKey,
+				Mimetype:      proto.String("image/webp"),
+				FileEncSHA256: uploaded.FileEncSHA256,
+				FileSHA256:    uploaded.FileSHA256,
+				FileLength:    proto.Uint64(uint64(len(data))),
+				Width:         proto.Uint32(StickerSize),
+				Height:        proto.Uint32(StickerSize),
+				IsAnimated:    proto.Bool(animated),
+				ContextInfo:   t.contextFor(opts),
+			},
+		}
+	})
+}
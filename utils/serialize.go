@@ -2,19 +2,14 @@ package utils
 
 import (
 	"aemy/config"
+	"aemy/i18n"
+	"aemy/outbox"
 	local "aemy/types"
-	"bytes"
 	"context"
 	"fmt"
-	"image"
-	"image/jpeg"
-	_ "image/png" // Import for decoding PNGs
-	"net/http"
 	"strings"
 	"time"
 
-	_ "golang.org/x/image/webp"
-
 	"go.mau.fi/whatsmeow"
 	"go.mau.fi/whatsmeow/proto/waCommon"
 	"go.mau.fi/whatsmeow/proto/waE2E"
@@ -23,31 +18,119 @@ import (
 	"google.golang.org/protobuf/proto"
 )
 
-// Serialize converts a raw WhatsApp incoming message event (ctx) into a structured Messages object.
+// Serialize converts a raw WhatsApp incoming message event (evt) into a structured Messages object.
 // It extracts command info, sender details, mentions, timestamps, and provides helper functions
 // for replying, reacting, and sending images.
 //
 // Parameters:
-//   - ctx: the WhatsApp message event received from whatsmeow
-//   - client: the whatsmeow client instance to send messages or reactions
+//   - ctx: the context the helpers send with; cancelling it aborts their downloads, uploads and sends.
+//     Their messages are queued with outbox.High priority.
+//   - evt: the WhatsApp message event received from whatsmeow
+//   - client: the client used to send messages or reactions (live, or a utilstest.FakeClient)
 //
 // Returns:
 //   - local.Messages: a fully parsed and ready-to-use message struct with methods to interact with WhatsApp
 //
 // Details:
 //   - Parses message text to find command and args based on a prefix (e.g., '!' or '.').
+//   - Detects the message type and unwraps ephemeral, view-once, device-sent and edited messages.
 //   - Identifies if sender is bot owner based on configured owners.
-//   - Extracts mentioned users if any in ExtendedTextMessage context.
+//   - Extracts mentioned users from the ContextInfo of any message type, including media captions.
+//   - Fills Quoted for replies to any message type, with the same fields and helpers as the message itself.
 //   - Provides Reply(text) function to send a quoted reply to the message.
 //   - Provides React(emoji) function to react with an emoji.
-//   - Provides SendImage(url, opts) function to download, upload, create thumbnail, and send an image message with optional caption.
+//   - Provides Delete() function to revoke the message (own messages, or others' as group admin).
+//   - Provides Download() on the message and on Quoted to fetch attached media.
+//   - Provides SendImage(src, opts) function to load, upload, create thumbnail, and send an image message with optional caption.
+//     All media helpers accept a local.MediaSource (URL, bytes, local file or io.Reader).
+//   - Provides SendAudio(src, opts) function to send audio files or, with opts.PTT, voice notes.
+//   - Provides SendSticker(src, opts) function to send a WebP sticker, converting other images and videos first.
+//   - Provides SendAlbum(srcs, opts) function to send several images/videos as one album.
+//   - Provides SendDocument(src, opts) function to send any file as a document; SendImage and
+//     SendVideo fall back to it for files WhatsApp cannot send as regular media.
+
+func Serialize(ctx context.Context, evt *events.Message, client local.Client) local.Messages {
+	// Replies are queued before lower-priority messages such as broadcasts
+	ctx = outbox.WithPriority(ctx, outbox.High)
+	m := serializeMessage(ctx, client, evt.Info, evt.Message)
+
+	// The quoted message is read from the ContextInfo of any message type, not only text
+	contextInfo := ContextInfoOf(UnwrapMessage(evt.Message))
+	if contextInfo.GetQuotedMessage() != nil {
+		quoted := serializeMessage(ctx, client, quotedInfo(client, evt.Info, contextInfo), contextInfo.GetQuotedMessage())
+		if remote, err := types.ParseJID(contextInfo.GetRemoteJID()); err == nil && !remote.IsEmpty() && remote != evt.Info.Chat {
+			quoted.RemoteJID = remote
+		}
+		m.Quoted = &quoted
+	}
+
+	return m
+}
+
+// quotedInfo rebuilds the MessageInfo of a quoted message from the ContextInfo of the
+// reply. WhatsApp does not include the quoted message's timestamp or push name, so
+// these stay empty. The chat is always the chat of the reply: for replies to statuses
+// the ContextInfo names status@broadcast, which is kept in Messages.RemoteJID instead.
+func quotedInfo(client local.Client, reply types.MessageInfo, contextInfo *waE2E.ContextInfo) types.MessageInfo {
+	chat := reply.Chat
+	sender := chat
+	if participant, err := types.ParseJID(contextInfo.GetParticipant()); err == nil && !participant.IsEmpty() {
+		sender = participant
+	}
+
+	return types.MessageInfo{
+		MessageSource: types.MessageSource{
+			Chat:     chat,
+			Sender:   sender,
+			IsFromMe: isOwnJID(client, sender),
+			IsGroup:  chat.Server == types.GroupServer,
+		},
+		ID: contextInfo.GetStanzaID(),
+	}
+}
+
+// accountOf returns the phone number of the bot account client is logged in as.
+func accountOf(client local.Client) string {
+	if client == nil {
+		return ""
+	}
+	return client.OwnID().User
+}
+
+// isOwnJID reports whether jid belongs to the bot's own account, by phone number or LID.
+func isOwnJID(client local.Client, jid types.JID) bool {
+	if client == nil || jid.IsEmpty() {
+		return false
+	}
+	own, lid := client.OwnID(), client.OwnLID()
+	return (!own.IsEmpty() && jid.User == own.User) || (!lid.IsEmpty() && jid.User == lid.User)
+}
 
-func Serialize(ctx *events.Message, client *whatsmeow.Client) local.Messages {
-	loc, _ := time.LoadLocation("Asia/Jakarta")
-	body := GetText(ctx)
-	prefix := GetPrefix(body)
+// messageKey builds the key that reactions and revocations use to address a message.
+func messageKey(chat, sender types.JID, id types.MessageID, fromMe bool) *waCommon.MessageKey {
+	key := &waCommon.MessageKey{
+		RemoteJID: proto.String(chat.String()),
+		FromMe:    proto.Bool(fromMe),
+		ID:        proto.String(id),
+	}
+	if !fromMe && chat.Server != types.DefaultUserServer && chat.Server != types.HiddenUserServer {
+		key.Participant = proto.String(sender.ToNonAD().String())
+	}
+	return key
+}
+
+// serializeMessage builds the Messages for one message and wires its helpers so that
+// replies, reactions, deletions and media all target that message. The helpers send
+// with ctx, so cancelling it aborts their downloads, uploads and sends.
+func serializeMessage(ctx context.Context, client local.Client, info types.MessageInfo, raw *waE2E.Message) local.Messages {
+	loc := Location(info.Chat, info.Sender)
+	lang := i18n.For(info.Chat, info.Sender)
+	account := accountOf(client)
+	settings := config.For(account)
+	msg := UnwrapMessage(raw)
+	body := CommandText(msg)
+	prefix := GetPrefix(body, settings.Prefixes)
 	words := strings.Fields(body)
-	info := ctx.Info
 	cmd, args := "", []string{}
 
 	if len(words) > 0 && strings.HasPrefix(words[0], prefix) {
@@ -55,208 +138,170 @@ func Serialize(ctx *events.Message, client *whatsmeow.Client) local.Messages {
 		args = words[1:]
 	}
 
-	mentionedJIDs := []types.JID{}
-	if ctx.Message.ExtendedTextMessage != nil && ctx.Message.ExtendedTextMessage.ContextInfo != nil {
-		for _, jid := range ctx.Message.ExtendedTextMessage.ContextInfo.MentionedJID {
-			parsedJid, _ := types.ParseJID(jid)
-			mentionedJIDs = append(mentionedJIDs, parsedJid)
-		}
-	}
+	// Mentions live in the ContextInfo of text and captioned media alike
+	mentionedJIDs := MentionsOf(ContextInfoOf(msg))
 
-	var quotedMsg *local.Messages
-	if ctx.Message.ExtendedTextMessage != nil && ctx.Message.ExtendedTextMessage.ContextInfo.GetQuotedMessage() != nil {
-		quotedInfo := ctx.Message.ExtendedTextMessage.ContextInfo
-		quotedSenderJID, _ := types.ParseJID(quotedInfo.GetParticipant())
-
-		quotedMsg = &local.Messages{
-			ID:           quotedInfo.GetStanzaID(),
-			From:         info.Chat, // The chat is the same
-			Sender:       quotedSenderJID,
-			SenderUser:   quotedSenderJID.User,
-			SenderServer: quotedSenderJID.Server,
-			Body:         GetQuotedText(quotedInfo.GetQuotedMessage()),
-			Message:      quotedInfo.GetQuotedMessage(),
-		}
+	// Replies and media sent through the helpers quote this message
+	quote := &waE2E.ContextInfo{
+		StanzaID:      proto.String(info.ID),
+		Participant:   proto.String(info.Sender.String()),
+		QuotedMessage: raw,
 	}
+	target := mediaTarget{
+		ctx:         ctx,
+		client:      client,
+		chat:        info.Chat,
+		contextInfo: quote,
+	}
+
+	// Reactions and revocations address the message by key
+	key := messageKey(info.Chat, info.Sender, info.ID, info.IsFromMe)
 
 	return local.Messages{
-		From:         info.Chat,
-		FromUser:     info.Chat.User,
-		FromServer:   info.Chat.Server,
-		FromMe:       info.IsFromMe,
-		ID:           info.ID,
-		IsGroup:      info.IsGroup,
-		IsOwner:      info.IsFromMe || isOwner(info.Sender.User),
-		Sender:       info.Sender,
-		SenderUser:   info.Sender.User,
-		SenderServer: info.Sender.Server,
-		Pushname:     info.PushName,
-		Timestamp:    info.Timestamp.In(loc),
-		Prefix:       prefix,
-		Command:      cmd,
-		Args:         args,
-		Text:         strings.Join(args, " "),
-		Body:         body,
-		Mentioned:    mentionedJIDs,
-		Message:      ctx.Message,
-		Quoted:       quotedMsg,
+		From:          info.Chat,
+		FromUser:      info.Chat.User,
+		FromServer:    info.Chat.Server,
+		FromMe:        info.IsFromMe,
+		ID:            info.ID,
+		IsGroup:       info.IsGroup,
+		IsOwner:       info.IsFromMe || isOwner(settings.Owners, info.Sender.User),
+		IsGlobalOwner: isOwner(config.Owners, info.Sender.User),
+		Sender:        info.Sender,
+		SenderUser:    info.Sender.User,
+		SenderServer:  info.Sender.Server,
+		Account:       account,
+		Pushname:      info.PushName,
+		Timestamp:     info.Timestamp.In(loc),
+		TimeZone:      loc,
+		Lang:          lang,
+		Prefix:        prefix,
+		Command:       cmd,
+		Args:          args,
+		Type:          MessageType(msg),
+		IsEdit:        IsEdit(raw),
+		Text:          strings.Join(args, " "),
+		Body:          body,
+		Mentioned:     mentionedJIDs,
+		Message:       msg,
+		Client:        client,
+
+		Download: func() (*local.Media, error) {
+			return DownloadMedia(ctx, client, raw)
+		},
 
 		Reply: func(text string) error {
-				_, err := client.SendMessage(context.Background(), info.Chat, &waE2E.Message{
-					ExtendedTextMessage: &waE2E.ExtendedTextMessage{
-						Text: proto.String(text),
-						ContextInfo: &waE2E.ContextInfo{
-							StanzaID:      &info.ID,
-							Participant:   proto.String(info.Sender.String()),
-							QuotedMessage: ctx.Message,
-						},
-					},
-				})
-				return err
-			},
-
-			ReplyContext: func(text string, contextInfo *waE2E.ContextInfo) error {
-				// If no context info provided, use default quoted message context
-				if contextInfo == nil {
-					contextInfo = &waE2E.ContextInfo{
-						StanzaID:      &info.ID,
-						Participant:   proto.String(info.Sender.String()),
-						QuotedMessage: ctx.Message,
-					}
-				}
-				
-				_, err := client.SendMessage(context.Background(), info.Chat, &waE2E.Message{
-					ExtendedTextMessage: &waE2E.ExtendedTextMessage{
-						Text:        proto.String(text),
-						ContextInfo: contextInfo,
-					},
-				})
-				return err
-			},
+			_, err := client.SendMessage(ctx, info.Chat, &waE2E.Message{
+				ExtendedTextMessage: &waE2E.ExtendedTextMessage{
+					Text:        proto.String(text),
+					ContextInfo: quote,
+				},
+			})
+			return err
+		},
+
+		ReplyContext: func(text string, contextInfo *waE2E.ContextInfo) error {
+			// If no context info provided, use default quoted message context
+			if contextInfo == nil {
+				contextInfo = quote
+			}
+
+			_, err := client.SendMessage(ctx, info.Chat, &waE2E.Message{
+				ExtendedTextMessage: &waE2E.ExtendedTextMessage{
+					Text:        proto.String(text),
+					ContextInfo: contextInfo,
+				},
+			})
+			return err
+		},
 
 		React: func(emoji string) error {
-			_, err := client.SendMessage(context.Background(), info.Chat, &waE2E.Message{
+			_, err := client.SendMessage(ctx, info.Chat, &waE2E.Message{
 				ReactionMessage: &waE2E.ReactionMessage{
-					Key: &waCommon.MessageKey{
-						FromMe:    proto.Bool(info.IsFromMe),
-						ID:        proto.String(info.ID),
-						Participant: proto.String(info.Sender.String()),
-						RemoteJID: proto.String(info.Chat.String()),
-					},
-					Text: proto.String(emoji),
+					Key:               key,
+					Text:              proto.String(emoji),
+					SenderTimestampMS: proto.Int64(time.Now().UnixMilli()),
 				},
 			})
 			return err
 		},
 
-		SendImage: func(url string, opts local.Options) (whatsmeow.SendResponse, error) {
-			// Fetch file from URL
-			data, err := FetchBuffer(url, nil)
-			if err != nil {
-				return whatsmeow.SendResponse{}, fmt.Errorf("fetch error: %s", err)
-			}
+		Delete: func() error {
+			_, err := client.SendMessage(ctx, info.Chat, &waE2E.Message{
+				ProtocolMessage: &waE2E.ProtocolMessage{
+					Type: waE2E.ProtocolMessage_REVOKE.Enum(),
+					Key:  key,
+				},
+			})
+			return err
+		},
 
-			// Upload to WhatsApp
-			uploaded, err := client.Upload(context.Background(), data, whatsmeow.MediaImage)
+		SendImage: func(src local.MediaSource, opts local.Options) (whatsmeow.SendResponse, error) {
+			data, err := LoadMedia(src)
 			if err != nil {
-				return whatsmeow.SendResponse{}, fmt.Errorf("upload error: %s", err)
+				return whatsmeow.SendResponse{}, err
 			}
 
-			img, _, err := image.Decode(bytes.NewReader(data))
+			return target.sendImage(data, src.Origin(), opts)
+		},
 
+		SendVideo: func(src local.MediaSource, opts local.Options) (whatsmeow.SendResponse, error) {
+			data, err := LoadMedia(src)
 			if err != nil {
-				return whatsmeow.SendResponse{}, fmt.Errorf("decode image error: %s", err)
-			}
-			
-			var thumbnail bytes.Buffer
-			if err := jpeg.Encode(&thumbnail, img, &jpeg.Options{Quality: 20}); err != nil {
-				return whatsmeow.SendResponse{}, fmt.Errorf("encode thumbnail error: %s", err)
+				return whatsmeow.SendResponse{}, err
 			}
-			// Send message
-			msg := &waE2E.Message{
-				ImageMessage: &waE2E.ImageMessage{
-					URL:           proto.String(uploaded.URL),
-					DirectPath:    proto.String(uploaded.DirectPath),
-					MediaKey:      uploaded.MediaKey,
-					Caption:       proto.String(opts.Caption),
-					Mimetype:      proto.String(http.DetectContentType(data)),
-					FileEncSHA256: uploaded.FileEncSHA256,
-					FileSHA256:    uploaded.FileSHA256,
-					FileLength:    proto.Uint64(uint64(len(data))),
-					JPEGThumbnail: thumbnail.Bytes(),
-					ContextInfo:   &waE2E.ContextInfo{
-						StanzaID:      &info.ID,
-						Participant:   proto.String(info.Sender.String()),
-						QuotedMessage: ctx.Message,	
-					},
-				},
-			}
-			
-			ok, err := client.SendMessage(context.Background(), info.Chat, msg)
+
+			return target.sendVideo(data, src.Origin(), opts)
+		},
+
+		SendAudio: func(src local.MediaSource, opts local.Options) (whatsmeow.SendResponse, error) {
+			data, err := LoadMedia(src)
 			if err != nil {
-				return whatsmeow.SendResponse{}, fmt.Errorf("error send message %s", err)
+				return whatsmeow.SendResponse{}, err
 			}
-			
-			return ok, nil
+
+			return target.sendAudio(data, opts)
 		},
 
-		// BETA: Send a video
-		SendVideo: func(url string, opts local.Options) (whatsmeow.SendResponse, error) {
-			// Fetch file from URL
-			data, err := FetchBuffer(url, nil)
+		SendDocument: func(src local.MediaSource, opts local.Options) (whatsmeow.SendResponse, error) {
+			data, err := LoadMedia(src)
 			if err != nil {
-				return whatsmeow.SendResponse{}, fmt.Errorf("fetch error: %s", err)
+				return whatsmeow.SendResponse{}, err
 			}
 
-			// Upload to WhatsApp
-			uploaded, err := client.Upload(context.Background(), data, whatsmeow.MediaVideo)
+			return target.sendDocument(data, src.Origin(), opts)
+		},
+
+		SendSticker: func(src local.MediaSource, opts local.Options) (whatsmeow.SendResponse, error) {
+			data, err := LoadMedia(src)
 			if err != nil {
-				return whatsmeow.SendResponse{}, fmt.Errorf("upload error: %s", err)
+				return whatsmeow.SendResponse{}, err
 			}
 
-			// Generate thumbnail from first frame
-			var thumbnail bytes.Buffer
-			if img, _, err := image.Decode(bytes.NewReader(data)); err == nil {
-				if err := jpeg.Encode(&thumbnail, img, &jpeg.Options{Quality: 20}); err != nil {
-					return whatsmeow.SendResponse{}, fmt.Errorf("encode thumbnail error: %s", err)
-				}
-			}
+			return target.sendSticker(data, opts)
+		},
 
-			// Send message
-			msg := &waE2E.Message{
-				VideoMessage: &waE2E.VideoMessage{
-					URL:           proto.String(uploaded.URL), 
-					DirectPath:    proto.String(uploaded.DirectPath),
-					MediaKey:      uploaded.MediaKey,
-					Caption:       proto.String(opts.Caption),
-					Mimetype:      proto.String(http.DetectContentType(data)),
-					FileEncSHA256: uploaded.FileEncSHA256,
-					FileSHA256:    uploaded.FileSHA256,
-					FileLength:    proto.Uint64(uint64(len(data))),
-					JPEGThumbnail: thumbnail.Bytes(),
-					ContextInfo: &waE2E.ContextInfo{
-						StanzaID:      &info.ID,
-						Participant:   proto.String(info.Sender.String()),
-						QuotedMessage: ctx.Message,
+		SendAlbum: func(srcs []local.MediaSource, opts local.Options) error {
+			sent, failures := target.sendAlbum(srcs, opts)
+			if summary := AlbumSummary(lang, len(srcs), failures); summary != "" {
+				_, _ = client.SendMessage(ctx, info.Chat, &waE2E.Message{
+					ExtendedTextMessage: &waE2E.ExtendedTextMessage{
+						Text:        proto.String(summary),
+						ContextInfo: quote,
 					},
-				},
+				})
 			}
-
-			ok, err := client.SendMessage(context.Background(), info.Chat, msg)
-			if err != nil {
-				return whatsmeow.SendResponse{}, fmt.Errorf("error send message %s", err)
+			if sent == 0 && len(srcs) > 0 {
+				return fmt.Errorf("no album items could be sent")
 			}
-
-			return ok, nil
+			return nil
 		},
 	}
 }
 
-// isOwner checks if a given user ID is listed as an owner in the config.
+// isOwner checks if a given user ID is listed in owners, the owners of the account.
 // Returns true if user is an owner, false otherwise.
-
-func isOwner(user string) bool {
-	for _, owner := range config.Owners {
+func isOwner(owners []string, user string) bool {
+	for _, owner := range owners {
 		if owner == user {
 			return true
 		}
@@ -0,0 +1,47 @@
+// Package utils provides helper functions and utilities for the bot.
+// This file, source.go, loads the bytes of a media source for the send helpers.
+package utils
+
+import (
+	local "aemy/types"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// LoadMedia returns the bytes of a media source, downloading URLs through the
+// cache, reading local files and draining readers as needed.
+//
+// Parameters:
+//   - src: the media source, usually built with local.FromURL, FromBytes, FromFile or FromReader
+//
+// Returns:
+//   - []byte: the media bytes
+//   - error: if the source is empty or cannot be read
+func LoadMedia(src local.MediaSource) ([]byte, error) {
+	switch {
+	case src.Data != nil:
+		return src.Data, nil
+	case src.URL != "":
+		data, err := FetchBuffer(src.URL, nil)
+		if err != nil {
+			return nil, fmt.Errorf("fetch error: %s", err)
+		}
+		return data, nil
+	case src.Path != "":
+		data, err := os.ReadFile(src.Path)
+		if err != nil {
+			return nil, fmt.Errorf("read error: %s", err)
+		}
+		return data, nil
+	case src.Reader != nil:
+		data, err := io.ReadAll(src.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("read error: %s", err)
+		}
+		return data, nil
+	default:
+		return nil, errors.New("empty media source")
+	}
+}
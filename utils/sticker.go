@@ -0,0 +1,220 @@
+// Package utils provides helper functions and utilities for the bot.
+// This file, sticker.go, converts images and short videos into WhatsApp
+// stickers and stickers back into regular images.
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"net/http"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// StickerSize is the width and height of a WhatsApp sticker in pixels.
+const StickerSize = 512
+
+// MaxStickerSeconds is the longest video that is turned into an animated sticker.
+const MaxStickerSeconds = 10
+
+// MaxStickerBytes and MaxAnimatedStickerBytes are the largest static and animated
+// stickers WhatsApp accepts. Larger stickers are sent but never shown.
+const (
+	MaxStickerBytes         = 100 * 1024
+	MaxAnimatedStickerBytes = 500 * 1024
+)
+
+// ErrStickerTooLarge is returned when a sticker does not fit in the size limit even at
+// the lowest quality, e.g. for long, busy videos.
+var ErrStickerTooLarge = errors.New("sticker is too large")
+
+// stickerQualities are the libwebp qualities tried for static stickers, best first.
+var stickerQualities = []int{75, 50, 30}
+
+// animatedStickerSteps are the frame rates and libwebp qualities tried for animated
+// stickers, best first.
+var animatedStickerSteps = []struct{ fps, quality int }{{15, 50}, {12, 35}, {10, 20}}
+
+// stickerDroppedBits are the color bits cleared before encoding static stickers with
+// the built-in lossless encoder, best quality first.
+var stickerDroppedBits = []uint{0, 2, 3, 4}
+
+// stickerScale fits the input into a transparent StickerSize square, keeping its aspect ratio.
+var stickerScale = fmt.Sprintf("scale=%[1]d:%[1]d:force_original_aspect_ratio=decrease,format=rgba,pad=%[1]d:%[1]d:(ow-iw)/2:(oh-ih)/2:color=#00000000", StickerSize)
+
+// StickerExif builds the EXIF payload WhatsApp reads sticker pack metadata from:
+// a little-endian TIFF header with a single 0x5741 tag holding a JSON document.
+//
+// Parameters:
+//   - pack: the sticker pack name
+//   - author: the sticker pack publisher
+//
+// Returns:
+//   - []byte: the raw EXIF data for SetWebPExif
+func StickerExif(pack, author string) []byte {
+	metadata, _ := json.Marshal(map[string]any{
+		"sticker-pack-id":        "aemy-" + HashKey([]byte(pack + "\x00" + author))[:16],
+		"sticker-pack-name":      pack,
+		"sticker-pack-publisher": author,
+		"emojis":                 []string{""},
+	})
+
+	exif := []byte{
+		0x49, 0x49, 0x2a, 0x00, // "II", TIFF magic
+		0x08, 0x00, 0x00, 0x00, // offset of the first IFD
+		0x01, 0x00, // one entry
+		0x41, 0x57, // tag 0x5741
+		0x07, 0x00, // type UNDEFINED
+		0x00, 0x00, 0x00, 0x00, // count, filled in below
+		0x16, 0x00, 0x00, 0x00, // value offset
+	}
+	binary.LittleEndian.PutUint32(exif[14:], uint32(len(metadata)))
+	return append(exif, metadata...)
+}
+
+// MakeSticker converts an image or short video into a StickerSize WebP sticker
+// with pack metadata. Images are converted with ffmpeg when available and with the
+// built-in lossless encoder otherwise; videos and GIFs require ffmpeg. Animated WebP
+// files cannot be decoded by ffmpeg, so they become a static sticker of their first
+// frame. The quality is lowered step by step until the sticker fits in
+// MaxStickerBytes (MaxAnimatedStickerBytes if animated).
+//
+// Parameters:
+//   - ctx: context for running ffmpeg
+//   - data: the raw image or video bytes
+//   - pack: the sticker pack name
+//   - author: the sticker pack publisher
+//
+// Returns:
+//   - []byte: the sticker as WebP
+//   - bool: true if the sticker is animated
+//   - error: ErrFFmpegUnavailable for videos without ffmpeg, ErrStickerTooLarge if even
+//     the lowest quality is too large, or a conversion error
+func MakeSticker(ctx context.Context, data []byte, pack, author string) ([]byte, bool, error) {
+	if IsAnimatedWebP(data) {
+		frame, err := StickerToImage(data)
+		if err != nil {
+			return nil, false, err
+		}
+		data = frame
+	}
+
+	mimetype := http.DetectContentType(data)
+	animated := strings.HasPrefix(mimetype, "video/") || mimetype == "image/gif"
+	exif := StickerExif(pack, author)
+
+	var sticker []byte
+	var err error
+	switch {
+	case animated:
+		sticker, err = fitSticker(MaxAnimatedStickerBytes, exif, len(animatedStickerSteps), func(step int) ([]byte, error) {
+			s := animatedStickerSteps[step]
+			return FFmpeg(ctx, data, "", ".webp",
+				"-t", fmt.Sprint(MaxStickerSeconds), "-an",
+				"-vf", fmt.Sprintf("fps=%d,", s.fps)+stickerScale,
+				"-c:v", "libwebp", "-lossless", "0", "-q:v", fmt.Sprint(s.quality), "-loop", "0", "-preset", "default")
+		})
+	case FFmpegAvailable():
+		sticker, err = fitSticker(MaxStickerBytes, exif, len(stickerQualities), func(step int) ([]byte, error) {
+			return FFmpeg(ctx, data, "", ".webp",
+				"-vf", stickerScale, "-frames:v", "1",
+				"-c:v", "libwebp", "-lossless", "0", "-q:v", fmt.Sprint(stickerQualities[step]))
+		})
+	default:
+		var canvas *image.NRGBA
+		if canvas, err = stickerCanvas(data); err != nil {
+			return nil, false, err
+		}
+		sticker, err = fitSticker(MaxStickerBytes, exif, len(stickerDroppedBits), func(step int) ([]byte, error) {
+			return EncodeWebP(posterize(canvas, stickerDroppedBits[step]))
+		})
+	}
+	return sticker, animated, err
+}
+
+// fitSticker encodes a sticker with each of the given number of steps, from the best to
+// the lowest quality, and returns the first one that fits in limit with exif attached.
+func fitSticker(limit int, exif []byte, steps int, encode func(step int) ([]byte, error)) ([]byte, error) {
+	for step := 0; step < steps; step++ {
+		sticker, err := encode(step)
+		if err != nil {
+			return nil, err
+		}
+		if sticker, err = SetWebPExif(sticker, exif); err != nil {
+			return nil, err
+		}
+		if len(sticker) <= limit {
+			return sticker, nil
+		}
+	}
+	return nil, ErrStickerTooLarge
+}
+
+// stickerCanvas fits an image into a transparent StickerSize square for the built-in
+// WebP encoder.
+func stickerCanvas(data []byte) (*image.NRGBA, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		if img, err = DecodeWebP(data); err != nil {
+			return nil, fmt.Errorf("decode image error: %s", err)
+		}
+	}
+
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w >= h {
+		w, h = StickerSize, max(1, h*StickerSize/w)
+	} else {
+		w, h = max(1, w*StickerSize/h), StickerSize
+	}
+
+	canvas := image.NewNRGBA(image.Rect(0, 0, StickerSize, StickerSize))
+	x, y := (StickerSize-w)/2, (StickerSize-h)/2
+	draw.CatmullRom.Scale(canvas, image.Rect(x, y, x+w, y+h), img, bounds, draw.Over, nil)
+	return canvas, nil
+}
+
+// posterize returns a copy of img with the lowest bits of every color channel cleared.
+// The lossless encoder has no quality setting, but fewer distinct colors compress
+// much better.
+func posterize(img *image.NRGBA, bits uint) *image.NRGBA {
+	if bits == 0 {
+		return img
+	}
+	out := image.NewNRGBA(img.Rect)
+	mask := byte(0xff << bits)
+	for i, v := range img.Pix {
+		if i%4 == 3 {
+			out.Pix[i] = v // keep the alpha channel, so edges stay smooth
+		} else {
+			out.Pix[i] = v & mask
+		}
+	}
+	return out
+}
+
+// StickerToImage converts a sticker back into a PNG image. Animated stickers are
+// converted to their first frame.
+//
+// Returns:
+//   - []byte: the PNG image
+//   - error: if the sticker cannot be decoded
+func StickerToImage(data []byte) ([]byte, error) {
+	img, err := DecodeWebP(data)
+	if err != nil {
+		return nil, fmt.Errorf("decode sticker error: %s", err)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"aemy/config"
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"testing"
+)
+
+// withoutFFmpeg makes the test use the built-in encoder even where ffmpeg is installed.
+func withoutFFmpeg(t *testing.T) {
+	t.Helper()
+	path := config.FFmpegPath
+	config.FFmpegPath = "aemy-no-such-ffmpeg"
+	t.Cleanup(func() { config.FFmpegPath = path })
+}
+
+func TestMakeStickerFitsLimit(t *testing.T) {
+	withoutFFmpeg(t)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage(600, 400)); err != nil {
+		t.Fatal(err)
+	}
+
+	sticker, animated, err := MakeSticker(context.Background(), buf.Bytes(), "pack", "author")
+	if err != nil {
+		t.Fatalf("MakeSticker: %v", err)
+	}
+	if animated {
+		t.Error("animated = true for a PNG")
+	}
+	if len(sticker) > MaxStickerBytes {
+		t.Errorf("sticker is %d bytes, limit is %d", len(sticker), MaxStickerBytes)
+	}
+
+	img, err := DecodeWebP(sticker)
+	if err != nil {
+		t.Fatalf("DecodeWebP: %v", err)
+	}
+	if img.Bounds().Size() != image.Pt(StickerSize, StickerSize) {
+		t.Errorf("sticker size = %v, want %dx%[2]d", img.Bounds().Size(), StickerSize)
+	}
+}
+
+func TestFitStickerRejectsOversized(t *testing.T) {
+	tries := 0
+	_, err := fitSticker(10, nil, 3, func(step int) ([]byte, error) {
+		tries++
+		return EncodeWebP(testImage(32, 32))
+	})
+	if !errors.Is(err, ErrStickerTooLarge) {
+		t.Fatalf("err = %v, want ErrStickerTooLarge", err)
+	}
+	if tries != 3 {
+		t.Errorf("tried %d steps, want 3", tries)
+	}
+}
@@ -0,0 +1,195 @@
+// Package utils provides helper functions and utilities for the bot.
+// This file, thumbnail.go, generates the small JPEG previews and the
+// dimension/duration metadata WhatsApp expects on outgoing media messages.
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	_ "image/png" // Import for decoding PNGs
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// ThumbnailSize is the length in pixels of the longest side of a generated thumbnail.
+// WhatsApp only renders JPEGThumbnail as a blurred preview, so anything larger
+// just bloats the message.
+const ThumbnailSize = 100
+
+// thumbnailQuality is the JPEG quality used when encoding thumbnails.
+const thumbnailQuality = 60
+
+// MediaInfo holds the preview and metadata attached to an outgoing media message.
+// Fields that could not be determined are left at their zero value.
+type MediaInfo struct {
+	// Thumbnail is the JPEG preview shown before the media is downloaded.
+	Thumbnail []byte
+
+	// Width and Height are the dimensions of the original media in pixels.
+	Width  uint32
+	Height uint32
+
+	// Seconds is the duration of a video or audio file.
+	Seconds uint32
+}
+
+// ImageThumbnail decodes an image and returns a downscaled JPEG thumbnail
+// along with the original dimensions.
+//
+// Parameters:
+//   - data: the raw image bytes (JPEG, PNG or WebP)
+//
+// Returns:
+//   - MediaInfo: thumbnail, width and height of the image
+//   - error: if the image cannot be decoded or the thumbnail cannot be encoded
+func ImageThumbnail(data []byte) (MediaInfo, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return MediaInfo{}, err
+	}
+
+	thumb, err := encodeThumbnail(img)
+	if err != nil {
+		return MediaInfo{}, err
+	}
+
+	bounds := img.Bounds()
+	return MediaInfo{
+		Thumbnail: thumb,
+		Width:     uint32(bounds.Dx()),
+		Height:    uint32(bounds.Dy()),
+	}, nil
+}
+
+// VideoThumbnail extracts a representative frame from a video as a thumbnail and
+// reads its dimensions and duration. Dimensions and duration are read from the MP4
+// headers directly; the frame requires ffmpeg. It never fails: whatever cannot be
+// determined is left empty so the video can still be sent.
+//
+// Parameters:
+//   - ctx: context for running ffmpeg
+//   - data: the raw video bytes
+//
+// Returns:
+//   - MediaInfo: whatever thumbnail and metadata could be determined
+func VideoThumbnail(ctx context.Context, data []byte) MediaInfo {
+	var info MediaInfo
+	info.Width, info.Height, info.Seconds = probeMP4(data)
+
+	frame, err := FFmpeg(ctx, data, ".mp4", ".jpg", "-vf", "thumbnail", "-frames:v", "1")
+	if err != nil {
+		return info
+	}
+
+	if thumb, err := ImageThumbnail(frame); err == nil {
+		info.Thumbnail = thumb.Thumbnail
+		if info.Width == 0 || info.Height == 0 {
+			info.Width, info.Height = thumb.Width, thumb.Height
+		}
+	}
+	return info
+}
+
+// encodeThumbnail scales img so its longest side is ThumbnailSize, flattens it onto a
+// white background and encodes it as JPEG.
+func encodeThumbnail(img image.Image) ([]byte, error) {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w > ThumbnailSize || h > ThumbnailSize {
+		if w >= h {
+			w, h = ThumbnailSize, max(1, h*ThumbnailSize/w)
+		} else {
+			w, h = max(1, w*ThumbnailSize/h), ThumbnailSize
+		}
+	}
+
+	// JPEG has no alpha channel, so transparent areas are drawn onto white instead of black
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Over, nil)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: thumbnailQuality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// probeMP4 reads the video dimensions and duration from the moov box of an MP4 file.
+// It returns zeros for anything it cannot find, e.g. for non-MP4 input.
+func probeMP4(data []byte) (width, height, seconds uint32) {
+	moov := findBox(data, "moov")
+	if moov == nil {
+		return 0, 0, 0
+	}
+
+	if mvhd := findBox(moov, "mvhd"); len(mvhd) >= 20 {
+		var timescale, duration uint64
+		if mvhd[0] == 1 && len(mvhd) >= 32 {
+			timescale = uint64(binary.BigEndian.Uint32(mvhd[20:24]))
+			duration = binary.BigEndian.Uint64(mvhd[24:32])
+		} else {
+			timescale = uint64(binary.BigEndian.Uint32(mvhd[12:16]))
+			duration = uint64(binary.BigEndian.Uint32(mvhd[16:20]))
+		}
+		if timescale > 0 {
+			seconds = uint32(duration / timescale)
+		}
+	}
+
+	// The first track with non-zero dimensions is the video track.
+	rest := moov
+	for {
+		trak, next := nextBox(rest, "trak")
+		if trak == nil {
+			break
+		}
+		if tkhd := findBox(trak, "tkhd"); len(tkhd) >= 8 {
+			w := binary.BigEndian.Uint32(tkhd[len(tkhd)-8:]) >> 16
+			h := binary.BigEndian.Uint32(tkhd[len(tkhd)-4:]) >> 16
+			if w > 0 && h > 0 {
+				return w, h, seconds
+			}
+		}
+		rest = next
+	}
+	return 0, 0, seconds
+}
+
+// findBox returns the payload of the first box of the given type at the top level of data.
+func findBox(data []byte, boxType string) []byte {
+	payload, _ := nextBox(data, boxType)
+	return payload
+}
+
+// nextBox scans the top-level boxes of data for the given type and returns its payload
+// together with the remaining bytes after it, so repeated boxes can be iterated.
+func nextBox(data []byte, boxType string) (payload, rest []byte) {
+	for len(data) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(data[0:4]))
+		header := uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return nil, nil
+			}
+			size = binary.BigEndian.Uint64(data[8:16])
+			header = 16
+		}
+		if size < header || size > uint64(len(data)) {
+			return nil, nil
+		}
+
+		if string(data[4:8]) == boxType {
+			return data[header:size], data[size:]
+		}
+		data = data[size:]
+	}
+	return nil, nil
+}
@@ -0,0 +1,98 @@
+// Package utils provides helper functions and utilities for the bot.
+// This file, timezone.go, resolves the timezone a message's recipient lives in, from
+// per-user and per-chat preferences with config.Timezone as the default.
+package utils
+
+import (
+	"aemy/config"
+	"aemy/prefs"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	_ "time/tzdata" // Embedded timezone database, for hosts without one
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// offsetPattern matches UTC offsets such as "UTC+7", "GMT-03:30" or "+0530".
+var offsetPattern = regexp.MustCompile(`^(?i:UTC|GMT)?([+-])(\d{1,2})(?::?(\d{2}))?$`)
+
+// locations caches parsed timezones by name.
+var locations sync.Map
+
+// ParseTimezone parses an IANA timezone name (e.g. "Europe/Berlin") or a UTC offset
+// (e.g. "UTC+7", "+05:30").
+//
+// Parameters:
+//   - name: the timezone name or offset
+//
+// Returns:
+//   - *time.Location: the timezone
+//   - error: if name is neither a known timezone nor a valid offset
+func ParseTimezone(name string) (*time.Location, error) {
+	name = strings.TrimSpace(name)
+	if cached, ok := locations.Load(name); ok {
+		return cached.(*time.Location), nil
+	}
+
+	var loc *time.Location
+	if match := offsetPattern.FindStringSubmatch(name); match != nil {
+		hours, _ := strconv.Atoi(match[2])
+		minutes, _ := strconv.Atoi("0" + match[3])
+		if hours > 14 || minutes >= 60 {
+			return nil, fmt.Errorf("invalid UTC offset %q", name)
+		}
+		seconds := hours*3600 + minutes*60
+		if match[1] == "-" {
+			seconds = -seconds
+		}
+		loc = time.FixedZone(fmt.Sprintf("UTC%s%02d:%02d", match[1], hours, minutes), seconds)
+	} else {
+		// "Local" would be the server's zone, which is exactly what this replaces
+		if strings.EqualFold(name, "local") || name == "" {
+			return nil, fmt.Errorf("unknown timezone %q", name)
+		}
+		var err error
+		if loc, err = time.LoadLocation(name); err != nil {
+			return nil, fmt.Errorf("unknown timezone %q", name)
+		}
+	}
+
+	locations.Store(name, loc)
+	return loc, nil
+}
+
+// DefaultLocation returns config.Timezone, or UTC if it is invalid.
+func DefaultLocation() *time.Location {
+	loc, err := ParseTimezone(config.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// Location returns the timezone for a message: the sender's own preference, then the
+// chat's, then config.Timezone.
+//
+// Parameters:
+//   - chat: the chat the message belongs to
+//   - sender: the user who sent it
+//
+// Returns:
+//   - *time.Location: the timezone to present times in
+func Location(chat, sender types.JID) *time.Location {
+	for _, jid := range []types.JID{sender, chat} {
+		if jid.IsEmpty() {
+			continue
+		}
+		if name := prefs.Get(jid, prefs.KeyTimezone); name != "" {
+			if loc, err := ParseTimezone(name); err == nil {
+				return loc
+			}
+		}
+	}
+	return DefaultLocation()
+}
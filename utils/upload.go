@@ -0,0 +1,184 @@
+// Package utils provides helper functions and utilities for the bot.
+// This file, upload.go, reuses WhatsApp upload results for identical media so
+// sending the same file twice skips the upload entirely.
+package utils
+
+import (
+	"aemy/config"
+	local "aemy/types"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// cacheUploadsDir is the subdirectory of the cache holding upload results.
+const cacheUploadsDir = "uploads"
+
+// cachedUpload is the on-disk representation of a whatsmeow.UploadResponse.
+// It is needed because UploadResponse hides its key material from JSON encoding.
+type cachedUpload struct {
+	Expires       time.Time `json:"expires"`
+	URL           string    `json:"url"`
+	DirectPath    string    `json:"direct_path"`
+	Handle        string    `json:"handle"`
+	ObjectID      string    `json:"object_id"`
+	MediaKey      []byte    `json:"media_key"`
+	FileEncSHA256 []byte    `json:"file_enc_sha256"`
+	FileSHA256    []byte    `json:"file_sha256"`
+	FileLength    uint64    `json:"file_length"`
+}
+
+// uploadKey returns the cache file name for data uploaded as mediaType.
+// The media type is part of the key because it determines the encryption keys.
+func uploadKey(data []byte, mediaType whatsmeow.MediaType) string {
+	return HashKey(data) + "-" + HashKey([]byte(mediaType))[:8] + ".json"
+}
+
+// GetUpload returns a previously stored upload result for identical bytes, if it has not expired.
+func (c *Cache) GetUpload(data []byte, mediaType whatsmeow.MediaType) (whatsmeow.UploadResponse, bool) {
+	var entry cachedUpload
+	file := c.path(cacheUploadsDir, uploadKey(data, mediaType))
+	if !c.readJSON(file, &entry) || time.Now().After(entry.Expires) {
+		c.misses.Add(1)
+		return whatsmeow.UploadResponse{}, false
+	}
+
+	c.touch(file)
+	c.hits.Add(1)
+	return whatsmeow.UploadResponse{
+		URL:           entry.URL,
+		DirectPath:    entry.DirectPath,
+		Handle:        entry.Handle,
+		ObjectID:      entry.ObjectID,
+		MediaKey:      entry.MediaKey,
+		FileEncSHA256: entry.FileEncSHA256,
+		FileSHA256:    entry.FileSHA256,
+		FileLength:    entry.FileLength,
+	}, true
+}
+
+// SetUpload stores an upload result for data so it can be reused until config.UploadTTL passes.
+// The result contains the media key, so the uploads directory is restricted to the owner
+// (mode 0700), including one created by an older version with wider permissions.
+func (c *Cache) SetUpload(data []byte, mediaType whatsmeow.MediaType, uploaded whatsmeow.UploadResponse) error {
+	dir := filepath.Join(c.dir, cacheUploadsDir)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	if err := os.Chmod(dir, 0o700); err != nil {
+		return err
+	}
+	return c.writeJSON(c.path(cacheUploadsDir, uploadKey(data, mediaType)), cachedUpload{
+		Expires:       time.Now().Add(config.UploadTTL),
+		URL:           uploaded.URL,
+		DirectPath:    uploaded.DirectPath,
+		Handle:        uploaded.Handle,
+		ObjectID:      uploaded.ObjectID,
+		MediaKey:      uploaded.MediaKey,
+		FileEncSHA256: uploaded.FileEncSHA256,
+		FileSHA256:    uploaded.FileSHA256,
+		FileLength:    uploaded.FileLength,
+	})
+}
+
+// DeleteUpload forgets the stored upload result for data, forcing the next send to upload again.
+func (c *Cache) DeleteUpload(data []byte, mediaType whatsmeow.MediaType) {
+	_ = os.Remove(c.path(cacheUploadsDir, uploadKey(data, mediaType)))
+}
+
+// cachesUploads reports whether uploads through client are cached. Only uploads to the
+// live WhatsApp servers are; tests replace it to exercise the cache with a fake client.
+var cachesUploads = func(client local.Client) bool {
+	_, live := client.(*WhatsmeowClient)
+	return live
+}
+
+// UploadMedia uploads data to WhatsApp, reusing a stored result when the same bytes
+// were uploaded before. Only uploads to the live WhatsApp servers are cached; other
+// clients such as utilstest.FakeClient always upload.
+//
+// Parameters:
+//   - ctx: context for the upload request
+//   - client: the client used to upload
+//   - data: the raw media bytes
+//   - mediaType: the WhatsApp media type (image, video, audio, document)
+//
+// Returns:
+//   - whatsmeow.UploadResponse: the upload result to copy into the outgoing message
+//   - bool: true if the result came from the cache instead of a fresh upload
+//   - error: if the upload fails
+func UploadMedia(ctx context.Context, client local.Client, data []byte, mediaType whatsmeow.MediaType) (whatsmeow.UploadResponse, bool, error) {
+	// Other clients do not touch the cache, so they do not skew its hit ratio either
+	live := cachesUploads(client)
+	if live {
+		if uploaded, ok := DefaultCache.GetUpload(data, mediaType); ok {
+			return uploaded, true, nil
+		}
+	}
+
+	uploaded, err := client.Upload(ctx, data, mediaType)
+	if err != nil {
+		return whatsmeow.UploadResponse{}, false, err
+	}
+	if live {
+		_ = DefaultCache.SetUpload(data, mediaType, uploaded)
+	}
+	return uploaded, false, nil
+}
+
+// SendUploaded uploads data (or reuses a previous upload), builds the message with build,
+// and sends it to the given chat. config.UploadTTL keeps reused uploads fresh; if sending
+// still fails while using a reused upload, e.g. because WhatsApp has purged the media,
+// the stale entry is dropped and the media is uploaded and sent again once.
+//
+// Parameters:
+//   - ctx: context for the upload and send requests
+//   - client: the client used to upload and send
+//   - to: destination chat JID
+//   - data: the raw media bytes
+//   - mediaType: the WhatsApp media type
+//   - build: constructs the outgoing message from the upload result
+//
+// Returns:
+//   - whatsmeow.SendResponse: the send result from WhatsApp
+//   - error: if upload or send fails
+func SendUploaded(ctx context.Context, client local.Client, to types.JID, data []byte, mediaType whatsmeow.MediaType, build func(whatsmeow.UploadResponse) *waE2E.Message) (whatsmeow.SendResponse, error) {
+	return sendUploaded(ctx, client, to, data, mediaType, true, build)
+}
+
+// sendUploaded is SendUploaded, with the upload cache only used if cache is true.
+func sendUploaded(ctx context.Context, client local.Client, to types.JID, data []byte, mediaType whatsmeow.MediaType, cache bool, build func(whatsmeow.UploadResponse) *waE2E.Message) (whatsmeow.SendResponse, error) {
+	var uploaded whatsmeow.UploadResponse
+	var reused bool
+	var err error
+	if cache {
+		uploaded, reused, err = UploadMedia(ctx, client, data, mediaType)
+	} else {
+		uploaded, err = client.Upload(ctx, data, mediaType)
+	}
+	if err != nil {
+		return whatsmeow.SendResponse{}, fmt.Errorf("upload error: %s", err)
+	}
+
+	resp, err := client.SendMessage(ctx, to, build(uploaded))
+	if err != nil && reused && ctx.Err() == nil {
+		// The reused upload was rejected, so upload the media again and retry once.
+		DefaultCache.DeleteUpload(data, mediaType)
+		uploaded, _, err = UploadMedia(ctx, client, data, mediaType)
+		if err != nil {
+			return whatsmeow.SendResponse{}, fmt.Errorf("upload error: %s", err)
+		}
+		resp, err = client.SendMessage(ctx, to, build(uploaded))
+	}
+	if err != nil {
+		return whatsmeow.SendResponse{}, fmt.Errorf("error send message %s", err)
+	}
+
+	return resp, nil
+}
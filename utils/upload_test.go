@@ -0,0 +1,70 @@
+package utils
+
+import (
+	local "aemy/types"
+	"aemy/utils/utilstest"
+	"context"
+	"errors"
+	"testing"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+// staleClient is a FakeClient whose sends fail for media at the URL stale, like
+// WhatsApp rejecting media it has already purged. It counts the uploads.
+type staleClient struct {
+	*utilstest.FakeClient
+	stale   string
+	uploads int
+}
+
+// Upload implements types.Client.
+func (c *staleClient) Upload(ctx context.Context, data []byte, mediaType whatsmeow.MediaType) (whatsmeow.UploadResponse, error) {
+	c.uploads++
+	return c.FakeClient.Upload(ctx, data, mediaType)
+}
+
+// SendMessage implements types.Client.
+func (c *staleClient) SendMessage(ctx context.Context, to types.JID, message *waE2E.Message, extra ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error) {
+	if message.GetImageMessage().GetURL() == c.stale {
+		return whatsmeow.SendResponse{}, errors.New("media not found")
+	}
+	return c.FakeClient.SendMessage(ctx, to, message, extra...)
+}
+
+func TestSendUploadedReuploadsStaleMedia(t *testing.T) {
+	withTestCache(t)
+	cached := cachesUploads
+	cachesUploads = func(local.Client) bool { return true }
+	t.Cleanup(func() { cachesUploads = cached })
+
+	self := types.NewJID("10000000000", types.DefaultUserServer)
+	client := &staleClient{FakeClient: utilstest.NewFakeClient(self), stale: "https://stale.invalid/media"}
+	data := []byte("image bytes")
+	if err := DefaultCache.SetUpload(data, whatsmeow.MediaImage, whatsmeow.UploadResponse{URL: client.stale}); err != nil {
+		t.Fatal(err)
+	}
+
+	build := func(uploaded whatsmeow.UploadResponse) *waE2E.Message {
+		return &waE2E.Message{ImageMessage: &waE2E.ImageMessage{URL: proto.String(uploaded.URL)}}
+	}
+	if _, err := SendUploaded(context.Background(), client, self, data, whatsmeow.MediaImage, build); err != nil {
+		t.Fatalf("SendUploaded: %v", err)
+	}
+	if client.uploads != 1 {
+		t.Errorf("uploaded %d times, want 1", client.uploads)
+	}
+	sent := client.Sent()
+	if len(sent) != 1 || sent[0].Message.GetImageMessage().GetURL() == client.stale {
+		t.Fatalf("sent %d messages, want one with the new upload", len(sent))
+	}
+
+	// The fresh upload replaced the stale entry
+	uploaded, ok := DefaultCache.GetUpload(data, whatsmeow.MediaImage)
+	if !ok || uploaded.URL == client.stale {
+		t.Errorf("cached upload = %q (found %v), want the new upload", uploaded.URL, ok)
+	}
+}
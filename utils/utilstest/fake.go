@@ -0,0 +1,348 @@
+// Package utilstest provides an in-memory WhatsApp client for tests and simulations.
+// This file, fake.go, implements types.Client in memory so that commands and the
+// event handler can run without a WhatsApp connection, e.g. in tests, the console
+// simulator and replays.
+package utilstest
+
+import (
+	local "aemy/types"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+// FakeMessage is a message sent through a FakeClient.
+type FakeMessage struct {
+	// ID is the message ID assigned by the fake client.
+	ID types.MessageID
+
+	// To is the destination chat.
+	To types.JID
+
+	// Message is the sent message, exactly as the bot built it.
+	Message *waE2E.Message
+
+	// Timestamp is the time the message was sent, as reported by the client's clock.
+	Timestamp time.Time
+}
+
+// FakeClient is an in-memory types.Client. It records outgoing messages instead of
+// sending them, keeps uploaded media so it can be downloaded again, and simulates
+// groups, presence and read receipts. It is safe for concurrent use.
+type FakeClient struct {
+	// ID and LID are returned by OwnID and OwnLID.
+	ID  types.JID
+	LID types.JID
+
+	// Clock returns the current time. It defaults to time.Now and can be fixed for reproducible output.
+	Clock func() time.Time
+
+	// OnSend, if set, is called for every message sent, e.g. to print it.
+	OnSend func(FakeMessage)
+
+	mu       sync.Mutex
+	counter  int
+	sent     []FakeMessage
+	media    map[string][]byte
+	groups   map[types.JID]*types.GroupInfo
+	presence map[types.JID]types.ChatPresence
+	online   types.Presence
+	read     []types.MessageID
+	resets   int
+}
+
+// Make sure the fake keeps satisfying the interface.
+var _ local.Client = (*FakeClient)(nil)
+
+// NewFakeClient creates an empty fake client logged in as own.
+//
+// Parameters:
+//   - own: the phone-number JID the fake bot account uses
+//
+// Returns:
+//   - *FakeClient: the fake client
+func NewFakeClient(own types.JID) *FakeClient {
+	return &FakeClient{
+		ID:       own,
+		Clock:    time.Now,
+		media:    make(map[string][]byte),
+		groups:   make(map[types.JID]*types.GroupInfo),
+		presence: make(map[types.JID]types.ChatPresence),
+	}
+}
+
+// now returns the time of the client's clock.
+func (c *FakeClient) now() time.Time {
+	if c.Clock == nil {
+		return time.Now()
+	}
+	return c.Clock()
+}
+
+// nextID returns a new sequential message ID. The caller must hold c.mu.
+func (c *FakeClient) nextID() types.MessageID {
+	c.counter++
+	return fmt.Sprintf("FAKE%012d", c.counter)
+}
+
+// OwnID returns the configured phone-number JID.
+func (c *FakeClient) OwnID() types.JID {
+	return c.ID
+}
+
+// OwnLID returns the configured LID.
+func (c *FakeClient) OwnLID() types.JID {
+	return c.LID
+}
+
+// SendMessage records message and returns a response with a sequential ID.
+func (c *FakeClient) SendMessage(ctx context.Context, to types.JID, message *waE2E.Message, extra ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error) {
+	c.mu.Lock()
+	sent := FakeMessage{
+		ID:        c.nextID(),
+		To:        to,
+		Message:   proto.Clone(message).(*waE2E.Message),
+		Timestamp: c.now(),
+	}
+	if len(extra) > 0 && extra[0].ID != "" {
+		sent.ID = extra[0].ID
+	}
+	c.sent = append(c.sent, sent)
+	onSend := c.OnSend
+	c.mu.Unlock()
+
+	if onSend != nil {
+		onSend(sent)
+	}
+	return whatsmeow.SendResponse{Timestamp: sent.Timestamp, ID: sent.ID, Sender: c.ID}, nil
+}
+
+// Upload stores plaintext and returns an upload response whose direct path refers to it.
+// Uploading the same bytes twice yields the same response.
+func (c *FakeClient) Upload(ctx context.Context, plaintext []byte, mediaType whatsmeow.MediaType) (whatsmeow.UploadResponse, error) {
+	sum := sha256.Sum256(plaintext)
+	path := "/fake/" + hex.EncodeToString(sum[:])
+
+	c.mu.Lock()
+	c.media[path] = append([]byte(nil), plaintext...)
+	c.mu.Unlock()
+
+	return whatsmeow.UploadResponse{
+		URL:           "https://fake.invalid" + path,
+		DirectPath:    path,
+		MediaKey:      sum[:],
+		FileEncSHA256: sum[:],
+		FileSHA256:    sum[:],
+		FileLength:    uint64(len(plaintext)),
+	}, nil
+}
+
+// Download returns media previously passed to Upload.
+func (c *FakeClient) Download(ctx context.Context, msg whatsmeow.DownloadableMessage) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data, ok := c.media[msg.GetDirectPath()]
+	if !ok {
+		return nil, fmt.Errorf("fake: no media at %q", msg.GetDirectPath())
+	}
+	return append([]byte(nil), data...), nil
+}
+
+// SendPresence records the global presence.
+func (c *FakeClient) SendPresence(state types.Presence) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.online = state
+	return nil
+}
+
+// SendChatPresence records the typing/recording state of jid.
+func (c *FakeClient) SendChatPresence(jid types.JID, state types.ChatPresence, media types.ChatPresenceMedia) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.presence[jid] = state
+	return nil
+}
+
+// MarkRead records ids as read.
+func (c *FakeClient) MarkRead(ids []types.MessageID, timestamp time.Time, chat, sender types.JID, receiptTypeExtra ...types.ReceiptType) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.read = append(c.read, ids...)
+	return nil
+}
+
+// GetGroupInfo returns a copy of a group added with SetGroup.
+func (c *FakeClient) GetGroupInfo(jid types.JID) (*types.GroupInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	group, ok := c.groups[jid]
+	if !ok {
+		return nil, whatsmeow.ErrGroupNotFound
+	}
+	return cloneGroup(group), nil
+}
+
+// GetJoinedGroups returns copies of all groups added with SetGroup.
+func (c *FakeClient) GetJoinedGroups() ([]*types.GroupInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	groups := make([]*types.GroupInfo, 0, len(c.groups))
+	for _, group := range c.groups {
+		groups = append(groups, cloneGroup(group))
+	}
+	return groups, nil
+}
+
+// UpdateGroupParticipants applies the change to the simulated group.
+func (c *FakeClient) UpdateGroupParticipants(jid types.JID, participantChanges []types.JID, action whatsmeow.ParticipantChange) ([]types.GroupParticipant, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	group, ok := c.groups[jid]
+	if !ok {
+		return nil, whatsmeow.ErrGroupNotFound
+	}
+
+	var changed []types.GroupParticipant
+	for _, user := range participantChanges {
+		index := -1
+		for i, p := range group.Participants {
+			if p.JID.User == user.User {
+				index = i
+				break
+			}
+		}
+
+		switch {
+		case action == whatsmeow.ParticipantChangeAdd && index < 0:
+			group.Participants = append(group.Participants, types.GroupParticipant{JID: user})
+			changed = append(changed, types.GroupParticipant{JID: user})
+		case action == whatsmeow.ParticipantChangeRemove && index >= 0:
+			changed = append(changed, group.Participants[index])
+			group.Participants = append(group.Participants[:index], group.Participants[index+1:]...)
+		case action == whatsmeow.ParticipantChangePromote && index >= 0:
+			group.Participants[index].IsAdmin = true
+			changed = append(changed, group.Participants[index])
+		case action == whatsmeow.ParticipantChangeDemote && index >= 0:
+			group.Participants[index].IsAdmin = false
+			changed = append(changed, group.Participants[index])
+		}
+	}
+	return changed, nil
+}
+
+// SetGroupName renames the simulated group.
+func (c *FakeClient) SetGroupName(jid types.JID, name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	group, ok := c.groups[jid]
+	if !ok {
+		return whatsmeow.ErrGroupNotFound
+	}
+	group.Name = name
+	return nil
+}
+
+// SetGroupTopic changes the description of the simulated group.
+func (c *FakeClient) SetGroupTopic(jid types.JID, previousID, newID, topic string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	group, ok := c.groups[jid]
+	if !ok {
+		return whatsmeow.ErrGroupNotFound
+	}
+	group.Topic = topic
+	group.TopicID = newID
+	return nil
+}
+
+// GetGroupInviteLink returns a fake invite link that changes when reset is true.
+func (c *FakeClient) GetGroupInviteLink(jid types.JID, reset bool) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.groups[jid]; !ok {
+		return "", whatsmeow.ErrGroupNotFound
+	}
+	if reset {
+		c.resets++
+	}
+	return fmt.Sprintf("https://chat.whatsapp.com/fake%s%d", jid.User, c.resets), nil
+}
+
+// LeaveGroup removes the simulated group.
+func (c *FakeClient) LeaveGroup(jid types.JID) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.groups[jid]; !ok {
+		return whatsmeow.ErrGroupNotFound
+	}
+	delete(c.groups, jid)
+	return nil
+}
+
+// SetGroup adds or replaces a simulated group.
+func (c *FakeClient) SetGroup(group *types.GroupInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.groups[group.JID] = cloneGroup(group)
+}
+
+// Sent returns the messages sent so far, oldest first.
+func (c *FakeClient) Sent() []FakeMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]FakeMessage(nil), c.sent...)
+}
+
+// Read returns the IDs of the messages marked as read so far.
+func (c *FakeClient) Read() []types.MessageID {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]types.MessageID(nil), c.read...)
+}
+
+// Presence returns the last global presence sent.
+func (c *FakeClient) Presence() types.Presence {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.online
+}
+
+// ChatPresence returns the last typing/recording state sent to jid.
+func (c *FakeClient) ChatPresence(jid types.JID) types.ChatPresence {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.presence[jid]
+}
+
+// Reset forgets all sent messages and read receipts. Media and groups are kept.
+func (c *FakeClient) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sent = nil
+	c.read = nil
+	c.counter = 0
+}
+
+// cloneGroup returns a copy of group that does not share its participant list.
+func cloneGroup(group *types.GroupInfo) *types.GroupInfo {
+	clone := *group
+	clone.Participants = append([]types.GroupParticipant(nil), group.Participants...)
+	return &clone
+}
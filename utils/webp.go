@@ -0,0 +1,730 @@
+// Package utils provides helper functions and utilities for the bot.
+// This file, webp.go, implements a small lossless WebP (VP8L) encoder and the
+// RIFF chunk handling needed to attach EXIF metadata to stickers. It is the
+// fallback when ffmpeg is not available, since golang.org/x/image only decodes WebP.
+package utils
+
+import (
+	"bytes"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+
+	"golang.org/x/image/webp"
+)
+
+// VP8L bitstream constants, see the WebP lossless bitstream specification.
+const (
+	vp8lSignature       = 0x2f
+	vp8lMaxCodeLength   = 15
+	vp8lNumLiterals     = 256
+	vp8lNumLengthCodes  = 24
+	vp8lNumDistance     = 40
+	vp8lMaxLength       = 4096
+	vp8lMinMatch        = 3
+	vp8lPredictorBits   = 9
+	vp8lPredictorSelect = 11
+	vp8lTransformPred   = 0
+	vp8lTransformSubG   = 2
+)
+
+// vp8lCodeLengthOrder is the order in which code length code lengths are stored.
+var vp8lCodeLengthOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// bitWriter writes values least significant bit first, as VP8L requires.
+type bitWriter struct {
+	buf   []byte
+	acc   uint64
+	nbits uint
+}
+
+// write appends the n low bits of v.
+func (w *bitWriter) write(v uint32, n uint) {
+	w.acc |= uint64(v) << w.nbits
+	w.nbits += n
+	for w.nbits >= 8 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc >>= 8
+		w.nbits -= 8
+	}
+}
+
+// bytes flushes the remaining bits and returns the written data.
+func (w *bitWriter) bytes() []byte {
+	if w.nbits > 0 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc, w.nbits = 0, 0
+	}
+	return w.buf
+}
+
+// prefixCode is a canonical Huffman code for one VP8L alphabet.
+type prefixCode struct {
+	lengths []uint8
+	codes   []uint32
+}
+
+// write emits the code for symbol. Canonical codes are stored bit-reversed
+// because VP8L reads them least significant bit first.
+func (c *prefixCode) write(w *bitWriter, symbol int) {
+	if n := c.lengths[symbol]; n > 0 {
+		w.write(c.codes[symbol], uint(n))
+	}
+}
+
+// vp8lSymbol is one entry of the LZ77-coded pixel stream: either a literal
+// ARGB pixel or a backward reference.
+type vp8lSymbol struct {
+	argb     uint32
+	length   int
+	distCode int
+}
+
+// EncodeWebP encodes img as a lossless WebP image.
+//
+// The encoder applies the subtract-green and a single "select" predictor
+// transform, run-length backward references and per-image Huffman codes. It is
+// much simpler than libwebp, but needs no cgo or external tools.
+//
+// Returns:
+//   - []byte: a complete RIFF/WEBP file containing a VP8L chunk
+//   - error: if the image is empty or larger than 16384 pixels on a side
+func EncodeWebP(img image.Image) ([]byte, error) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= 0 || height <= 0 || width > 1<<14 || height > 1<<14 {
+		return nil, errors.New("invalid webp dimensions")
+	}
+
+	rgba := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+
+	argb := make([]uint32, width*height)
+	hasAlpha := false
+	for i := range argb {
+		p := rgba.Pix[i*4 : i*4+4]
+		argb[i] = uint32(p[3])<<24 | uint32(p[0])<<16 | uint32(p[1])<<8 | uint32(p[2])
+		if p[3] != 0xff {
+			hasAlpha = true
+		}
+	}
+
+	w := &bitWriter{}
+	w.write(vp8lSignature, 8)
+	w.write(uint32(width-1), 14)
+	w.write(uint32(height-1), 14)
+	if hasAlpha {
+		w.write(1, 1)
+	} else {
+		w.write(0, 1)
+	}
+	w.write(0, 3) // version
+
+	// Subtract green transform.
+	w.write(1, 1)
+	w.write(vp8lTransformSubG, 2)
+	for i, p := range argb {
+		g := (p >> 8) & 0xff
+		r := ((p >> 16) - g) & 0xff
+		b := (p - g) & 0xff
+		argb[i] = p&0xff00ff00 | r<<16 | b
+	}
+
+	// Predictor transform with one "select" block covering the whole image.
+	w.write(1, 1)
+	w.write(vp8lTransformPred, 2)
+	w.write(vp8lPredictorBits-2, 3)
+	blocks := ((width + 1<<vp8lPredictorBits - 1) >> vp8lPredictorBits) * ((height + 1<<vp8lPredictorBits - 1) >> vp8lPredictorBits)
+	predictors := make([]uint32, blocks)
+	for i := range predictors {
+		predictors[i] = vp8lPredictorSelect << 8
+	}
+	writeVP8LImage(w, predictors, ((width + 1<<vp8lPredictorBits - 1) >> vp8lPredictorBits), false)
+	argb = predictResiduals(argb, width, height)
+
+	w.write(0, 1) // no more transforms
+
+	writeVP8LImage(w, argb, width, true)
+
+	return riffWebP(chunk("VP8L", w.bytes())), nil
+}
+
+// predictResiduals returns the difference between every pixel and its "select"
+// prediction, with the fixed predictors the spec mandates for the first row and column.
+func predictResiduals(argb []uint32, width, height int) []uint32 {
+	out := make([]uint32, len(argb))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := y*width + x
+			var pred uint32
+			switch {
+			case x == 0 && y == 0:
+				pred = 0xff000000
+			case y == 0:
+				pred = argb[i-1]
+			case x == 0:
+				pred = argb[i-width]
+			default:
+				pred = selectPredictor(argb[i-1], argb[i-width], argb[i-width-1])
+			}
+			out[i] = subPixels(argb[i], pred)
+		}
+	}
+	return out
+}
+
+// selectPredictor implements predictor mode 11 of the VP8L specification.
+func selectPredictor(l, t, tl uint32) uint32 {
+	dist := func(a, b uint32) int {
+		sum := 0
+		for shift := 0; shift < 32; shift += 8 {
+			d := int((a>>shift)&0xff) - int((b>>shift)&0xff)
+			if d < 0 {
+				d = -d
+			}
+			sum += d
+		}
+		return sum
+	}
+	// pL is the distance of the estimate L+T-TL from L, i.e. |T-TL|; pT likewise |L-TL|.
+	if dist(t, tl) < dist(l, tl) {
+		return l
+	}
+	return t
+}
+
+// subPixels subtracts b from a per channel, modulo 256.
+func subPixels(a, b uint32) uint32 {
+	var out uint32
+	for shift := 0; shift < 32; shift += 8 {
+		out |= (((a >> shift) - (b >> shift)) & 0xff) << shift
+	}
+	return out
+}
+
+// writeVP8LImage encodes argb as an entropy-coded image. The main image carries an
+// extra "no meta prefix codes" bit that transform sub-images do not have.
+func writeVP8LImage(w *bitWriter, argb []uint32, width int, main bool) {
+	w.write(0, 1) // no color cache
+	if main {
+		w.write(0, 1) // single prefix code group
+	}
+
+	symbols := lz77(argb, width)
+
+	green := make([]int, vp8lNumLiterals+vp8lNumLengthCodes)
+	red := make([]int, vp8lNumLiterals)
+	blue := make([]int, vp8lNumLiterals)
+	alpha := make([]int, vp8lNumLiterals)
+	dist := make([]int, vp8lNumDistance)
+	for _, s := range symbols {
+		if s.length == 0 {
+			green[(s.argb>>8)&0xff]++
+			red[(s.argb>>16)&0xff]++
+			blue[s.argb&0xff]++
+			alpha[s.argb>>24]++
+			continue
+		}
+		code, _, _ := vp8lPrefix(s.length)
+		green[vp8lNumLiterals+code]++
+		code, _, _ = vp8lPrefix(s.distCode)
+		dist[code]++
+	}
+
+	codes := make([]*prefixCode, 5)
+	for i, histogram := range [][]int{green, red, blue, alpha, dist} {
+		codes[i] = writePrefixCode(w, histogram)
+	}
+
+	for _, s := range symbols {
+		if s.length == 0 {
+			codes[0].write(w, int((s.argb>>8)&0xff))
+			codes[1].write(w, int((s.argb>>16)&0xff))
+			codes[2].write(w, int(s.argb&0xff))
+			codes[3].write(w, int(s.argb>>24))
+			continue
+		}
+		code, bits, extra := vp8lPrefix(s.length)
+		codes[0].write(w, vp8lNumLiterals+code)
+		w.write(extra, bits)
+		code, bits, extra = vp8lPrefix(s.distCode)
+		codes[4].write(w, code)
+		w.write(extra, bits)
+	}
+}
+
+// lz77 turns pixels into literals and backward references that repeat the pixel
+// to the left (distance code 2) or the row above (distance code 1).
+func lz77(argb []uint32, width int) []vp8lSymbol {
+	var symbols []vp8lSymbol
+	for i := 0; i < len(argb); {
+		best, bestCode := 0, 0
+		for _, ref := range [...]struct{ dist, code int }{{1, 2}, {width, 1}} {
+			if i < ref.dist {
+				continue
+			}
+			n := 0
+			for i+n < len(argb) && n < vp8lMaxLength && argb[i+n] == argb[i+n-ref.dist] {
+				n++
+			}
+			if n > best {
+				best, bestCode = n, ref.code
+			}
+		}
+
+		if best >= vp8lMinMatch {
+			symbols = append(symbols, vp8lSymbol{length: best, distCode: bestCode})
+			i += best
+			continue
+		}
+		symbols = append(symbols, vp8lSymbol{argb: argb[i]})
+		i++
+	}
+	return symbols
+}
+
+// vp8lPrefix splits a length or distance code value into its prefix symbol and
+// extra bits, as described in section 5.2.2 of the specification.
+func vp8lPrefix(v int) (code int, bits uint, extra uint32) {
+	d := v - 1
+	if d < 4 {
+		return d, 0, 0
+	}
+	h := 31
+	for d>>h == 0 {
+		h--
+	}
+	second := (d >> (h - 1)) & 1
+	bits = uint(h - 1)
+	return 2*h + second, bits, uint32(d) & (1<<bits - 1)
+}
+
+// writePrefixCode builds a canonical Huffman code for histogram, writes its
+// description to w and returns it for encoding symbols.
+func writePrefixCode(w *bitWriter, histogram []int) *prefixCode {
+	used := []int{}
+	for symbol, count := range histogram {
+		if count > 0 {
+			used = append(used, symbol)
+		}
+	}
+
+	code := &prefixCode{lengths: make([]uint8, len(histogram)), codes: make([]uint32, len(histogram))}
+
+	// Zero or one used symbol (below 256) fits the "simple" code, which costs no bits per symbol.
+	if len(used) <= 1 && (len(used) == 0 || used[0] < 256) {
+		symbol := 0
+		if len(used) == 1 {
+			symbol = used[0]
+		}
+		w.write(1, 1) // simple code
+		w.write(0, 1) // one symbol
+		if symbol < 2 {
+			w.write(0, 1)
+			w.write(uint32(symbol), 1)
+		} else {
+			w.write(1, 1)
+			w.write(uint32(symbol), 8)
+		}
+		return code
+	}
+
+	code.lengths = huffmanLengths(histogram, vp8lMaxCodeLength)
+	code.codes = canonicalCodes(code.lengths)
+
+	// Encode the code lengths with literal lengths 0-15 and zero runs (17, 18).
+	type token struct {
+		symbol int
+		extra  uint32
+		bits   uint
+	}
+	var tokens []token
+	lengths := code.lengths
+	for i := 0; i < len(lengths); {
+		if lengths[i] != 0 {
+			tokens = append(tokens, token{symbol: int(lengths[i])})
+			i++
+			continue
+		}
+		run := 0
+		for i+run < len(lengths) && lengths[i+run] == 0 && run < 138 {
+			run++
+		}
+		switch {
+		case run >= 11:
+			tokens = append(tokens, token{symbol: 18, extra: uint32(run - 11), bits: 7})
+		case run >= 3:
+			tokens = append(tokens, token{symbol: 17, extra: uint32(run - 3), bits: 3})
+		default:
+			for j := 0; j < run; j++ {
+				tokens = append(tokens, token{symbol: 0})
+			}
+		}
+		i += run
+	}
+
+	clHistogram := make([]int, 19)
+	for _, t := range tokens {
+		clHistogram[t.symbol]++
+	}
+	clLengths := huffmanLengths(clHistogram, 7)
+	clCodes := canonicalCodes(clLengths)
+
+	numCodes := 19
+	for numCodes > 4 && clLengths[vp8lCodeLengthOrder[numCodes-1]] == 0 {
+		numCodes--
+	}
+
+	w.write(0, 1) // normal code
+	w.write(uint32(numCodes-4), 4)
+	for _, symbol := range vp8lCodeLengthOrder[:numCodes] {
+		w.write(uint32(clLengths[symbol]), 3)
+	}
+	w.write(0, 1) // code lengths cover the whole alphabet
+	for _, t := range tokens {
+		w.write(clCodes[t.symbol], uint(clLengths[t.symbol]))
+		w.write(t.extra, t.bits)
+	}
+	return code
+}
+
+// huffmanNode is a node of the tree built by huffmanLengths.
+type huffmanNode struct {
+	count       int
+	symbol      int
+	left, right *huffmanNode
+}
+
+// huffmanHeap is a min-heap of nodes ordered by count.
+type huffmanHeap []*huffmanNode
+
+func (h huffmanHeap) Len() int           { return len(h) }
+func (h huffmanHeap) Less(i, j int) bool { return h[i].count < h[j].count }
+func (h huffmanHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *huffmanHeap) Push(x any)        { *h = append(*h, x.(*huffmanNode)) }
+func (h *huffmanHeap) Pop() any {
+	old := *h
+	n := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return n
+}
+
+// huffmanLengths computes Huffman code lengths for histogram, limited to maxLength
+// bits. Symbols with a zero count get length 0. If only one symbol is used, a second
+// dummy symbol is given a code so the code is complete, as decoders require.
+func huffmanLengths(histogram []int, maxLength int) []uint8 {
+	counts := append([]int(nil), histogram...)
+	used := 0
+	for _, c := range counts {
+		if c > 0 {
+			used++
+		}
+	}
+	if used == 1 {
+		for i := range counts {
+			if counts[i] == 0 {
+				counts[i] = 1
+				break
+			}
+		}
+	}
+
+	for floor := 1; ; floor *= 2 {
+		h := &huffmanHeap{}
+		for symbol, c := range counts {
+			if c > 0 {
+				heap.Push(h, &huffmanNode{count: max(c, floor), symbol: symbol})
+			}
+		}
+		for h.Len() > 1 {
+			a := heap.Pop(h).(*huffmanNode)
+			b := heap.Pop(h).(*huffmanNode)
+			heap.Push(h, &huffmanNode{count: a.count + b.count, left: a, right: b})
+		}
+
+		lengths := make([]uint8, len(counts))
+		tooLong := false
+		var walk func(n *huffmanNode, depth int)
+		walk = func(n *huffmanNode, depth int) {
+			if n.left == nil {
+				if depth > maxLength {
+					tooLong = true
+				}
+				lengths[n.symbol] = uint8(depth)
+				return
+			}
+			walk(n.left, depth+1)
+			walk(n.right, depth+1)
+		}
+		walk(heap.Pop(h).(*huffmanNode), 0)
+
+		// Raising the minimum count flattens the tree until it fits in maxLength.
+		if !tooLong {
+			return lengths
+		}
+	}
+}
+
+// canonicalCodes assigns canonical Huffman codes to lengths and returns them
+// bit-reversed for least-significant-bit-first output.
+func canonicalCodes(lengths []uint8) []uint32 {
+	var counts [vp8lMaxCodeLength + 1]uint32
+	for _, l := range lengths {
+		counts[l]++
+	}
+	counts[0] = 0
+
+	var next [vp8lMaxCodeLength + 2]uint32
+	code := uint32(0)
+	for bits := 1; bits <= vp8lMaxCodeLength; bits++ {
+		code = (code + counts[bits-1]) << 1
+		next[bits] = code
+	}
+
+	codes := make([]uint32, len(lengths))
+	for symbol, l := range lengths {
+		if l == 0 {
+			continue
+		}
+		c := next[l]
+		next[l]++
+		var rev uint32
+		for i := uint8(0); i < l; i++ {
+			rev = rev<<1 | (c>>i)&1
+		}
+		codes[symbol] = rev
+	}
+	return codes
+}
+
+// chunk builds a RIFF chunk with the given four-character id, padded to an even size.
+func chunk(id string, payload []byte) []byte {
+	out := make([]byte, 8, 8+len(payload)+1)
+	copy(out, id)
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(payload)))
+	out = append(out, payload...)
+	if len(payload)%2 == 1 {
+		out = append(out, 0)
+	}
+	return out
+}
+
+// riffWebP wraps already encoded chunks in a RIFF/WEBP container.
+func riffWebP(chunks ...[]byte) []byte {
+	body := []byte("WEBP")
+	for _, c := range chunks {
+		body = append(body, c...)
+	}
+	out := make([]byte, 8, 8+len(body))
+	copy(out, "RIFF")
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(body)))
+	return append(out, body...)
+}
+
+// webpChunk is a chunk read from a WebP file.
+type webpChunk struct {
+	id      string
+	payload []byte
+}
+
+// parseWebP splits a RIFF/WEBP file into its chunks.
+func parseWebP(data []byte) ([]webpChunk, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, errors.New("not a webp file")
+	}
+
+	return parseChunks(data[12:])
+}
+
+// parseChunks splits a sequence of RIFF chunks, e.g. the body of a WebP file or the
+// frame data of an ANMF chunk.
+func parseChunks(rest []byte) ([]webpChunk, error) {
+	var chunks []webpChunk
+	for len(rest) >= 8 {
+		size := int(binary.LittleEndian.Uint32(rest[4:8]))
+		if 8+size > len(rest) {
+			return nil, errors.New("truncated webp chunk")
+		}
+		chunks = append(chunks, webpChunk{id: string(rest[0:4]), payload: rest[8 : 8+size]})
+		rest = rest[8+size+size%2:]
+		if len(rest) == 1 {
+			break
+		}
+	}
+	return chunks, nil
+}
+
+// webpCanvas returns the canvas size and alpha usage of a simple (VP8 or VP8L) WebP image.
+func webpCanvas(c webpChunk) (width, height int, alpha bool, err error) {
+	switch c.id {
+	case "VP8L":
+		if len(c.payload) < 5 || c.payload[0] != vp8lSignature {
+			return 0, 0, false, errors.New("invalid VP8L chunk")
+		}
+		bits := binary.LittleEndian.Uint32(c.payload[1:5])
+		return int(bits&0x3fff) + 1, int((bits>>14)&0x3fff) + 1, bits>>28&1 == 1, nil
+	case "VP8 ":
+		if len(c.payload) < 10 || !bytes.Equal(c.payload[3:6], []byte{0x9d, 0x01, 0x2a}) {
+			return 0, 0, false, errors.New("invalid VP8 chunk")
+		}
+		w := binary.LittleEndian.Uint16(c.payload[6:8]) & 0x3fff
+		h := binary.LittleEndian.Uint16(c.payload[8:10]) & 0x3fff
+		return int(w), int(h), false, nil
+	default:
+		return 0, 0, false, errors.New("unsupported webp chunk " + c.id)
+	}
+}
+
+// SetWebPExif returns data with its EXIF metadata replaced by exif. Simple WebP
+// files are converted to the extended (VP8X) format, which is required for metadata.
+//
+// Parameters:
+//   - data: a WebP file, static or animated
+//   - exif: the raw EXIF payload to embed
+//
+// Returns:
+//   - []byte: the WebP file with the EXIF chunk
+//   - error: if data is not a valid WebP file
+func SetWebPExif(data, exif []byte) ([]byte, error) {
+	chunks, err := parseWebP(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(chunks) == 0 {
+		return nil, errors.New("empty webp file")
+	}
+
+	const exifFlag = 0x08
+	var vp8x []byte
+	var body [][]byte
+	if chunks[0].id == "VP8X" {
+		vp8x = append([]byte(nil), chunks[0].payload...)
+		for _, c := range chunks[1:] {
+			if c.id != "EXIF" {
+				body = append(body, chunk(c.id, c.payload))
+			}
+		}
+	} else {
+		width, height, alpha, err := webpCanvas(chunks[0])
+		if err != nil {
+			return nil, err
+		}
+		vp8x = make([]byte, 10)
+		if alpha {
+			vp8x[0] |= 0x10
+		}
+		putUint24(vp8x[4:], uint32(width-1))
+		putUint24(vp8x[7:], uint32(height-1))
+		for _, c := range chunks {
+			body = append(body, chunk(c.id, c.payload))
+		}
+	}
+	if len(vp8x) < 10 {
+		return nil, errors.New("invalid VP8X chunk")
+	}
+	vp8x[0] |= exifFlag
+
+	out := append([][]byte{chunk("VP8X", vp8x)}, body...)
+	return riffWebP(append(out, chunk("EXIF", exif))...), nil
+}
+
+// IsAnimatedWebP reports whether data is an animated WebP file.
+func IsAnimatedWebP(data []byte) bool {
+	chunks, err := parseWebP(data)
+	if err != nil || len(chunks) == 0 || chunks[0].id != "VP8X" || len(chunks[0].payload) < 1 {
+		return false
+	}
+	return chunks[0].payload[0]&0x02 != 0
+}
+
+// DecodeWebP decodes a WebP image. Unlike webp.Decode it also accepts extended files
+// that combine the VP8X alpha flag with a lossless VP8L chunk, which is how stickers
+// (including ours) are usually stored, and animated files, of which it returns the
+// first frame. Neither golang.org/x/image nor ffmpeg can decode animations.
+func DecodeWebP(data []byte) (image.Image, error) {
+	chunks, err := parseWebP(data)
+	if err != nil {
+		return nil, err
+	}
+	if IsAnimatedWebP(data) {
+		return decodeFirstFrame(chunks)
+	}
+	for _, c := range chunks {
+		if c.id == "VP8L" {
+			return webp.Decode(bytes.NewReader(riffWebP(chunk(c.id, c.payload))))
+		}
+	}
+	return webp.Decode(bytes.NewReader(data))
+}
+
+// decodeFirstFrame decodes the first ANMF frame of an animated WebP file and places it
+// on a transparent canvas of the size given in the VP8X chunk.
+func decodeFirstFrame(chunks []webpChunk) (image.Image, error) {
+	vp8x := chunks[0].payload
+	if len(vp8x) < 10 {
+		return nil, errors.New("invalid VP8X chunk")
+	}
+	canvas := image.NewNRGBA(image.Rect(0, 0, int(uint24(vp8x[4:]))+1, int(uint24(vp8x[7:]))+1))
+
+	for _, c := range chunks[1:] {
+		if c.id != "ANMF" {
+			continue
+		}
+		if len(c.payload) < 16 {
+			return nil, errors.New("invalid ANMF chunk")
+		}
+		x, y := int(uint24(c.payload[0:]))*2, int(uint24(c.payload[3:]))*2
+		width, height := int(uint24(c.payload[6:]))+1, int(uint24(c.payload[9:]))+1
+
+		frame, err := parseChunks(c.payload[16:])
+		if err != nil {
+			return nil, err
+		}
+		img, err := decodeFrame(frame, width, height)
+		if err != nil {
+			return nil, err
+		}
+		draw.Draw(canvas, image.Rect(x, y, x+width, y+height), img, img.Bounds().Min, draw.Src)
+		return canvas, nil
+	}
+	return nil, errors.New("animated webp has no frames")
+}
+
+// decodeFrame decodes the bitstream chunks of an animation frame: a lossless VP8L
+// chunk, or a lossy VP8 chunk optionally preceded by an ALPH chunk.
+func decodeFrame(frame []webpChunk, width, height int) (image.Image, error) {
+	var alph []byte
+	for _, c := range frame {
+		switch c.id {
+		case "ALPH":
+			alph = c.payload
+		case "VP8L":
+			return webp.Decode(bytes.NewReader(riffWebP(chunk(c.id, c.payload))))
+		case "VP8 ":
+			if alph == nil {
+				return webp.Decode(bytes.NewReader(riffWebP(chunk(c.id, c.payload))))
+			}
+			// A lossy frame with alpha only decodes as an extended file
+			vp8x := make([]byte, 10)
+			vp8x[0] = 0x10
+			putUint24(vp8x[4:], uint32(width-1))
+			putUint24(vp8x[7:], uint32(height-1))
+			return webp.Decode(bytes.NewReader(riffWebP(chunk("VP8X", vp8x), chunk("ALPH", alph), chunk(c.id, c.payload))))
+		}
+	}
+	return nil, errors.New("animation frame has no image data")
+}
+
+// uint24 reads a 24-bit little-endian integer.
+func uint24(b []byte) uint32 {
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16
+}
+
+// putUint24 stores v as a 24-bit little-endian integer.
+func putUint24(b []byte, v uint32) {
+	b[0] = byte(v)
+	b[1] = byte(v >> 8)
+	b[2] = byte(v >> 16)
+}
@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+// testImage returns a w×h image with gradients, noise and a transparent corner, so
+// every part of the encoder (literals, backward references, alpha) is exercised.
+func testImage(w, h int) *image.NRGBA {
+	rnd := rand.New(rand.NewSource(1))
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.NRGBA{R: uint8(x * 255 / w), G: uint8(y * 255 / h), B: 128, A: 255}
+			if x > w/2 && y > h/2 {
+				c.B = uint8(rnd.Intn(256))
+			}
+			if x < w/4 && y < h/4 {
+				c.A = uint8(x * 255 / w)
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+// assertSameImage fails unless got has the size and the exact pixels of want.
+func assertSameImage(t *testing.T, want *image.NRGBA, got image.Image) {
+	t.Helper()
+	if got.Bounds().Size() != want.Bounds().Size() {
+		t.Fatalf("size = %v, want %v", got.Bounds().Size(), want.Bounds().Size())
+	}
+	offset := got.Bounds().Min
+	for y := 0; y < want.Rect.Dy(); y++ {
+		for x := 0; x < want.Rect.Dx(); x++ {
+			w := want.NRGBAAt(x, y)
+			g := color.NRGBAModel.Convert(got.At(offset.X+x, offset.Y+y)).(color.NRGBA)
+			if w.A == 0 && g.A == 0 {
+				continue
+			}
+			if w != g {
+				t.Fatalf("pixel (%d, %d) = %v, want %v", x, y, g, w)
+			}
+		}
+	}
+}
+
+func TestEncodeWebPRoundTrip(t *testing.T) {
+	for _, size := range []image.Point{{1, 1}, {7, 3}, {64, 64}, {513, 300}} {
+		want := testImage(size.X, size.Y)
+		data, err := EncodeWebP(want)
+		if err != nil {
+			t.Fatalf("EncodeWebP(%v): %v", size, err)
+		}
+
+		got, err := webp.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("webp.Decode(%v): %v", size, err)
+		}
+		assertSameImage(t, want, got)
+	}
+}
+
+func TestDecodeWebPAnimatedFirstFrame(t *testing.T) {
+	first, second := testImage(40, 30), testImage(40, 30)
+	second.SetNRGBA(0, 0, color.NRGBA{R: 1, A: 255})
+
+	frame := func(img image.Image, x, y int) []byte {
+		data, err := EncodeWebP(img)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunks, err := parseWebP(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		header := make([]byte, 16)
+		putUint24(header[0:], uint32(x/2))
+		putUint24(header[3:], uint32(y/2))
+		putUint24(header[6:], uint32(img.Bounds().Dx()-1))
+		putUint24(header[9:], uint32(img.Bounds().Dy()-1))
+		putUint24(header[12:], 100)
+		return chunk("ANMF", append(header, chunk("VP8L", chunks[0].payload)...))
+	}
+
+	vp8x := make([]byte, 10)
+	vp8x[0] = 0x12 // alpha and animation
+	putUint24(vp8x[4:], 63)
+	putUint24(vp8x[7:], 47)
+	data := riffWebP(chunk("VP8X", vp8x), chunk("ANIM", make([]byte, 6)), frame(first, 10, 8), frame(second, 0, 0))
+
+	if !IsAnimatedWebP(data) {
+		t.Fatal("IsAnimatedWebP = false")
+	}
+	img, err := DecodeWebP(data)
+	if err != nil {
+		t.Fatalf("DecodeWebP: %v", err)
+	}
+	if img.Bounds().Size() != image.Pt(64, 48) {
+		t.Fatalf("canvas size = %v, want 64x48", img.Bounds().Size())
+	}
+	assertSameImage(t, first, img.(*image.NRGBA).SubImage(image.Rect(10, 8, 50, 38)))
+	if a := color.NRGBAModel.Convert(img.At(60, 40)).(color.NRGBA).A; a != 0 {
+		t.Fatalf("outside the frame alpha = %d, want 0", a)
+	}
+}
@@ -0,0 +1,69 @@
+// Package utils provides helper functions and utilities for the bot.
+// This file, whatsmeow.go, adapts a live whatsmeow client to the types.Client interface.
+package utils
+
+import (
+	"aemy/outbox"
+	local "aemy/types"
+	"context"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// WhatsmeowClient implements types.Client on top of a connected *whatsmeow.Client.
+// Messages are sent through an outbox.Queue that paces them; all other methods are
+// promoted from the embedded client.
+type WhatsmeowClient struct {
+	*whatsmeow.Client
+
+	// queue sends the messages of this client within the configured rate limits.
+	queue *outbox.Queue
+}
+
+// Make sure the adapter keeps satisfying the interface as whatsmeow evolves.
+var _ local.Client = (*WhatsmeowClient)(nil)
+
+// NewWhatsmeowClient wraps client so it can be used wherever a types.Client is expected.
+// Its messages are queued with the limits from config (see outbox.DefaultLimits); call
+// Close once the client is no longer used.
+//
+// Parameters:
+//   - client: the whatsmeow client instance
+//
+// Returns:
+//   - *WhatsmeowClient: the adapter
+func NewWhatsmeowClient(client *whatsmeow.Client) *WhatsmeowClient {
+	return &WhatsmeowClient{
+		Client: client,
+		queue:  outbox.New(client.SendMessage, client.GenerateMessageID, outbox.DefaultLimits(), client.Log.Sub("Outbox")),
+	}
+}
+
+// SendMessage queues a message and waits until it is sent, see outbox.Queue.Send.
+// The priority is taken from ctx (outbox.WithPriority).
+func (c *WhatsmeowClient) SendMessage(ctx context.Context, to types.JID, message *waE2E.Message, extra ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error) {
+	return c.queue.Send(ctx, to, message, extra...)
+}
+
+// Close stops the outgoing queue. Messages that are still queued are not sent.
+func (c *WhatsmeowClient) Close() {
+	c.queue.Close()
+}
+
+// OwnID returns the bot's phone-number JID without device part, or an empty JID if not logged in.
+func (c *WhatsmeowClient) OwnID() types.JID {
+	if c.Store == nil || c.Store.ID == nil {
+		return types.EmptyJID
+	}
+	return c.Store.ID.ToNonAD()
+}
+
+// OwnLID returns the bot's LID without device part, or an empty JID if unknown.
+func (c *WhatsmeowClient) OwnLID() types.JID {
+	if c.Store == nil {
+		return types.EmptyJID
+	}
+	return c.Store.LID.ToNonAD()
+}